@@ -0,0 +1,144 @@
+// Package api serves an HTTP API controlling a client.Client as JSON, and
+// provides a Go client for it
+//
+// Every request carries the daemon's token as "Authorization: Bearer <token>".
+// Torrents are addressed by their hex encoded info hash:
+//
+//	GET    /api/v1/stats                    Stats
+//	GET    /api/v1/torrents                 []Torrent
+//	POST   /api/v1/torrents                 AddRequest -> Torrent
+//	GET    /api/v1/torrents/{hash}          Torrent
+//	DELETE /api/v1/torrents/{hash}          Remove, keeping the downloaded files
+//	POST   /api/v1/torrents/{hash}/pause    Torrent
+//	POST   /api/v1/torrents/{hash}/resume   Torrent
+//	GET    /api/v1/torrents/{hash}/files    []File
+//	PUT    /api/v1/torrents/{hash}/files    PriorityRequest -> []File
+//	GET    /api/v1/torrents/{hash}/peers    []Peer
+//
+// Errors are answered with a 4xx or 5xx status and an ErrorResponse body.
+//
+// The same server speaks a subset of the Transmission RPC protocol at
+// TransmissionPath for existing remotes, authenticated with HTTP basic
+// authentication using the token as the password
+package api
+
+import (
+	"github.com/codecrafters-io/bittorrent-starter-go/client"
+)
+
+// Torrent is the state and progress of a torrent in the daemon
+type Torrent struct {
+	InfoHash        string `json:"info_hash"`
+	Name            string `json:"name"`
+	State           string `json:"state"`
+	Error           string `json:"error,omitempty"` // Why the torrent failed
+	Peers           int    `json:"peers"`
+	PiecesWanted    int    `json:"pieces_wanted"`
+	PiecesDone      int    `json:"pieces_done"`
+	BytesWanted     int64  `json:"bytes_wanted"`
+	BytesDone       int64  `json:"bytes_done"`
+	BytesDownloaded int64  `json:"bytes_downloaded"`
+	DownloadRate    int64  `json:"download_rate"` // Bytes per second lately
+}
+
+// File is one file of a torrent
+type File struct {
+	Index     int    `json:"index"`
+	Path      string `json:"path"`
+	Length    int64  `json:"length"`
+	Priority  string `json:"priority"` // skip, low, normal or high
+	BytesDone int64  `json:"bytes_done"`
+}
+
+// Peer is a peer a torrent is connected to
+type Peer struct {
+	Address      string `json:"address"`
+	PeerID       string `json:"peer_id"` // Hex encoded
+	Client       string `json:"client"`
+	Incoming     bool   `json:"incoming"`
+	Choked       bool   `json:"choked"` // The peer is choking us
+	Downloaded   int64  `json:"downloaded"`
+	DownloadRate int64  `json:"download_rate"` // Bytes per second lately
+}
+
+// Stats sums up the daemon
+type Stats struct {
+	Torrents        int   `json:"torrents"`
+	Peers           int   `json:"peers"`
+	BytesDownloaded int64 `json:"bytes_downloaded"`
+	DownloadRate    int   `json:"download_rate"` // Limit in bytes per second, zero for none
+	ListenPort      int   `json:"listen_port"`
+}
+
+// AddRequest adds a torrent from either a .torrent file or a magnet link
+type AddRequest struct {
+	Torrent []byte `json:"torrent,omitempty"` // Contents of a .torrent file, base64 encoded in JSON
+	Magnet  string `json:"magnet,omitempty"`
+	Paused  bool   `json:"paused,omitempty"` // Add without starting the download
+}
+
+// PriorityRequest changes the priorities of some files of a torrent
+type PriorityRequest struct {
+	Files []FilePriority `json:"files"`
+}
+
+// FilePriority sets the priority of the file with the given index
+type FilePriority struct {
+	Index    int    `json:"index"`
+	Priority string `json:"priority"` // skip, low, normal or high
+}
+
+// ErrorResponse is the body of every failed request
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+func newTorrent(t *client.Torrent) Torrent {
+	stats := t.Stats()
+	torrent := Torrent{
+		InfoHash:        stats.InfoHash,
+		Name:            stats.Name,
+		State:           stats.State.String(),
+		Peers:           stats.Peers,
+		PiecesWanted:    stats.PiecesWanted,
+		PiecesDone:      stats.PiecesDone,
+		BytesWanted:     stats.BytesWanted,
+		BytesDone:       stats.BytesDone,
+		BytesDownloaded: stats.BytesDownloaded,
+		DownloadRate:    stats.DownloadRate,
+	}
+	if stats.Err != nil {
+		torrent.Error = stats.Err.Error()
+	}
+	return torrent
+}
+
+func newFiles(t *client.Torrent) []File {
+	files := []File{}
+	for i, file := range t.Files() {
+		files = append(files, File{
+			Index:     i,
+			Path:      file.Path,
+			Length:    file.Length,
+			Priority:  file.Priority.String(),
+			BytesDone: file.BytesDone,
+		})
+	}
+	return files
+}
+
+func newPeers(t *client.Torrent) []Peer {
+	peers := []Peer{}
+	for _, peer := range t.Peers() {
+		peers = append(peers, Peer{
+			Address:      peer.Addr,
+			PeerID:       peer.PeerID,
+			Client:       peer.Client,
+			Incoming:     peer.Incoming,
+			Choked:       peer.Choked,
+			Downloaded:   peer.Downloaded,
+			DownloadRate: peer.DownloadRate,
+		})
+	}
+	return peers
+}
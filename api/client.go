@@ -0,0 +1,149 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Error is a failed request, as answered by the daemon
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Client calls the API of a running daemon
+type Client struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+// NewClient creates a client for the daemon at baseURL, such as
+// "http://127.0.0.1:9080". A bare host and port means plain HTTP
+func NewClient(baseURL, token string) *Client {
+	if !strings.Contains(baseURL, "://") {
+		baseURL = "http://" + baseURL
+	}
+	return &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		token:      token,
+		httpClient: &http.Client{},
+	}
+}
+
+// Stats sums up the daemon
+func (c *Client) Stats(ctx context.Context) (*Stats, error) {
+	var stats Stats
+	return &stats, c.do(ctx, http.MethodGet, "/api/v1/stats", nil, &stats)
+}
+
+// Torrents lists every torrent in the daemon, ordered by name
+func (c *Client) Torrents(ctx context.Context) ([]Torrent, error) {
+	var torrents []Torrent
+	return torrents, c.do(ctx, http.MethodGet, "/api/v1/torrents", nil, &torrents)
+}
+
+// Add adds a torrent or magnet link, adding it again returns the existing torrent
+func (c *Client) Add(ctx context.Context, request AddRequest) (*Torrent, error) {
+	var torrent Torrent
+	return &torrent, c.do(ctx, http.MethodPost, "/api/v1/torrents", request, &torrent)
+}
+
+// Torrent returns the state and progress of a torrent
+func (c *Client) Torrent(ctx context.Context, infoHash string) (*Torrent, error) {
+	var torrent Torrent
+	return &torrent, c.do(ctx, http.MethodGet, torrentPath(infoHash, ""), nil, &torrent)
+}
+
+// Remove stops a torrent and drops it from the daemon, its files are kept
+func (c *Client) Remove(ctx context.Context, infoHash string) error {
+	return c.do(ctx, http.MethodDelete, torrentPath(infoHash, ""), nil, nil)
+}
+
+// Pause stops downloading a torrent, keeping the verified pieces
+func (c *Client) Pause(ctx context.Context, infoHash string) (*Torrent, error) {
+	var torrent Torrent
+	return &torrent, c.do(ctx, http.MethodPost, torrentPath(infoHash, "/pause"), nil, &torrent)
+}
+
+// Resume starts downloading a paused torrent
+func (c *Client) Resume(ctx context.Context, infoHash string) (*Torrent, error) {
+	var torrent Torrent
+	return &torrent, c.do(ctx, http.MethodPost, torrentPath(infoHash, "/resume"), nil, &torrent)
+}
+
+// Files lists the files of a torrent with their priorities
+func (c *Client) Files(ctx context.Context, infoHash string) ([]File, error) {
+	var files []File
+	return files, c.do(ctx, http.MethodGet, torrentPath(infoHash, "/files"), nil, &files)
+}
+
+// SetFilePriorities changes the priorities of some files and returns all of them
+func (c *Client) SetFilePriorities(ctx context.Context, infoHash string, priorities []FilePriority) ([]File, error) {
+	var files []File
+	return files, c.do(ctx, http.MethodPut, torrentPath(infoHash, "/files"), PriorityRequest{Files: priorities}, &files)
+}
+
+// Peers lists the peers a torrent is connected to
+func (c *Client) Peers(ctx context.Context, infoHash string) ([]Peer, error) {
+	var peers []Peer
+	return peers, c.do(ctx, http.MethodGet, torrentPath(infoHash, "/peers"), nil, &peers)
+}
+
+func torrentPath(infoHash, suffix string) string {
+	return "/api/v1/torrents/" + url.PathEscape(infoHash) + suffix
+}
+
+// do sends a request with an optional JSON body and decodes the JSON response
+// into result unless it is nil
+func (c *Client) do(ctx context.Context, method, path string, body, result any) error {
+	var bodyReader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		bodyReader = bytes.NewReader(data)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bodyReader)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Bearer "+c.token)
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return fmt.Errorf("failed to reach daemon: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= http.StatusBadRequest {
+		var errorResponse ErrorResponse
+		if err := json.NewDecoder(response.Body).Decode(&errorResponse); err != nil || errorResponse.Error == "" {
+			errorResponse.Error = response.Status
+		}
+		return &Error{StatusCode: response.StatusCode, Message: errorResponse.Error}
+	}
+
+	if result == nil || response.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err := json.NewDecoder(response.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,296 @@
+package api
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/codecrafters-io/bittorrent-starter-go/client"
+	"github.com/codecrafters-io/bittorrent-starter-go/metainfo"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// maxRequestSize bounds request bodies, which hold at most a .torrent file
+const maxRequestSize = 16 << 20
+
+// statusError is an error answered with a specific HTTP status
+type statusError struct {
+	status int
+	err    error
+}
+
+func (e *statusError) Error() string {
+	return e.err.Error()
+}
+
+func (e *statusError) Unwrap() error {
+	return e.err
+}
+
+func badRequest(err error) error {
+	return &statusError{status: http.StatusBadRequest, err: err}
+}
+
+// handlerFunc answers a request with a value encoded as JSON, nil for no content
+type handlerFunc func(r *http.Request) (any, error)
+
+// Server is an http.Handler controlling a client.Client
+type Server struct {
+	client *client.Client
+	token  string
+	mux    *http.ServeMux
+	logger *slog.Logger
+}
+
+// NewServer creates the API for a client, requests must carry the token
+func NewServer(c *client.Client, token string) (*Server, error) {
+	transmission, err := newTransmissionHandler(c)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		client: c,
+		token:  token,
+		mux:    http.NewServeMux(),
+		logger: slog.Default().With("subsystem", "api"),
+	}
+
+	s.handle("GET /api/v1/stats", s.stats)
+	s.handle("GET /api/v1/torrents", s.listTorrents)
+	s.handle("POST /api/v1/torrents", s.addTorrent)
+	s.handle("GET /api/v1/torrents/{hash}", s.getTorrent)
+	s.handle("DELETE /api/v1/torrents/{hash}", s.removeTorrent)
+	s.handle("POST /api/v1/torrents/{hash}/pause", s.pauseTorrent)
+	s.handle("POST /api/v1/torrents/{hash}/resume", s.resumeTorrent)
+	s.handle("GET /api/v1/torrents/{hash}/files", s.getFiles)
+	s.handle("PUT /api/v1/torrents/{hash}/files", s.setFilePriorities)
+	s.handle("GET /api/v1/torrents/{hash}/peers", s.getPeers)
+	s.mux.Handle(TransmissionPath, transmission)
+	return s, nil
+}
+
+// ServeHTTP checks the token and dispatches the request
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		w.Header().Add("WWW-Authenticate", `Bearer realm="flowstream"`)
+		w.Header().Add("WWW-Authenticate", `Basic realm="flowstream"`)
+		writeJSON(w, http.StatusUnauthorized, ErrorResponse{Error: "missing or invalid token"})
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// authorized checks the token, sent as a bearer token or, for Transmission
+// clients, as the password of HTTP basic authentication with any user name
+func (s *Server) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		_, token, ok = r.BasicAuth()
+	}
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+// handle registers a handler, encoding its result or error as JSON
+func (s *Server) handle(pattern string, handler handlerFunc) {
+	s.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
+
+		result, err := handler(r)
+		if err != nil {
+			status := http.StatusInternalServerError
+			var statusErr *statusError
+			if errors.As(err, &statusErr) {
+				status = statusErr.status
+			}
+			if status >= http.StatusInternalServerError {
+				s.logger.Error("request failed", "method", r.Method, "path", r.URL.Path, "err", err)
+			}
+			writeJSON(w, status, ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		if result == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// decodeBody reads a JSON request body
+func decodeBody(r *http.Request, v any) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return badRequest(fmt.Errorf("invalid request body: %w", err))
+	}
+	return nil
+}
+
+// torrent looks up the torrent named by the request path
+func (s *Server) torrent(r *http.Request) (*client.Torrent, error) {
+	hash := r.PathValue("hash")
+	t, ok := s.client.Torrent(hash)
+	if !ok {
+		return nil, &statusError{status: http.StatusNotFound, err: fmt.Errorf("no torrent with info hash %q", hash)}
+	}
+	return t, nil
+}
+
+func (s *Server) stats(r *http.Request) (any, error) {
+	stats := Stats{
+		DownloadRate: s.client.DownloadRate(),
+		ListenPort:   s.client.ListenPort(),
+	}
+	for _, t := range s.client.Torrents() {
+		torrentStats := t.Stats()
+		stats.Torrents++
+		stats.Peers += torrentStats.Peers
+		stats.BytesDownloaded += torrentStats.BytesDownloaded
+	}
+	return stats, nil
+}
+
+func (s *Server) listTorrents(r *http.Request) (any, error) {
+	torrents := []Torrent{}
+	for _, t := range s.client.Torrents() {
+		torrents = append(torrents, newTorrent(t))
+	}
+	slices.SortFunc(torrents, func(a, b Torrent) int {
+		if c := strings.Compare(a.Name, b.Name); c != 0 {
+			return c
+		}
+		return strings.Compare(a.InfoHash, b.InfoHash)
+	})
+	return torrents, nil
+}
+
+func (s *Server) addTorrent(r *http.Request) (any, error) {
+	var request AddRequest
+	if err := decodeBody(r, &request); err != nil {
+		return nil, err
+	}
+
+	var t *client.Torrent
+	switch {
+	case len(request.Torrent) > 0 && request.Magnet != "":
+		return nil, badRequest(errors.New("give either a torrent or a magnet link, not both"))
+	case len(request.Torrent) > 0:
+		torrent, err := metainfo.Read(bytes.NewReader(request.Torrent))
+		if err != nil {
+			return nil, badRequest(fmt.Errorf("invalid torrent: %w", err))
+		}
+		if t, err = s.client.AddTorrent(torrent); err != nil {
+			return nil, badRequest(err)
+		}
+	case request.Magnet != "":
+		var err error
+		if t, err = s.client.AddMagnet(request.Magnet); err != nil {
+			return nil, badRequest(err)
+		}
+	default:
+		return nil, badRequest(errors.New("missing torrent or magnet link"))
+	}
+
+	if !request.Paused {
+		if err := t.Start(); err != nil {
+			return nil, err
+		}
+	}
+	return newTorrent(t), nil
+}
+
+func (s *Server) getTorrent(r *http.Request) (any, error) {
+	t, err := s.torrent(r)
+	if err != nil {
+		return nil, err
+	}
+	return newTorrent(t), nil
+}
+
+func (s *Server) removeTorrent(r *http.Request) (any, error) {
+	t, err := s.torrent(r)
+	if err != nil {
+		return nil, err
+	}
+	return nil, t.Remove()
+}
+
+func (s *Server) pauseTorrent(r *http.Request) (any, error) {
+	t, err := s.torrent(r)
+	if err != nil {
+		return nil, err
+	}
+	t.Pause()
+	return newTorrent(t), nil
+}
+
+func (s *Server) resumeTorrent(r *http.Request) (any, error) {
+	t, err := s.torrent(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.Start(); err != nil {
+		return nil, &statusError{status: http.StatusConflict, err: err}
+	}
+	return newTorrent(t), nil
+}
+
+func (s *Server) getFiles(r *http.Request) (any, error) {
+	t, err := s.torrent(r)
+	if err != nil {
+		return nil, err
+	}
+	return newFiles(t), nil
+}
+
+func (s *Server) setFilePriorities(r *http.Request) (any, error) {
+	t, err := s.torrent(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var request PriorityRequest
+	if err := decodeBody(r, &request); err != nil {
+		return nil, err
+	}
+
+	// Check every change before applying any
+	priorities := make([]client.FilePriority, len(request.Files))
+	numFiles := len(t.Files())
+	if numFiles == 0 {
+		return nil, &statusError{status: http.StatusConflict, err: errors.New("metadata not received yet")}
+	}
+	for i, file := range request.Files {
+		if file.Index < 0 || file.Index >= numFiles {
+			return nil, badRequest(fmt.Errorf("file index %d out of range (torrent has %d files)", file.Index, numFiles))
+		}
+		if priorities[i], err = client.ParseFilePriority(file.Priority); err != nil {
+			return nil, badRequest(err)
+		}
+	}
+
+	for i, file := range request.Files {
+		if err := t.SetFilePriority(file.Index, priorities[i]); err != nil {
+			return nil, err
+		}
+	}
+	return newFiles(t), nil
+}
+
+func (s *Server) getPeers(r *http.Request) (any, error) {
+	t, err := s.torrent(r)
+	if err != nil {
+		return nil, err
+	}
+	return newPeers(t), nil
+}
@@ -0,0 +1,232 @@
+package api
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/codecrafters-io/bittorrent-starter-go/client"
+	"github.com/codecrafters-io/bittorrent-starter-go/metainfo"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testToken = "secret-token"
+
+// newTestServer serves a client saving into a temporary directory
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	c, err := client.NewClientBuilder().WithDataDir(t.TempDir()).Build()
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+
+	s, err := NewServer(c, testToken)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	return s
+}
+
+// testTorrent encodes a small torrent whose tracker refuses connections
+func testTorrent(t *testing.T) ([]byte, string) {
+	t.Helper()
+	torrent := &metainfo.Torrent{
+		Announce: "http://127.0.0.1:1/announce",
+		Info: metainfo.Info{
+			Name:        "test.bin",
+			Length:      2 * 16384,
+			PieceLength: 16384,
+			Pieces:      strings.Repeat("\x00", 2*20),
+		},
+	}
+	hash, err := torrent.Info.Hash()
+	if err != nil {
+		t.Fatalf("failed to hash torrent: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "test.torrent")
+	if err := metainfo.WriteFile(path, torrent); err != nil {
+		t.Fatalf("failed to write torrent: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read torrent: %v", err)
+	}
+	return data, hex.EncodeToString(hash)
+}
+
+// request sends a request with the bearer token and decodes a JSON response into v
+func request(t *testing.T, s *Server, method, path string, body any, v any) int {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("failed to encode request: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	r := httptest.NewRequest(method, path, reader)
+	r.Header.Set("Authorization", "Bearer "+testToken)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+
+	if v != nil && w.Header().Get("Content-Type") == "application/json" {
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatalf("%s %s: invalid response %q: %v", method, path, w.Body.String(), err)
+		}
+	}
+	return w.Code
+}
+
+func TestAuthorization(t *testing.T) {
+	s := newTestServer(t)
+
+	tests := []struct {
+		name       string
+		authorize  func(r *http.Request)
+		wantStatus int
+	}{
+		{"none", func(r *http.Request) {}, http.StatusUnauthorized},
+		{"bearer", func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+testToken) }, http.StatusOK},
+		{"wrong bearer", func(r *http.Request) { r.Header.Set("Authorization", "Bearer nope") }, http.StatusUnauthorized},
+		{"empty bearer", func(r *http.Request) { r.Header.Set("Authorization", "Bearer ") }, http.StatusUnauthorized},
+		{"basic", func(r *http.Request) { r.SetBasicAuth("anyone", testToken) }, http.StatusOK},
+		{"wrong basic", func(r *http.Request) { r.SetBasicAuth("anyone", "nope") }, http.StatusUnauthorized},
+		{"token as user name", func(r *http.Request) { r.SetBasicAuth(testToken, "") }, http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/torrents", nil)
+			test.authorize(r)
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, r)
+
+			if w.Code != test.wantStatus {
+				t.Fatalf("status %d, want %d", w.Code, test.wantStatus)
+			}
+			if w.Code == http.StatusUnauthorized && len(w.Header().Values("WWW-Authenticate")) == 0 {
+				t.Errorf("401 without a WWW-Authenticate challenge")
+			}
+		})
+	}
+}
+
+func TestTransmissionAuthorization(t *testing.T) {
+	s := newTestServer(t)
+
+	r := httptest.NewRequest(http.MethodPost, TransmissionPath, strings.NewReader(`{"method":"session-get"}`))
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status without credentials %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	// Authorized requests get to the session ID handshake
+	r = httptest.NewRequest(http.MethodPost, TransmissionPath, strings.NewReader(`{"method":"session-get"}`))
+	r.SetBasicAuth("transmission", testToken)
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("status with basic auth %d, want %d", w.Code, http.StatusConflict)
+	}
+	if w.Header().Get(TransmissionSessionHeader) == "" {
+		t.Errorf("409 without a session ID")
+	}
+}
+
+func TestAddPauseRemove(t *testing.T) {
+	s := newTestServer(t)
+	data, infoHash := testTorrent(t)
+
+	var added Torrent
+	if status := request(t, s, http.MethodPost, "/api/v1/torrents", AddRequest{Torrent: data, Paused: true}, &added); status != http.StatusOK {
+		t.Fatalf("add status %d, want %d", status, http.StatusOK)
+	}
+	if added.InfoHash != infoHash || added.Name != "test.bin" || added.State != "paused" {
+		t.Fatalf("added %+v, want paused test.bin with info hash %s", added, infoHash)
+	}
+
+	var torrents []Torrent
+	request(t, s, http.MethodGet, "/api/v1/torrents", nil, &torrents)
+	if len(torrents) != 1 || torrents[0].InfoHash != infoHash {
+		t.Fatalf("listed %+v, want the added torrent", torrents)
+	}
+
+	var resumed Torrent
+	if status := request(t, s, http.MethodPost, "/api/v1/torrents/"+infoHash+"/resume", nil, &resumed); status != http.StatusOK {
+		t.Fatalf("resume status %d, want %d", status, http.StatusOK)
+	}
+	if resumed.State != "downloading" {
+		t.Errorf("resumed state %q, want downloading", resumed.State)
+	}
+
+	var paused Torrent
+	if status := request(t, s, http.MethodPost, "/api/v1/torrents/"+infoHash+"/pause", nil, &paused); status != http.StatusOK {
+		t.Fatalf("pause status %d, want %d", status, http.StatusOK)
+	}
+	if paused.State != "paused" {
+		t.Errorf("paused state %q, want paused", paused.State)
+	}
+
+	if status := request(t, s, http.MethodDelete, "/api/v1/torrents/"+infoHash, nil, nil); status != http.StatusNoContent {
+		t.Fatalf("remove status %d, want %d", status, http.StatusNoContent)
+	}
+	if status := request(t, s, http.MethodGet, "/api/v1/torrents/"+infoHash, nil, nil); status != http.StatusNotFound {
+		t.Fatalf("status after removal %d, want %d", status, http.StatusNotFound)
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	s := newTestServer(t)
+	data, infoHash := testTorrent(t)
+	request(t, s, http.MethodPost, "/api/v1/torrents", AddRequest{Torrent: data, Paused: true}, nil)
+
+	magnetHash := strings.Repeat("12", 20)
+	magnetLink := "magnet:?xt=urn:btih:" + magnetHash + "&tr=http%3A%2F%2F127.0.0.1%3A1%2Fannounce"
+	request(t, s, http.MethodPost, "/api/v1/torrents", AddRequest{Magnet: magnetLink, Paused: true}, nil)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       any
+		wantStatus int
+	}{
+		{"missing torrent", http.MethodPost, "/api/v1/torrents", AddRequest{}, http.StatusBadRequest},
+		{"torrent and magnet", http.MethodPost, "/api/v1/torrents", AddRequest{Torrent: data, Magnet: magnetLink}, http.StatusBadRequest},
+		{"invalid torrent", http.MethodPost, "/api/v1/torrents", AddRequest{Torrent: []byte("not a torrent")}, http.StatusBadRequest},
+		{"zero piece length", http.MethodPost, "/api/v1/torrents", AddRequest{Torrent: []byte("d4:infod6:lengthi5e4:name4:test12:piece lengthi0e6:pieces0:ee")}, http.StatusBadRequest},
+		{"invalid magnet", http.MethodPost, "/api/v1/torrents", AddRequest{Magnet: "magnet:?xt=urn:btih:nope"}, http.StatusBadRequest},
+		{"short info hash", http.MethodPost, "/api/v1/torrents", AddRequest{Magnet: "magnet:?xt=urn:btih:abcd&tr=http%3A%2F%2F127.0.0.1%3A1%2Fannounce"}, http.StatusBadRequest},
+		{"invalid body", http.MethodPost, "/api/v1/torrents", "not an object", http.StatusBadRequest},
+		{"unknown torrent", http.MethodGet, "/api/v1/torrents/" + strings.Repeat("00", 20), nil, http.StatusNotFound},
+		{"pause unknown torrent", http.MethodPost, "/api/v1/torrents/" + strings.Repeat("00", 20) + "/pause", nil, http.StatusNotFound},
+		{"file index out of range", http.MethodPut, "/api/v1/torrents/" + infoHash + "/files",
+			PriorityRequest{Files: []FilePriority{{Index: 5, Priority: "high"}}}, http.StatusBadRequest},
+		{"unknown priority", http.MethodPut, "/api/v1/torrents/" + infoHash + "/files",
+			PriorityRequest{Files: []FilePriority{{Index: 0, Priority: "urgent"}}}, http.StatusBadRequest},
+		{"files before metadata", http.MethodPut, "/api/v1/torrents/" + magnetHash + "/files",
+			PriorityRequest{Files: []FilePriority{{Index: 0, Priority: "high"}}}, http.StatusConflict},
+		{"method not allowed", http.MethodPatch, "/api/v1/torrents", nil, http.StatusMethodNotAllowed},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var response ErrorResponse
+			status := request(t, s, test.method, test.path, test.body, &response)
+			if status != test.wantStatus {
+				t.Fatalf("status %d, want %d", status, test.wantStatus)
+			}
+			if test.wantStatus != http.StatusMethodNotAllowed && response.Error == "" {
+				t.Errorf("error response without a message")
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadOrCreateToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config", "token")
+
+	token, err := LoadOrCreateToken(path)
+	if err != nil {
+		t.Fatalf("failed to create token: %v", err)
+	}
+	if len(token) != 2*tokenLength {
+		t.Errorf("token %q has %d characters, want %d", token, len(token), 2*tokenLength)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("token was not saved: %v", err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("token file mode %o, want 600", mode)
+	}
+
+	loaded, err := LoadOrCreateToken(path)
+	if err != nil {
+		t.Fatalf("failed to load token: %v", err)
+	}
+	if loaded != token {
+		t.Errorf("loaded token %q, want the saved %q", loaded, token)
+	}
+}
+
+func TestReadTokenEmpty(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte(" \n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadToken(path); err == nil {
+		t.Errorf("empty token file was accepted")
+	}
+	if _, err := LoadOrCreateToken(path); err == nil {
+		t.Errorf("empty token file was replaced instead of reported")
+	}
+}
@@ -0,0 +1,607 @@
+package api
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/codecrafters-io/bittorrent-starter-go/client"
+	"github.com/codecrafters-io/bittorrent-starter-go/magnet"
+	"github.com/codecrafters-io/bittorrent-starter-go/metainfo"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// TransmissionPath is where the Transmission compatible RPC endpoint is served
+	TransmissionPath = "/transmission/rpc"
+	// TransmissionSessionHeader carries the session ID guarding against CSRF
+	TransmissionSessionHeader = "X-Transmission-Session-Id"
+
+	transmissionRPCVersion    = 15
+	transmissionRPCMinVersion = 14
+)
+
+// Torrent status codes of the Transmission RPC protocol. Completed torrents
+// are stopped and finished, as we don't seed
+const (
+	transmissionStopped     = 0
+	transmissionDownloading = 4
+)
+
+// transmissionLocalError is the error code for torrents that failed on our side
+const transmissionLocalError = 3
+
+// errDuplicate is returned when adding a torrent the client already has
+var errDuplicate = errors.New("duplicate torrent")
+
+// errTorrentTooLarge is returned for a .torrent file over maxRequestSize
+var errTorrentTooLarge = fmt.Errorf("torrent too large, the limit is %d bytes", maxRequestSize)
+
+// torrentFetchClient downloads .torrent files added by URL
+var torrentFetchClient = &http.Client{Timeout: 30 * time.Second}
+
+// transmissionRequest is the body of every Transmission RPC call
+type transmissionRequest struct {
+	Method    string          `json:"method"`
+	Arguments json.RawMessage `json:"arguments"`
+	Tag       any             `json:"tag,omitempty"`
+}
+
+// transmissionResponse answers a call, Result is "success" or an error message
+type transmissionResponse struct {
+	Result    string `json:"result"`
+	Arguments any    `json:"arguments"`
+	Tag       any    `json:"tag,omitempty"`
+}
+
+type transmissionAddArguments struct {
+	Filename    string `json:"filename"` // Magnet link, URL or path of a .torrent file
+	Metainfo    string `json:"metainfo"` // Base64 encoded .torrent file
+	Paused      bool   `json:"paused"`
+	DownloadDir string `json:"download-dir"` // Only the data directory is supported
+}
+
+type transmissionTorrentArguments struct {
+	IDs             any      `json:"ids"` // Absent for all torrents
+	Fields          []string `json:"fields"`
+	DeleteLocalData bool     `json:"delete-local-data"`
+}
+
+// transmissionHandler implements the subset of the Transmission RPC protocol
+// that remotes need to add, list, start, stop and remove torrents
+type transmissionHandler struct {
+	client    *client.Client
+	sessionID string
+
+	mu     sync.Mutex
+	ids    map[string]int // Info hashes to the numeric IDs the protocol uses
+	nextID int
+}
+
+func newTransmissionHandler(c *client.Client) (*transmissionHandler, error) {
+	random := make([]byte, 24)
+	if _, err := rand.Read(random); err != nil {
+		return nil, fmt.Errorf("failed to generate session id: %w", err)
+	}
+	return &transmissionHandler{
+		client:    c,
+		sessionID: hex.EncodeToString(random),
+		ids:       make(map[string]int),
+		nextID:    1,
+	}, nil
+}
+
+// ServeHTTP answers a call once the request carries the current session ID,
+// which clients learn from the 409 response to a request without it
+func (h *transmissionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(TransmissionSessionHeader, h.sessionID)
+	if r.Header.Get(TransmissionSessionHeader) != h.sessionID {
+		http.Error(w, "missing or outdated "+TransmissionSessionHeader, http.StatusConflict)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request transmissionRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(&request); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	response := transmissionResponse{Result: "success", Arguments: struct{}{}, Tag: request.Tag}
+	arguments, err := h.call(r, request.Method, request.Arguments)
+	if err != nil {
+		response.Result = err.Error()
+	} else if arguments != nil {
+		response.Arguments = arguments
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (h *transmissionHandler) call(r *http.Request, method string, rawArguments json.RawMessage) (any, error) {
+	var arguments transmissionTorrentArguments
+	if method != "torrent-add" && len(rawArguments) > 0 {
+		if err := json.Unmarshal(rawArguments, &arguments); err != nil {
+			return nil, fmt.Errorf("invalid arguments: %w", err)
+		}
+	}
+
+	switch method {
+	case "session-get":
+		return h.sessionGet(), nil
+	case "session-stats":
+		return h.sessionStats(), nil
+	case "torrent-add":
+		var addArguments transmissionAddArguments
+		if err := json.Unmarshal(rawArguments, &addArguments); err != nil {
+			return nil, fmt.Errorf("invalid arguments: %w", err)
+		}
+		return h.torrentAdd(r, addArguments)
+	case "torrent-get":
+		return h.torrentGet(arguments)
+	case "torrent-start", "torrent-start-now":
+		return nil, h.forEach(arguments.IDs, (*client.Torrent).Start)
+	case "torrent-stop":
+		return nil, h.forEach(arguments.IDs, func(t *client.Torrent) error {
+			t.Pause()
+			return nil
+		})
+	case "torrent-remove":
+		if arguments.DeleteLocalData {
+			return nil, errors.New("deleting local data is not supported")
+		}
+		return nil, h.forEach(arguments.IDs, (*client.Torrent).Remove)
+	}
+	return nil, errors.New("method name not recognized")
+}
+
+func (h *transmissionHandler) sessionGet() map[string]any {
+	limit := h.client.DownloadRate()
+	return map[string]any{
+		"version":                  "3.00 (FlowStream)",
+		"rpc-version":              transmissionRPCVersion,
+		"rpc-version-minimum":      transmissionRPCMinVersion,
+		"session-id":               h.sessionID,
+		"download-dir":             h.client.DataDir(),
+		"peer-port":                h.client.ListenPort(),
+		"speed-limit-down":         limit / 1000, // Transmission counts in kB/s
+		"speed-limit-down-enabled": limit > 0,
+		"speed-limit-up":           0,
+		"speed-limit-up-enabled":   false,
+		"dht-enabled":              false,
+		"pex-enabled":              false,
+	}
+}
+
+func (h *transmissionHandler) sessionStats() map[string]any {
+	var active, paused int
+	var downloadSpeed int64
+	torrents := h.client.Torrents()
+	for _, t := range torrents {
+		stats := t.Stats()
+		downloadSpeed += stats.DownloadRate
+		if stats.State == client.StateDownloading || stats.State == client.StateFetchingMetadata {
+			active++
+		} else {
+			paused++
+		}
+	}
+	return map[string]any{
+		"torrentCount":       len(torrents),
+		"activeTorrentCount": active,
+		"pausedTorrentCount": paused,
+		"downloadSpeed":      downloadSpeed,
+		"uploadSpeed":        0,
+	}
+}
+
+func (h *transmissionHandler) torrentAdd(r *http.Request, arguments transmissionAddArguments) (any, error) {
+	if arguments.DownloadDir != "" && !sameDir(arguments.DownloadDir, h.client.DataDir()) {
+		return nil, fmt.Errorf("download-dir %s is not supported, torrents are saved to %s", arguments.DownloadDir, h.client.DataDir())
+	}
+
+	var t *client.Torrent
+	var infoHash string
+	var err error
+
+	switch {
+	case arguments.Metainfo != "":
+		data, decodeErr := base64.StdEncoding.DecodeString(arguments.Metainfo)
+		if decodeErr != nil {
+			return nil, fmt.Errorf("invalid metainfo: %w", decodeErr)
+		}
+		t, infoHash, err = h.addTorrentData(data)
+	case strings.HasPrefix(arguments.Filename, "magnet:"):
+		t, infoHash, err = h.addMagnet(arguments.Filename)
+	case arguments.Filename != "":
+		data, readErr := readTorrentSource(r, arguments.Filename)
+		if readErr != nil {
+			return nil, readErr
+		}
+		t, infoHash, err = h.addTorrentData(data)
+	default:
+		return nil, errors.New("no filename or metainfo specified")
+	}
+
+	if errors.Is(err, errDuplicate) {
+		t, _ = h.client.Torrent(infoHash)
+		return map[string]any{"torrent-duplicate": h.summary(t)}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !arguments.Paused {
+		if err := t.Start(); err != nil {
+			return nil, err
+		}
+	}
+	return map[string]any{"torrent-added": h.summary(t)}, nil
+}
+
+// sameDir reports whether two paths name the same directory once made absolute
+func sameDir(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+func (h *transmissionHandler) addTorrentData(data []byte) (*client.Torrent, string, error) {
+	torrent, err := metainfo.Read(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid torrent: %w", err)
+	}
+	hash, err := torrent.Info.Hash()
+	if err != nil {
+		return nil, "", err
+	}
+
+	infoHash := hex.EncodeToString(hash)
+	if _, ok := h.client.Torrent(infoHash); ok {
+		return nil, infoHash, errDuplicate
+	}
+	t, err := h.client.AddTorrent(torrent)
+	return t, infoHash, err
+}
+
+func (h *transmissionHandler) addMagnet(uri string) (*client.Torrent, string, error) {
+	link, err := magnet.Parse(uri)
+	if err != nil {
+		return nil, "", err
+	}
+	hash, err := link.InfoHashBytes()
+	if err != nil {
+		return nil, "", err
+	}
+
+	infoHash := hex.EncodeToString(hash)
+	if _, ok := h.client.Torrent(infoHash); ok {
+		return nil, infoHash, errDuplicate
+	}
+	t, err := h.client.AddMagnet(uri)
+	return t, infoHash, err
+}
+
+// readTorrentSource reads a .torrent file from a URL or a path on this host
+func readTorrentSource(r *http.Request, source string) ([]byte, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		file, err := os.Open(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read torrent: %w", err)
+		}
+		defer file.Close()
+		return readTorrentData(file)
+	}
+
+	request, err := http.NewRequestWithContext(r.Context(), http.MethodGet, source, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := torrentFetchClient.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch torrent: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch torrent: %s", response.Status)
+	}
+	return readTorrentData(response.Body)
+}
+
+// readTorrentData reads a whole .torrent file, refusing files over maxRequestSize
+func readTorrentData(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxRequestSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read torrent: %w", err)
+	}
+	if len(data) > maxRequestSize {
+		return nil, errTorrentTooLarge
+	}
+	return data, nil
+}
+
+func (h *transmissionHandler) torrentGet(arguments transmissionTorrentArguments) (any, error) {
+	torrents, err := h.selectTorrents(arguments.IDs)
+	if err != nil {
+		return nil, err
+	}
+
+	list := []map[string]any{}
+	for _, t := range torrents {
+		snapshot := h.snapshot(t)
+		fields := map[string]any{}
+		for _, name := range arguments.Fields {
+			if field, ok := transmissionFields[name]; ok {
+				fields[name] = field(snapshot)
+			}
+		}
+		list = append(list, fields)
+	}
+	return map[string]any{"torrents": list}, nil
+}
+
+// summary is how torrent-add describes the torrent it added
+func (h *transmissionHandler) summary(t *client.Torrent) map[string]any {
+	return map[string]any{"id": h.id(t), "name": t.Name(), "hashString": t.InfoHash()}
+}
+
+// id returns the numeric ID of a torrent, handing out the next one on first use
+func (h *transmissionHandler) id(t *client.Torrent) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	id, ok := h.ids[t.InfoHash()]
+	if !ok {
+		id = h.nextID
+		h.nextID++
+		h.ids[t.InfoHash()] = id
+	}
+	return id
+}
+
+// forEach applies an action to the selected torrents
+func (h *transmissionHandler) forEach(ids any, action func(t *client.Torrent) error) error {
+	torrents, err := h.selectTorrents(ids)
+	if err != nil {
+		return err
+	}
+	for _, t := range torrents {
+		if err := action(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// selectTorrents resolves the ids argument: absent for every torrent, or a
+// numeric ID, info hash or list of them. "recently-active" selects every torrent
+func (h *transmissionHandler) selectTorrents(ids any) ([]*client.Torrent, error) {
+	torrents := h.client.Torrents()
+	slices.SortFunc(torrents, func(a, b *client.Torrent) int {
+		return h.id(a) - h.id(b)
+	})
+	if ids == nil || ids == "recently-active" {
+		return torrents, nil
+	}
+
+	list, ok := ids.([]any)
+	if !ok {
+		list = []any{ids}
+	}
+
+	var selected []*client.Torrent
+	for _, id := range list {
+		index := slices.IndexFunc(torrents, func(t *client.Torrent) bool {
+			switch id := id.(type) {
+			case float64:
+				return float64(h.id(t)) == id
+			case string:
+				return strings.EqualFold(t.InfoHash(), id)
+			}
+			return false
+		})
+		if index >= 0 && !slices.Contains(selected, torrents[index]) {
+			selected = append(selected, torrents[index])
+		}
+	}
+	return selected, nil
+}
+
+// transmissionSnapshot is the state of a torrent the fields of torrent-get are read from
+type transmissionSnapshot struct {
+	id      int
+	torrent *client.Torrent
+	stats   client.TorrentStats
+	info    *metainfo.Info // Nil until a magnet link's metadata arrives
+	dataDir string
+}
+
+func (h *transmissionHandler) snapshot(t *client.Torrent) *transmissionSnapshot {
+	return &transmissionSnapshot{
+		id:      h.id(t),
+		torrent: t,
+		stats:   t.Stats(),
+		info:    t.Info(),
+		dataDir: h.client.DataDir(),
+	}
+}
+
+func (s *transmissionSnapshot) status() int {
+	switch s.stats.State {
+	case client.StateDownloading, client.StateFetchingMetadata:
+		return transmissionDownloading
+	}
+	return transmissionStopped
+}
+
+func (s *transmissionSnapshot) left() int64 {
+	return s.stats.BytesWanted - s.stats.BytesDone
+}
+
+func (s *transmissionSnapshot) percentDone() float64 {
+	if s.stats.BytesWanted == 0 {
+		return 0
+	}
+	return float64(s.stats.BytesDone) / float64(s.stats.BytesWanted)
+}
+
+// eta returns the seconds left at the current rate, -1 when unknown
+func (s *transmissionSnapshot) eta() int64 {
+	if s.stats.DownloadRate == 0 || s.info == nil {
+		return -1
+	}
+	return s.left() / s.stats.DownloadRate
+}
+
+func (s *transmissionSnapshot) files() []map[string]any {
+	files := []map[string]any{}
+	for _, file := range s.torrent.Files() {
+		name := file.Path
+		if s.info != nil && len(s.info.Files) > 0 {
+			name = s.info.Name + "/" + file.Path
+		}
+		files = append(files, map[string]any{"name": name, "length": file.Length, "bytesCompleted": file.BytesDone})
+	}
+	return files
+}
+
+func (s *transmissionSnapshot) fileStats() []map[string]any {
+	priorities := map[client.FilePriority]int{client.PriorityLow: -1, client.PriorityHigh: 1}
+
+	fileStats := []map[string]any{}
+	for _, file := range s.torrent.Files() {
+		fileStats = append(fileStats, map[string]any{
+			"bytesCompleted": file.BytesDone,
+			"wanted":         file.Priority != client.PrioritySkip,
+			"priority":       priorities[file.Priority],
+		})
+	}
+	return fileStats
+}
+
+func (s *transmissionSnapshot) peers() []map[string]any {
+	peers := []map[string]any{}
+	for _, peer := range s.torrent.Peers() {
+		host, port, _ := net.SplitHostPort(peer.Addr)
+		portNumber, _ := strconv.Atoi(port)
+		peers = append(peers, map[string]any{
+			"address":            host,
+			"port":               portNumber,
+			"clientName":         peer.Client,
+			"isIncoming":         peer.Incoming,
+			"clientIsChoked":     peer.Choked,
+			"clientIsInterested": true,
+			"isDownloadingFrom":  !peer.Choked,
+			"isUploadingTo":      false,
+			"peerIsChoked":       true,
+			"peerIsInterested":   false,
+			"rateToClient":       peer.DownloadRate,
+			"rateToPeer":         0,
+			"progress":           0,
+			"flagStr":            "",
+		})
+	}
+	return peers
+}
+
+func (s *transmissionSnapshot) peersSendingToUs() int {
+	sending := 0
+	for _, peer := range s.torrent.Peers() {
+		if !peer.Choked {
+			sending++
+		}
+	}
+	return sending
+}
+
+// transmissionFields are the torrent-get fields we can answer, others are left out
+var transmissionFields = map[string]func(s *transmissionSnapshot) any{
+	"id":                      func(s *transmissionSnapshot) any { return s.id },
+	"hashString":              func(s *transmissionSnapshot) any { return s.stats.InfoHash },
+	"name":                    func(s *transmissionSnapshot) any { return s.stats.Name },
+	"status":                  func(s *transmissionSnapshot) any { return s.status() },
+	"addedDate":               func(s *transmissionSnapshot) any { return s.torrent.Added().Unix() },
+	"downloadDir":             func(s *transmissionSnapshot) any { return s.dataDir },
+	"totalSize":               func(s *transmissionSnapshot) any { return infoLength(s.info) },
+	"sizeWhenDone":            func(s *transmissionSnapshot) any { return s.stats.BytesWanted },
+	"leftUntilDone":           func(s *transmissionSnapshot) any { return s.left() },
+	"haveValid":               func(s *transmissionSnapshot) any { return s.stats.BytesDone },
+	"haveUnchecked":           func(s *transmissionSnapshot) any { return 0 },
+	"percentDone":             func(s *transmissionSnapshot) any { return s.percentDone() },
+	"metadataPercentComplete": func(s *transmissionSnapshot) any { return boolToFloat(s.info != nil) },
+	"isFinished":              func(s *transmissionSnapshot) any { return s.stats.State == client.StateCompleted },
+	"isStalled":               func(s *transmissionSnapshot) any { return s.status() == transmissionDownloading && s.stats.Peers == 0 },
+	"downloadedEver":          func(s *transmissionSnapshot) any { return s.stats.BytesDownloaded },
+	"uploadedEver":            func(s *transmissionSnapshot) any { return 0 },
+	"uploadRatio":             func(s *transmissionSnapshot) any { return 0 },
+	"rateDownload":            func(s *transmissionSnapshot) any { return s.stats.DownloadRate },
+	"rateUpload":              func(s *transmissionSnapshot) any { return 0 },
+	"eta":                     func(s *transmissionSnapshot) any { return s.eta() },
+	"error":                   func(s *transmissionSnapshot) any { return errorCode(s.stats.Err) },
+	"errorString":             func(s *transmissionSnapshot) any { return errorString(s.stats.Err) },
+	"peersConnected":          func(s *transmissionSnapshot) any { return s.stats.Peers },
+	"peersSendingToUs":        func(s *transmissionSnapshot) any { return s.peersSendingToUs() },
+	"peersGettingFromUs":      func(s *transmissionSnapshot) any { return 0 },
+	"pieceCount":              func(s *transmissionSnapshot) any { return infoPieces(s.info) },
+	"pieceSize":               func(s *transmissionSnapshot) any { return infoPieceLength(s.info) },
+	"files":                   func(s *transmissionSnapshot) any { return s.files() },
+	"fileStats":               func(s *transmissionSnapshot) any { return s.fileStats() },
+	"peers":                   func(s *transmissionSnapshot) any { return s.peers() },
+}
+
+func infoLength(info *metainfo.Info) int {
+	if info == nil {
+		return 0
+	}
+	return info.TotalLength()
+}
+
+func infoPieces(info *metainfo.Info) int {
+	if info == nil {
+		return 0
+	}
+	return info.NumPieces()
+}
+
+func infoPieceLength(info *metainfo.Info) int {
+	if info == nil {
+		return 0
+	}
+	return info.PieceLength
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func errorCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	return transmissionLocalError
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
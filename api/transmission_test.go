@@ -0,0 +1,67 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadTorrentSourceLimit(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name string, size int64) string {
+		path := filepath.Join(dir, name)
+		file, err := os.Create(path)
+		if err != nil {
+			t.Fatalf("failed to create %s: %v", name, err)
+		}
+		defer file.Close()
+		if err := file.Truncate(size); err != nil {
+			t.Fatalf("failed to size %s: %v", name, err)
+		}
+		return path
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		size := int64(maxRequestSize)
+		if r.URL.Path == "/large.torrent" {
+			size++
+		}
+		io.Copy(w, io.LimitReader(zeros{}, size))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		source  string
+		wantErr error
+	}{
+		{"file at the limit", writeFile("limit.torrent", maxRequestSize), nil},
+		{"file over the limit", writeFile("large.torrent", maxRequestSize+1), errTorrentTooLarge},
+		{"url at the limit", server.URL + "/limit.torrent", nil},
+		{"url over the limit", server.URL + "/large.torrent", errTorrentTooLarge},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, TransmissionPath, nil)
+			data, err := readTorrentSource(r, test.source)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("error %v, want %v", err, test.wantErr)
+			}
+			if err == nil && len(data) != maxRequestSize {
+				t.Fatalf("read %d bytes, want %d", len(data), maxRequestSize)
+			}
+		})
+	}
+}
+
+// zeros is an endless reader of zero bytes
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
@@ -1,4 +1,5 @@
-package main
+// Package bencode decodes bencoded data into strings, ints, lists and maps
+package bencode
 
 import (
 	"fmt"
@@ -16,9 +17,6 @@ func Decode(bencodedString string, index *int) (interface{}, error) {
 	switch bencodedString[*index] {
 	case 'l':
 		*index += 1 // Move past 'l'
-		if bencodedString[len(bencodedString)-1] != 'e' {
-			return nil, fmt.Errorf("invalid list format")
-		}
 		return decodeList(bencodedString, index)
 	case 'i':
 		return decodeInteger(bencodedString, index)
@@ -45,18 +43,22 @@ func decodeString(bencodedString string, index *int) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("invalid length: %w", err)
 	}
+	if length < 0 {
+		return "", fmt.Errorf("invalid length %d", length)
+	}
 	contentStart := firstColonIndex + 1
-	contentEnd := contentStart + length
-	if contentEnd > len(bencodedString) {
+	// Compared against what is left so a huge length cannot overflow
+	if length > len(bencodedString)-contentStart {
 		return "", fmt.Errorf("specified length %d exceeds string length %d", length, len(bencodedString))
 	}
+	contentEnd := contentStart + length
 	*index = contentEnd // Move index past the current string
 	return bencodedString[contentStart:contentEnd], nil
 }
 
 // decodeInteger handles decoding of bencoded integers, now using an index.
 func decodeInteger(bencodedString string, index *int) (int, error) {
-	if bencodedString[*index] != 'i' || bencodedString[len(bencodedString)-1] != 'e' {
+	if bencodedString[*index] != 'i' {
 		return 0, fmt.Errorf("invalid integer format")
 	}
 	start := *index + 1
@@ -65,6 +67,9 @@ func decodeInteger(bencodedString string, index *int) (int, error) {
 	for end < len(bencodedString) && bencodedString[end] != 'e' {
 		end++
 	}
+	if end == len(bencodedString) {
+		return 0, fmt.Errorf("invalid integer format")
+	}
 
 	*index = end + 1 // Move past 'e'
 	return strconv.Atoi(bencodedString[start:end])
@@ -81,6 +86,9 @@ func decodeList(bencodedString string, index *int) ([]interface{}, error) {
 		}
 		list = append(list, element)
 	}
+	if *index >= len(bencodedString) {
+		return nil, fmt.Errorf("invalid list format")
+	}
 	*index += 1 // Move past 'e'
 	return list, nil
 }
@@ -101,6 +109,9 @@ func decodeDict(bencodedString string, index *int) (map[string]interface{}, erro
 		}
 		dict[key] = value
 	}
+	if *index >= len(bencodedString) {
+		return nil, fmt.Errorf("invalid dictionary format")
+	}
 
 	*index += 1 // Move past 'e'
 	return dict, nil
@@ -0,0 +1,57 @@
+package bencode
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		input string
+		want  interface{}
+	}{
+		{"5:hello", "hello"},
+		{"0:", ""},
+		{"i-42e", -42},
+		{"l5:helloi52ee", []interface{}{"hello", 52}},
+		{"d3:foo3:bar5:helloi52ee", map[string]interface{}{"foo": "bar", "hello": 52}},
+	}
+	for _, test := range tests {
+		index := 0
+		got, err := Decode(test.input, &index)
+		if err != nil {
+			t.Errorf("Decode(%q) failed: %v", test.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Decode(%q) = %#v, want %#v", test.input, got, test.want)
+		}
+		if index != len(test.input) {
+			t.Errorf("Decode(%q) stopped at %d, want %d", test.input, index, len(test.input))
+		}
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	tests := []string{
+		"-3:abc",
+		"d-3:ae",
+		"l-1:ae",
+		"9223372036854775807:a",
+		"99999999999999999999:a",
+		"5:hell",
+		"5:",
+		"5",
+		"i42",
+		"l5:hello",
+		"d3:foo",
+		"d3:foo3:bar",
+		"",
+	}
+	for _, input := range tests {
+		index := 0
+		if got, err := Decode(input, &index); err == nil {
+			t.Errorf("Decode(%q) = %#v, want an error", input, got)
+		}
+	}
+}
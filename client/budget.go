@@ -0,0 +1,57 @@
+package client
+
+import (
+	"context"
+	"errors"
+)
+
+// errNoConnectionSlots reports an incoming peer refused because the connection budget is spent
+var errNoConnectionSlots = errors.New("connection limit reached")
+
+// connectionBudget limits the peer connections open at once across every
+// torrent of a Client, a nil budget allows any number
+type connectionBudget struct {
+	slots chan struct{}
+}
+
+func newConnectionBudget(limit int) *connectionBudget {
+	if limit <= 0 {
+		return nil
+	}
+	return &connectionBudget{slots: make(chan struct{}, limit)}
+}
+
+// acquire waits for a free slot, failing once ctx is cancelled
+func (b *connectionBudget) acquire(ctx context.Context) bool {
+	if b == nil {
+		return ctx.Err() == nil
+	}
+
+	select {
+	case b.slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// tryAcquire takes a free slot without waiting
+func (b *connectionBudget) tryAcquire() bool {
+	if b == nil {
+		return true
+	}
+
+	select {
+	case b.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// release frees a slot taken by acquire or tryAcquire
+func (b *connectionBudget) release() {
+	if b != nil {
+		<-b.slots
+	}
+}
@@ -0,0 +1,741 @@
+package client
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/codecrafters-io/bittorrent-starter-go/magnet"
+	"github.com/codecrafters-io/bittorrent-starter-go/metainfo"
+	"github.com/codecrafters-io/bittorrent-starter-go/peerwire"
+	"github.com/codecrafters-io/bittorrent-starter-go/tracker"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMaxConnections is the number of peer connections a Client keeps open across all torrents
+	DefaultMaxConnections = 50
+
+	retryInterval          = 30 * time.Second // Wait before re-announcing when the tracker gives no interval
+	stoppedAnnounceTimeout = 5 * time.Second
+	unknownLeft            = 16384 // Bytes left reported before the metadata is known
+)
+
+var (
+	errClientClosed        = errors.New("client is closed")
+	errMetadataPending     = errors.New("metadata not received yet")
+	errMetadataUnavailable = errors.New("metadata unavailable") // No peer sent the metadata this time around
+)
+
+// ClientBuilder configures a Client
+type ClientBuilder struct {
+	config         Config
+	dataDir        string
+	listenAddr     string
+	maxConnections int
+	downloadRate   int
+}
+
+// NewClientBuilder starts a Client with the default config, saving into the
+// working directory and not listening for peers
+func NewClientBuilder() *ClientBuilder {
+	return &ClientBuilder{
+		config:         DefaultConfig(),
+		dataDir:        ".",
+		maxConnections: DefaultMaxConnections,
+	}
+}
+
+// WithConfig sets the identity, encryption policy and timeouts, a missing identity is generated
+func (b *ClientBuilder) WithConfig(config Config) *ClientBuilder {
+	b.config = config
+	return b
+}
+
+// WithDataDir sets the directory torrents are saved into, each under its own name
+func (b *ClientBuilder) WithDataDir(dir string) *ClientBuilder {
+	b.dataDir = dir
+	return b
+}
+
+// WithListenAddr accepts incoming peers on a TCP and uTP address such as ":6881"
+func (b *ClientBuilder) WithListenAddr(addr string) *ClientBuilder {
+	b.listenAddr = addr
+	return b
+}
+
+// WithMaxConnections limits the peer connections open across all torrents, zero means no limit
+func (b *ClientBuilder) WithMaxConnections(n int) *ClientBuilder {
+	b.maxConnections = n
+	return b
+}
+
+// WithDownloadRate limits the download rate across all torrents, zero means no limit
+func (b *ClientBuilder) WithDownloadRate(bytesPerSecond int) *ClientBuilder {
+	b.downloadRate = bytesPerSecond
+	return b
+}
+
+// Build creates the Client and starts listening for peers
+func (b *ClientBuilder) Build() (*Client, error) {
+	config := b.config
+	if config.Identity == nil {
+		identity, err := NewIdentity(peerwire.DefaultPeerIDPrefix)
+		if err != nil {
+			return nil, err
+		}
+		config.Identity = identity
+	}
+	if config.Limiter == nil {
+		config.Limiter = peerwire.NewRateLimiter(b.downloadRate)
+	}
+	if config.Events == nil {
+		config.Events = NewEvents()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Client{
+		config:   config,
+		dataDir:  b.dataDir,
+		port:     peerwire.DefaultPort,
+		budget:   newConnectionBudget(b.maxConnections),
+		ctx:      ctx,
+		cancel:   cancel,
+		torrents: make(map[string]*Torrent),
+	}
+
+	if b.listenAddr != "" {
+		listener, err := peerwire.Listen(b.listenAddr)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		c.listener = listener
+		c.port = listener.Port()
+		c.config.ListenPort = c.port
+		go c.acceptPeers()
+	}
+	return c, nil
+}
+
+// Client runs any number of torrents sharing one identity, listener,
+// connection budget and download rate limit
+type Client struct {
+	config   Config
+	dataDir  string
+	port     int // Announced to trackers
+	budget   *connectionBudget
+	listener *peerwire.Listener
+
+	ctx    context.Context // Cancelled by Close
+	cancel context.CancelFunc
+
+	mu       sync.Mutex
+	torrents map[string]*Torrent // Keyed by hex encoded info hash
+	closed   bool
+}
+
+// AddTorrentFile adds the torrent in a .torrent file, paused
+func (c *Client) AddTorrentFile(path string) (*Torrent, error) {
+	torrent, err := metainfo.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return c.AddTorrent(torrent)
+}
+
+// AddTorrent adds a parsed torrent, paused. Adding a torrent twice returns the first handle
+func (c *Client) AddTorrent(torrent *metainfo.Torrent) (*Torrent, error) {
+	infoHash, err := torrent.Info.Hash()
+	if err != nil {
+		return nil, err
+	}
+
+	trackers := []string{}
+	if torrent.Announce != "" {
+		trackers = append(trackers, torrent.Announce)
+	}
+	for _, tier := range torrent.AnnounceList {
+		for _, announceURL := range tier {
+			if !slices.Contains(trackers, announceURL) {
+				trackers = append(trackers, announceURL)
+			}
+		}
+	}
+
+	info := torrent.Info
+	t := newTorrent(c, infoHash, info.Name, trackers, nil)
+	if _, err := t.createDownload(&info); err != nil {
+		return nil, err
+	}
+
+	added, err := c.add(t)
+	if err != nil || added != t {
+		t.download.Close()
+	}
+	return added, err
+}
+
+// AddMagnet adds a torrent from a magnet link, paused. Its metadata is fetched
+// from peers once started and its so= file selection is honoured
+func (c *Client) AddMagnet(uri string) (*Torrent, error) {
+	link, err := magnet.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	infoHash, err := link.InfoHashBytes()
+	if err != nil {
+		return nil, err
+	}
+	if len(link.Trackers) == 0 {
+		return nil, fmt.Errorf("magnet link has no trackers")
+	}
+
+	var selection *FileSelection
+	if len(link.SelectOnly) > 0 {
+		selection = &FileSelection{Indices: link.SelectOnly}
+	}
+	return c.add(newTorrent(c, infoHash, link.Name, link.Trackers, selection))
+}
+
+func (c *Client) add(t *Torrent) (*Torrent, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil, errClientClosed
+	}
+	key := hex.EncodeToString(t.infoHash)
+	if existing, ok := c.torrents[key]; ok {
+		return existing, nil
+	}
+	c.torrents[key] = t
+	return t, nil
+}
+
+// Torrents returns every torrent in the client, in no particular order
+func (c *Client) Torrents() []*Torrent {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	torrents := make([]*Torrent, 0, len(c.torrents))
+	for _, t := range c.torrents {
+		torrents = append(torrents, t)
+	}
+	return torrents
+}
+
+// Torrent looks up a torrent by its hex encoded info hash
+func (c *Client) Torrent(infoHash string) (*Torrent, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t, ok := c.torrents[strings.ToLower(infoHash)]
+	return t, ok
+}
+
+// SetDownloadRate changes the download limit across all torrents, zero means no limit
+func (c *Client) SetDownloadRate(bytesPerSecond int) {
+	c.config.Limiter.SetRate(bytesPerSecond)
+}
+
+// DownloadRate returns the download limit across all torrents, zero means no limit
+func (c *Client) DownloadRate() int {
+	return c.config.Limiter.Rate()
+}
+
+// Events returns the stream of events from every torrent in the client
+func (c *Client) Events() *Events {
+	return c.config.Events
+}
+
+// DataDir returns the directory torrents are saved into
+func (c *Client) DataDir() string {
+	return c.dataDir
+}
+
+// ListenPort returns the port announced to trackers
+func (c *Client) ListenPort() int {
+	return c.port
+}
+
+// Close stops every torrent, announcing that we've stopped, releases their
+// files and ends the event stream
+func (c *Client) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	torrents := c.torrents
+	c.torrents = make(map[string]*Torrent)
+	c.mu.Unlock()
+
+	var errs []error
+	if c.listener != nil {
+		errs = append(errs, c.listener.Close())
+	}
+	for _, t := range torrents {
+		errs = append(errs, t.close())
+	}
+	c.cancel()
+	c.config.Events.Close()
+	return errors.Join(errs...)
+}
+
+func (c *Client) remove(t *Torrent) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.torrents, hex.EncodeToString(t.infoHash))
+}
+
+// acceptPeers hands incoming connections to the torrent they handshake for
+func (c *Client) acceptPeers() {
+	for {
+		conn, err := c.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			var infoHashes [][]byte
+			for _, t := range c.Torrents() {
+				infoHashes = append(infoHashes, t.infoHash)
+			}
+
+			peerConn, err := peerwire.AcceptPeerConnection(c.ctx, conn, infoHashes, c.config.PeerConfig())
+			if err != nil {
+				c.config.logger("peer").Debug("refused incoming peer", "peer", conn.RemoteAddr().String(), "err", err)
+				return
+			}
+
+			t, ok := c.Torrent(hex.EncodeToString(peerConn.InfoHash))
+			if !ok || t.addConn(peerConn) != nil {
+				peerConn.Conn.Close()
+			}
+		}()
+	}
+}
+
+// TorrentState is the stage a torrent in a Client has reached
+type TorrentState int
+
+const (
+	StatePaused TorrentState = iota
+	StateFetchingMetadata
+	StateDownloading
+	StateCompleted
+	StateFailed
+)
+
+func (s TorrentState) String() string {
+	switch s {
+	case StatePaused:
+		return "paused"
+	case StateFetchingMetadata:
+		return "fetching metadata"
+	case StateDownloading:
+		return "downloading"
+	case StateCompleted:
+		return "completed"
+	case StateFailed:
+		return "failed"
+	}
+	return fmt.Sprintf("TorrentState(%d)", int(s))
+}
+
+// TorrentStats is a snapshot of a torrent in a Client
+type TorrentStats struct {
+	DownloadStats
+	Name     string
+	InfoHash string // Hex encoded
+	State    TorrentState
+	Err      error // Why the torrent failed
+}
+
+// Torrent is a handle to a torrent in a Client
+type Torrent struct {
+	client    *Client
+	infoHash  []byte
+	trackers  []string
+	selection *FileSelection
+	added     time.Time
+
+	mu       sync.Mutex
+	name     string
+	info     *metainfo.Info // Nil until the metadata of a magnet link arrives
+	download *Download      // Created along with info
+	done     chan struct{}  // Closed once completed or failed
+	state    TorrentState
+	err      error
+	cancel   context.CancelFunc // Stops the running session, nil while paused
+	stopped  chan struct{}      // Closed once the running session has returned
+	removed  bool
+}
+
+func newTorrent(c *Client, infoHash []byte, name string, trackers []string, selection *FileSelection) *Torrent {
+	if name == "" {
+		name = hex.EncodeToString(infoHash)
+	}
+	return &Torrent{
+		client:    c,
+		infoHash:  infoHash,
+		trackers:  trackers,
+		selection: selection,
+		added:     time.Now(),
+		done:      make(chan struct{}),
+		name:      name,
+	}
+}
+
+// InfoHash returns the hex encoded info hash
+func (t *Torrent) InfoHash() string {
+	return hex.EncodeToString(t.infoHash)
+}
+
+// Name returns the torrent name, or the info hash until a magnet link's metadata arrives
+func (t *Torrent) Name() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.name
+}
+
+// Info returns the info dictionary, nil until a magnet link's metadata arrives
+func (t *Torrent) Info() *metainfo.Info {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.info
+}
+
+// Added returns when the torrent was added to the client
+func (t *Torrent) Added() time.Time {
+	return t.added
+}
+
+// Done is closed once the torrent completes or fails, Err tells which. Wanting
+// more files of a completed torrent pauses it with a new Done channel
+func (t *Torrent) Done() <-chan struct{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.done
+}
+
+// Err returns why the torrent failed, or nil
+func (t *Torrent) Err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
+
+// Stats returns the current state and progress of the torrent
+func (t *Torrent) Stats() TorrentStats {
+	t.mu.Lock()
+	stats := TorrentStats{
+		Name:     t.name,
+		InfoHash: hex.EncodeToString(t.infoHash),
+		State:    t.state,
+		Err:      t.err,
+	}
+	download := t.download
+	t.mu.Unlock()
+
+	if download != nil {
+		stats.DownloadStats = download.Stats()
+	}
+	return stats
+}
+
+// Files returns the files of the torrent with their priorities and progress,
+// nil until a magnet link's metadata arrives
+func (t *Torrent) Files() []FileStats {
+	t.mu.Lock()
+	download := t.download
+	t.mu.Unlock()
+
+	if download == nil {
+		return nil
+	}
+	return download.Files()
+}
+
+// Peers returns the peers the torrent is connected to
+func (t *Torrent) Peers() []PeerStats {
+	t.mu.Lock()
+	download := t.download
+	t.mu.Unlock()
+
+	if download == nil {
+		return nil
+	}
+	return download.Peers()
+}
+
+// SetFilePriority changes the priority of a file by its index in Files. A
+// completed torrent that now wants more pieces is paused so Start resumes it
+func (t *Torrent) SetFilePriority(index int, priority FilePriority) error {
+	t.mu.Lock()
+	download := t.download
+	t.mu.Unlock()
+
+	if download == nil {
+		return errMetadataPending
+	}
+	if err := download.SetFilePriority(index, priority); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.state == StateCompleted && !download.Complete() {
+		// The finished session has returned, release it so Start runs a new one
+		if t.cancel != nil {
+			t.cancel()
+			t.cancel = nil
+		}
+		t.state = StatePaused
+		t.done = make(chan struct{})
+	}
+	return nil
+}
+
+// Start begins or resumes downloading, it does nothing if the torrent is
+// already running, completed or failed
+func (t *Torrent) Start() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.removed {
+		return fmt.Errorf("torrent %s was removed", t.name)
+	}
+	if t.cancel != nil || t.state == StateCompleted || t.state == StateFailed {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(t.client.ctx)
+	t.cancel = cancel
+	t.stopped = make(chan struct{})
+	t.state = StateDownloading
+	if t.info == nil {
+		t.state = StateFetchingMetadata
+	}
+	go t.run(ctx, t.stopped)
+	return nil
+}
+
+// Pause stops downloading and waits for the connections to close, verified
+// pieces stay on disk and Start resumes from them
+func (t *Torrent) Pause() {
+	t.mu.Lock()
+	cancel, stopped := t.cancel, t.stopped
+	t.cancel = nil
+	t.mu.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-stopped
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.state == StateFetchingMetadata || t.state == StateDownloading {
+		t.state = StatePaused
+	}
+}
+
+// Remove stops the torrent and drops it from the client, downloaded files are kept
+func (t *Torrent) Remove() error {
+	t.client.remove(t)
+	return t.close()
+}
+
+func (t *Torrent) close() error {
+	t.Pause()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.removed = true
+	if t.download == nil {
+		return nil
+	}
+	return t.download.Close()
+}
+
+// addConn hands a peer that connected to us to the running download
+func (t *Torrent) addConn(peerConn *peerwire.PeerConnection) error {
+	t.mu.Lock()
+	download := t.download
+	t.mu.Unlock()
+
+	if download == nil {
+		return errNotRunning
+	}
+	return download.AddConn(peerConn)
+}
+
+// run is one session between Start and Pause: it fetches the metadata if
+// needed and downloads until done, re-announcing whenever it runs out of peers
+func (t *Torrent) run(ctx context.Context, stopped chan struct{}) {
+	defer close(stopped)
+
+	event := tracker.EventStarted
+	defer func() {
+		if event != tracker.EventStarted && ctx.Err() != nil {
+			stopCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), stoppedAnnounceTimeout)
+			defer cancel()
+			t.announce(stopCtx, tracker.EventStopped)
+		}
+	}()
+
+	for {
+		peers, interval := t.announce(ctx, event)
+		event = tracker.EventNone
+
+		err := t.step(ctx, peers)
+		switch {
+		case err == nil:
+			t.announce(ctx, tracker.EventCompleted)
+			t.finish(StateCompleted, nil)
+			return
+		case ctx.Err() != nil:
+			return
+		case errors.Is(err, errNoPeers), errors.Is(err, errDownloadIncomplete), errors.Is(err, errMetadataUnavailable):
+			// Ask the trackers for more peers once they allow it
+		default:
+			t.client.config.logger("client").Warn("torrent failed", "torrent", t.InfoHash(), "err", err)
+			t.finish(StateFailed, err)
+			return
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// step fetches the metadata if it is still missing, then downloads from the peers
+func (t *Torrent) step(ctx context.Context, peers []string) error {
+	download, err := t.prepare(ctx, peers)
+	if err != nil {
+		return err
+	}
+	return download.Run(ctx, peers)
+}
+
+// prepare returns the download, fetching the metadata first if it is missing
+func (t *Torrent) prepare(ctx context.Context, peers []string) (*Download, error) {
+	t.mu.Lock()
+	download := t.download
+	t.mu.Unlock()
+
+	if download != nil {
+		return download, nil
+	}
+
+	if len(peers) == 0 {
+		return nil, errNoPeers
+	}
+	info, _, err := FetchMetadata(ctx, t.infoHash, peers, t.client.config)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errMetadataUnavailable, err)
+	}
+
+	download, err = t.createDownload(info)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.state = StateDownloading
+	return download, nil
+}
+
+// createDownload sets up the download once the metadata is known
+func (t *Torrent) createDownload(info *metainfo.Info) (*Download, error) {
+	download, err := NewDownload(info, t.infoHash, filepath.Join(t.client.dataDir, info.Name), t.selection)
+	if err != nil {
+		return nil, err
+	}
+	download.SetConfig(t.client.config)
+	download.budget = t.client.budget
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.info = info
+	t.name = info.Name
+	t.download = download
+	return download, nil
+}
+
+// finish records the final state of the torrent and closes Done
+func (t *Torrent) finish(state TorrentState, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.state = state
+	t.err = err
+	close(t.done)
+}
+
+// announce asks every tracker for peers in parallel and returns all of them,
+// along with how long to wait before announcing again
+func (t *Torrent) announce(ctx context.Context, event tracker.Event) ([]string, time.Duration) {
+	t.mu.Lock()
+	download := t.download
+	t.mu.Unlock()
+
+	request := tracker.Request{
+		InfoHash: t.infoHash,
+		Port:     t.client.port,
+		Left:     unknownLeft,
+		Event:    event,
+	}
+	if download != nil {
+		stats := download.Stats()
+		request.Left = int(stats.BytesWanted - stats.BytesDone)
+		request.Downloaded = stats.BytesDownloaded
+	}
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		peers    []string
+		interval time.Duration
+	)
+	for _, announceURL := range t.trackers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			response, err := announce(ctx, announceURL, request, t.client.config)
+			if err != nil {
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			for _, peerAddr := range response.PeerAddrs() {
+				if !slices.Contains(peers, peerAddr) {
+					peers = append(peers, peerAddr)
+				}
+			}
+			if trackerInterval := time.Duration(response.Interval) * time.Second; trackerInterval > 0 && (interval == 0 || trackerInterval < interval) {
+				interval = trackerInterval
+			}
+		}()
+	}
+	wg.Wait()
+
+	if interval == 0 {
+		interval = retryInterval
+	}
+	return peers, interval
+}
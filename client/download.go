@@ -0,0 +1,727 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/codecrafters-io/bittorrent-starter-go/metainfo"
+	"github.com/codecrafters-io/bittorrent-starter-go/peerwire"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	maxRetries    = 3 // Maximum retries for piece download
+	maxConcurrent = 5 // Maximum concurrent piece downloads
+)
+
+var (
+	errNoPeers            = errors.New("no peers available")
+	errDownloadIncomplete = errors.New("download incomplete")
+	errNotRunning         = errors.New("download is not running")
+)
+
+type pieceWork struct {
+	index  int
+	length int
+	hash   []byte
+	offset int64
+	data   []byte
+	peer   string // Address of the peer the data came from
+}
+
+// DownloadPiece waits to be unchoked by the peer and downloads a single piece
+func DownloadPiece(peerConn *peerwire.PeerConnection, torrentInfo *metainfo.Info, pieceIndex int) ([]byte, error) {
+	if err := peerwire.SetupConnection(peerConn); err != nil {
+		return nil, fmt.Errorf("Failed to establish connection: %w", err)
+
+	}
+
+	pieceLength := torrentInfo.PieceSize(pieceIndex)
+	return peerwire.DownloadPiece(peerConn, pieceIndex, pieceLength)
+}
+
+// Download tracks the state of a torrent being downloaded to disk
+type Download struct {
+	info     *metainfo.Info
+	infoHash []byte
+	metadata []byte
+	files    []fileEntry
+	pieces   []pieceWork
+	storage  *fileStorage
+	picker   *piecePicker
+
+	config     Config
+	budget     *connectionBudget // Connections allowed across downloads, nil for no limit
+	downloaded atomic.Int64      // Piece data received, including pieces that failed verification
+	failed     atomic.Int64      // Pieces that failed verification
+	rate       rateMeter
+
+	priorityMu sync.Mutex // Serialises priority changes, which may move file data
+
+	mu        sync.Mutex
+	run       *downloadRun
+	connected map[string]*peerState // Open connections by peer ID
+	banned    map[string]bool       // Addresses that sent a handshake we refused
+}
+
+// downloadRun is a Run in progress, which incoming connections can join
+type downloadRun struct {
+	ctx     context.Context
+	results chan pieceWork
+	workers int // Closes results when it drops to zero
+}
+
+// peerState is what a download tracks about a connected peer
+type peerState struct {
+	conn       *peerwire.PeerConnection
+	incoming   bool
+	downloaded atomic.Int64 // Verified and failed piece data received from the peer
+	rate       rateMeter
+}
+
+// PeerStats is a snapshot of a connected peer
+type PeerStats struct {
+	Addr            string
+	PeerID          string // Hex encoded
+	Client          string
+	Incoming        bool  // The peer connected to us
+	Choked          bool  // The peer is choking us
+	Downloaded      int64 // Piece data received from the peer
+	DownloadRate    int64 // Bytes per second received from the peer lately
+	PendingRequests int   // Block requests waiting for their block
+}
+
+// PieceState is how far along the download of a piece is
+type PieceState int
+
+const (
+	PieceMissing     PieceState = iota // Wanted and not requested from a peer
+	PieceDownloading                   // Being downloaded from a peer
+	PieceVerified                      // Verified and written
+	PieceSkipped                       // Only overlaps skipped files
+)
+
+// DownloadStats is a snapshot of the progress of a download
+type DownloadStats struct {
+	Peers           int   // Open peer connections
+	PiecesWanted    int   // Pieces overlapping the selected files
+	PiecesDone      int   // Wanted pieces verified and written
+	BytesWanted     int64 // Length of the wanted pieces
+	BytesDone       int64 // Length of the verified pieces
+	BytesDownloaded int64 // Piece data received, including pieces that failed verification
+	DownloadRate    int64 // Bytes per second received lately
+	PiecesFailed    int64 // Pieces received that failed verification
+}
+
+// NewDownload prepares a download of the selected files into outputPath
+func NewDownload(torrentInfo *metainfo.Info, infoHash []byte, outputPath string, selection *FileSelection) (*Download, error) {
+	// Names come from the torrent, so they must not escape the output path
+	if err := torrentInfo.Validate(); err != nil {
+		return nil, err
+	}
+
+	files := buildFileLayout(torrentInfo)
+
+	if selection != nil {
+		if err := selection.Apply(files); err != nil {
+			return nil, err
+		}
+	}
+
+	storage, err := newFileStorage(outputPath, torrentInfo, files)
+	if err != nil {
+		return nil, err
+	}
+
+	pieces := buildPieceWork(torrentInfo)
+	picker := newPiecePicker(pieces, piecePriorities(torrentInfo, files))
+
+	// Serve the info dictionary to magnet peers only if it hashes back to the info hash
+	metadata, err := torrentInfo.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	if hash := sha1.Sum(metadata); !bytes.Equal(hash[:], infoHash) {
+		metadata = nil
+	}
+
+	return &Download{
+		info:     torrentInfo,
+		infoHash: infoHash,
+		metadata: metadata,
+		files:    files,
+		pieces:   pieces,
+		storage:  storage,
+		picker:   picker,
+
+		config:    DefaultConfig(),
+		connected: make(map[string]*peerState),
+		banned:    make(map[string]bool),
+	}, nil
+}
+
+// DownloadFile downloads the selected files of a torrent into outputPath
+func DownloadFile(ctx context.Context, torrentInfo *metainfo.Info, peers []string, infoHash []byte, outputPath string, selection *FileSelection, config Config) error {
+	download, err := NewDownload(torrentInfo, infoHash, outputPath, selection)
+	if err != nil {
+		return err
+	}
+	defer download.Close()
+
+	download.SetConfig(config)
+
+	return download.Run(ctx, peers)
+}
+
+// SetStrategy changes the order pieces are downloaded in and the read-ahead window
+func (d *Download) SetStrategy(strategy PieceStrategy, readahead int) {
+	d.picker.SetStrategy(strategy, readahead)
+}
+
+// SetConfig sets the identity, encryption policy and timeouts for connections to peers
+func (d *Download) SetConfig(config Config) {
+	d.config = config
+}
+
+// Info returns the info dictionary of the torrent being downloaded
+func (d *Download) Info() *metainfo.Info {
+	return d.info
+}
+
+// Stats returns the current progress of the download
+func (d *Download) Stats() DownloadStats {
+	pieces, piecesDone, bytes, bytesDone := d.picker.Progress()
+
+	d.mu.Lock()
+	peers := len(d.connected)
+	d.mu.Unlock()
+
+	return DownloadStats{
+		Peers:           peers,
+		PiecesWanted:    pieces,
+		PiecesDone:      piecesDone,
+		BytesWanted:     bytes,
+		BytesDone:       bytesDone,
+		BytesDownloaded: d.downloaded.Load(),
+		DownloadRate:    d.rate.rate(),
+		PiecesFailed:    d.failed.Load(),
+	}
+}
+
+// Pieces returns the state of every piece, indexed by piece
+func (d *Download) Pieces() []PieceState {
+	states := d.picker.States()
+	pieces := make([]PieceState, len(states))
+	for i, state := range states {
+		switch state {
+		case pieceInProgress:
+			pieces[i] = PieceDownloading
+		case pieceDone:
+			pieces[i] = PieceVerified
+		case pieceUnwanted:
+			pieces[i] = PieceSkipped
+		}
+	}
+	return pieces
+}
+
+// Files returns the files of the torrent with their priorities and progress
+func (d *Download) Files() []FileStats {
+	verified := d.picker.Verified()
+	pieceLength := int64(d.info.PieceLength)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	files := make([]FileStats, len(d.files))
+	for i, file := range d.files {
+		files[i] = FileStats{Path: file.path, Length: file.length, Priority: file.priority}
+
+		end := file.offset + file.length
+		for index := file.offset / pieceLength; index*pieceLength < end; index++ {
+			if verified[index] {
+				files[i].BytesDone += min(end, (index+1)*pieceLength) - max(file.offset, index*pieceLength)
+			}
+		}
+	}
+	return files
+}
+
+// SetFilePriority changes the priority of a file, also while the download
+// runs. Skipping a file stops requesting the pieces only it needs
+func (d *Download) SetFilePriority(index int, priority FilePriority) error {
+	if index < 0 || index >= len(d.files) {
+		return fmt.Errorf("file index %d out of range (torrent has %d files)", index, len(d.files))
+	}
+
+	d.priorityMu.Lock()
+	defer d.priorityMu.Unlock()
+
+	if err := d.storage.SetPriority(index, priority); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	d.files[index].priority = priority
+	priorities := piecePriorities(d.info, d.files)
+	d.mu.Unlock()
+
+	d.picker.SetPriorities(priorities)
+	return nil
+}
+
+// Peers returns the connected peers ordered by address
+func (d *Download) Peers() []PeerStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	peers := make([]PeerStats, 0, len(d.connected))
+	for _, peer := range d.connected {
+		peers = append(peers, PeerStats{
+			Addr:            peer.conn.Conn.RemoteAddr().String(),
+			PeerID:          peer.conn.PeerID,
+			Client:          peer.conn.Client.String(),
+			Incoming:        peer.incoming,
+			Choked:          peer.conn.PeerChoking(),
+			Downloaded:      peer.downloaded.Load(),
+			DownloadRate:    peer.rate.rate(),
+			PendingRequests: peer.conn.PendingRequests(),
+		})
+	}
+	slices.SortFunc(peers, func(a, b PeerStats) int {
+		return strings.Compare(a.Addr, b.Addr)
+	})
+	return peers
+}
+
+// Complete reports whether every wanted piece has been verified
+func (d *Download) Complete() bool {
+	return d.picker.Remaining() == 0
+}
+
+// Run downloads every wanted piece from the given peers until done or ctx is
+// cancelled. A stopped download can be run again and picks up where it left off
+func (d *Download) Run(ctx context.Context, peers []string) error {
+	peers = slices.DeleteFunc(slices.Clone(peers), d.Banned)
+	if len(peers) == 0 {
+		return errNoPeers
+	}
+
+	if d.picker.Remaining() == 0 {
+		return nil
+	}
+
+	workerCtx, stopWorkers := context.WithCancel(ctx)
+	defer stopWorkers()
+	results := make(chan pieceWork, maxConcurrent)
+	numWorkers := min(len(peers), maxConcurrent)
+	run := &downloadRun{ctx: workerCtx, results: results, workers: numWorkers}
+
+	// Only the run that got in reopens the picker, so a second call leaves
+	// the pieces in progress alone
+	d.mu.Lock()
+	if d.run != nil {
+		d.mu.Unlock()
+		return fmt.Errorf("download is already running")
+	}
+	d.run = run
+	d.picker.Reopen()
+	d.mu.Unlock()
+
+	// Stopping the workers wakes those waiting on the picker, and they close
+	// their own connections to interrupt reads still in progress
+	stopPicker := context.AfterFunc(workerCtx, d.picker.Close)
+	defer stopPicker()
+
+	// Workers move on to the next peer when theirs fails
+	queue := make(chan string, len(peers))
+	for _, peerAddr := range peers {
+		queue <- peerAddr
+	}
+	close(queue)
+
+	// Start workers, the last one to finish closes results
+	for i := 0; i < numWorkers; i++ {
+		go func() {
+			defer d.workerDone(run)
+			for peerAddr := range queue {
+				if workerCtx.Err() != nil {
+					return
+				}
+				d.worker(workerCtx, peerAddr, results)
+			}
+		}()
+	}
+
+	// Write verified pieces to disk as they arrive
+	var writeErr error
+	for piece := range results {
+		if writeErr != nil {
+			continue
+		}
+
+		if err := d.storage.WritePiece(piece.offset, piece.data); err != nil {
+			d.logger("storage").Error("failed to write piece", "piece", piece.index, "offset", piece.offset, "err", err)
+			writeErr = fmt.Errorf("failed to write piece %d: %w", piece.index, err)
+			stopWorkers()
+			continue
+		}
+		d.picker.Complete(piece.index)
+		d.logger("storage").Debug("piece written", "piece", piece.index, "offset", piece.offset, "peer", piece.peer)
+		d.publish(Event{Type: EventPieceVerified, Peer: piece.peer, Piece: piece.index, Length: piece.length})
+
+		// Workers may be waiting on a choked or snubbed peer with nothing left to fetch
+		if d.picker.Remaining() == 0 {
+			d.publish(Event{Type: EventCompleted, Name: d.info.Name})
+			stopWorkers()
+		}
+	}
+
+	// Wake anyone still waiting on pieces that will never arrive
+	d.picker.Close()
+
+	d.mu.Lock()
+	d.run = nil
+	d.mu.Unlock()
+
+	if writeErr != nil {
+		return writeErr
+	}
+
+	if err := ctx.Err(); err != nil && d.picker.Remaining() > 0 {
+		return fmt.Errorf("download stopped: %w", err)
+	}
+
+	if remaining := d.picker.Remaining(); remaining > 0 {
+		return fmt.Errorf("%w: %d pieces missing", errDownloadIncomplete, remaining)
+	}
+	return nil
+}
+
+// AddConn hands a peer that connected to us to the running download, the
+// connection is left open for the caller to close if it is refused
+func (d *Download) AddConn(peerConn *peerwire.PeerConnection) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	run := d.run
+	if run == nil || run.workers == 0 || run.ctx.Err() != nil {
+		return errNotRunning
+	}
+	if d.connected[peerConn.PeerID] != nil {
+		return &peerwire.HandshakeError{Addr: peerConn.Conn.RemoteAddr().String(), Err: peerwire.ErrDuplicatePeer}
+	}
+	if !d.budget.tryAcquire() {
+		return errNoConnectionSlots
+	}
+
+	d.connected[peerConn.PeerID] = &peerState{conn: peerConn, incoming: true}
+	d.publishConnected(peerConn)
+	run.workers++
+	go func() {
+		defer d.workerDone(run)
+		d.serve(run.ctx, peerConn, run.results)
+	}()
+	return nil
+}
+
+// workerDone closes the results of a run once its last worker is done
+func (d *Download) workerDone(run *downloadRun) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	run.workers--
+	if run.workers == 0 {
+		close(run.results)
+	}
+}
+
+// Close releases the files held open by the download
+func (d *Download) Close() error {
+	d.picker.Close()
+	return d.storage.Close()
+}
+
+// Banned reports whether a peer address was refused for a bad handshake
+func (d *Download) Banned(peerAddr string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.banned[peerAddr]
+}
+
+// connect opens a connection to a peer, banning addresses that send a bad
+// handshake or belong to a peer we're already connected to
+func (d *Download) connect(ctx context.Context, peerAddr string) (*peerwire.PeerConnection, error) {
+	if d.Banned(peerAddr) {
+		return nil, fmt.Errorf("peer %s is banned", peerAddr)
+	}
+
+	peerConn, err := peerwire.NewPeerConnection(ctx, peerAddr, d.infoHash, d.config.PeerConfig())
+	var handshakeErr *peerwire.HandshakeError
+	if errors.As(err, &handshakeErr) {
+		d.ban(peerAddr, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.connected[peerConn.PeerID] != nil {
+		peerConn.Conn.Close()
+		d.banned[peerAddr] = true
+		d.peerLogger(peerConn).Info("banned peer", "err", peerwire.ErrDuplicatePeer)
+		return nil, &peerwire.HandshakeError{Addr: peerAddr, Err: peerwire.ErrDuplicatePeer}
+	}
+	d.connected[peerConn.PeerID] = &peerState{conn: peerConn}
+	d.publishConnected(peerConn)
+	return peerConn, nil
+}
+
+// disconnect closes a connection opened by connect or accepted by AddConn,
+// err is why the peer was dropped or nil if the download stopped with it
+func (d *Download) disconnect(peerConn *peerwire.PeerConnection, err error) {
+	peerConn.Conn.Close()
+	d.budget.release()
+
+	d.mu.Lock()
+	delete(d.connected, peerConn.PeerID)
+	d.mu.Unlock()
+
+	d.peerLogger(peerConn).Debug("peer disconnected", "err", err)
+
+	d.publish(Event{
+		Type:   EventPeerDisconnected,
+		Peer:   peerConn.Conn.RemoteAddr().String(),
+		PeerID: peerConn.PeerID,
+		Err:    err,
+	})
+}
+
+func (d *Download) publishConnected(peerConn *peerwire.PeerConnection) {
+	d.peerLogger(peerConn).Debug("peer connected", "client", peerConn.Client.String())
+	d.publish(Event{
+		Type:   EventPeerConnected,
+		Peer:   peerConn.Conn.RemoteAddr().String(),
+		PeerID: peerConn.PeerID,
+		Client: peerConn.Client.String(),
+	})
+}
+
+// publish sends an event about this download to the configured event stream
+func (d *Download) publish(event Event) {
+	event.InfoHash = hex.EncodeToString(d.infoHash)
+	d.config.Events.publish(event)
+}
+
+// addDownloaded counts piece data received from a peer
+func (d *Download) addDownloaded(peerConn *peerwire.PeerConnection, n int) {
+	d.downloaded.Add(int64(n))
+	d.rate.add(int64(n))
+
+	d.mu.Lock()
+	peer := d.connected[peerConn.PeerID]
+	d.mu.Unlock()
+	if peer != nil {
+		peer.downloaded.Add(int64(n))
+		peer.rate.add(int64(n))
+	}
+}
+
+func (d *Download) ban(peerAddr string, err error) {
+	d.logger("peer").Info("banned peer", "peer", peerAddr, "err", err)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.banned[peerAddr] = true
+}
+
+// logger returns the logger for a subsystem with the torrent attached
+func (d *Download) logger(subsystem string) *slog.Logger {
+	return d.config.logger(subsystem).With("torrent", hex.EncodeToString(d.infoHash))
+}
+
+// peerLogger returns the peer subsystem logger with the peer attached
+func (d *Download) peerLogger(peerConn *peerwire.PeerConnection) *slog.Logger {
+	return d.logger("peer").With("peer", peerConn.Conn.RemoteAddr().String(), "peer_id", peerConn.PeerID)
+}
+
+// worker connects to a peer once a connection slot is free and downloads from it
+func (d *Download) worker(ctx context.Context, peerAddr string, results chan pieceWork) {
+	if !d.budget.acquire(ctx) {
+		return
+	}
+
+	peerConn, err := d.connect(ctx, peerAddr)
+	if err != nil {
+		d.logger("peer").Debug("failed to connect", "peer", peerAddr, "err", err)
+		d.budget.release()
+		return
+	}
+	d.serve(ctx, peerConn, results)
+}
+
+// serve downloads pieces from a connected peer until it fails or the run stops
+func (d *Download) serve(ctx context.Context, peerConn *peerwire.PeerConnection, results chan pieceWork) {
+	err := d.servePeer(ctx, peerConn, results)
+	if ctx.Err() != nil {
+		err = nil
+	}
+	d.disconnect(peerConn, err)
+}
+
+func (d *Download) servePeer(ctx context.Context, peerConn *peerwire.PeerConnection, results chan pieceWork) error {
+	picker := d.picker
+
+	// Closing the connection interrupts any read or write in progress
+	stop := context.AfterFunc(ctx, func() {
+		peerConn.Conn.Close()
+	})
+	defer stop()
+
+	peerConn.RegisterExtension(peerwire.NewMetadataExtension(d.metadata))
+	if err := peerConn.StartExtensions(); err != nil {
+		return err
+	}
+
+	peerConn.SetNumPieces(picker.NumPieces())
+	if err := peerConn.StartFast(picker.NumPieces()); err != nil {
+		return err
+	}
+
+	if _, err := peerConn.Conn.Write(peerwire.NewInterestedMessage()); err != nil {
+		return err
+	}
+
+	// Rejections per piece while unchoked, pieces are retried elsewhere first
+	rejected := make(map[int]int)
+
+	for {
+		work, ok, err := nextPiece(peerConn, picker, rejected)
+		if err != nil || !ok {
+			return err
+		}
+
+		verified := false
+		for retry := 0; retry < maxRetries; retry++ {
+			var pieceData []byte
+			pieceData, err = peerwire.DownloadPiece(peerConn, work.index, work.length)
+			if errors.Is(err, peerwire.ErrRequestRejected) || errors.Is(err, peerwire.ErrPeerChoked) || errors.Is(err, peerwire.ErrPeerSnubbed) {
+				break
+			}
+			if err != nil {
+				continue
+			}
+			d.addDownloaded(peerConn, len(pieceData))
+
+			if verifyPiece(pieceData, work.hash) {
+				work.data = pieceData
+				work.peer = peerConn.Conn.RemoteAddr().String()
+				results <- work
+				verified = true
+				break
+			}
+
+			err = errPieceHashMismatch
+			d.failed.Add(1)
+			d.peerLogger(peerConn).Info("piece failed verification", "piece", work.index)
+			d.publish(Event{
+				Type:   EventPieceFailed,
+				Peer:   peerConn.Conn.RemoteAddr().String(),
+				PeerID: peerConn.PeerID,
+				Piece:  work.index,
+				Length: work.length,
+				Err:    err,
+			})
+		}
+		if verified {
+			continue
+		}
+
+		// Give the piece back to another peer right away
+		picker.Requeue(work.index)
+
+		switch {
+		case errors.Is(err, peerwire.ErrRequestRejected):
+			if !peerConn.PeerChoking() {
+				rejected[work.index]++
+			}
+		case errors.Is(err, peerwire.ErrPeerChoked), errors.Is(err, peerwire.ErrPeerSnubbed):
+		default:
+			return err // Drop a peer that keeps failing
+		}
+	}
+}
+
+// nextPiece picks a piece for the peer to serve. While choked only pieces in
+// the peer's allowed fast set qualify, and without one it waits for an unchoke.
+// A snubbing peer gets no new work until its overdue block arrives
+func nextPiece(peerConn *peerwire.PeerConnection, picker *piecePicker, rejected map[int]int) (pieceWork, bool, error) {
+	available := func(index int) bool {
+		return peerConn.HasPiece(index) && rejected[index] < maxRetries
+	}
+	neverRejected := func(index int) bool {
+		return available(index) && rejected[index] == 0
+	}
+
+	// Peers keeping us choked or snubbed while sending keep-alives are dropped
+	// after the idle timeout
+	defer peerConn.ExpectWithin(peerConn.Timeouts().Idle)()
+
+	for !picker.Stopped() {
+		switch {
+		case peerConn.Snubbed():
+			// New requests would likely stall as well
+		case !peerConn.PeerChoking():
+			if work, ok := picker.TryNext(pieceQuery{available: neverRejected, preferred: peerConn.IsSuggested}); ok {
+				return work, true, nil
+			}
+			work, ok := picker.Next(pieceQuery{available: available, preferred: peerConn.IsSuggested})
+			return work, ok, nil
+
+		default:
+			allowed := func(index int) bool {
+				return available(index) && peerConn.IsAllowedFast(index)
+			}
+			if work, ok := picker.TryNext(pieceQuery{available: allowed}); ok {
+				return work, true, nil
+			}
+		}
+
+		// Wait for an unchoke, more pieces to be allowed or the overdue block
+		if _, _, err := peerConn.ReadMessage(); err != nil {
+			return pieceWork{}, false, err
+		}
+	}
+	return pieceWork{}, false, nil
+}
+
+func buildPieceWork(torrentInfo *metainfo.Info) []pieceWork {
+	numPieces := torrentInfo.NumPieces()
+	pieces := make([]pieceWork, 0, numPieces)
+	var offset int64
+
+	for i := 0; i < numPieces; i++ {
+		pieceLength := torrentInfo.PieceSize(i)
+		pieces = append(pieces, pieceWork{
+			index:  i,
+			length: pieceLength,
+			hash:   torrentInfo.PieceHash(i),
+			offset: offset,
+		})
+		offset += int64(pieceLength)
+	}
+	return pieces
+}
+
+func verifyPiece(pieceData []byte, expectedHash []byte) bool {
+	hash := sha1.Sum(pieceData)
+	return bytes.Equal(hash[:], expectedHash)
+}
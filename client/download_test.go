@@ -0,0 +1,104 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/codecrafters-io/bittorrent-starter-go/metainfo"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestDownload prepares a download of info into a temporary directory
+func newTestDownload(t *testing.T, info *metainfo.Info, selection *FileSelection) (*Download, string) {
+	t.Helper()
+	outputPath := filepath.Join(t.TempDir(), info.Name)
+	infoHash, err := info.Hash()
+	if err != nil {
+		t.Fatalf("failed to hash info: %v", err)
+	}
+	download, err := NewDownload(info, infoHash, outputPath, selection)
+	if err != nil {
+		t.Fatalf("NewDownload failed: %v", err)
+	}
+	t.Cleanup(func() { download.Close() })
+	return download, outputPath
+}
+
+func TestRunWhileRunningKeepsPieces(t *testing.T) {
+	download, _ := newTestDownload(t, &metainfo.Info{
+		Name:        "test.bin",
+		Length:      4 * 16384,
+		PieceLength: 16384,
+		Pieces:      strings.Repeat("\x00", 4*20),
+	}, nil)
+
+	piece, ok := download.picker.TryNext(pieceQuery{})
+	if !ok {
+		t.Fatalf("no piece to pick")
+	}
+	download.run = &downloadRun{}
+
+	if err := download.Run(context.Background(), []string{"127.0.0.1:1"}); err == nil {
+		t.Fatalf("a second Run was started")
+	}
+	if state := download.picker.States()[piece.index]; state != pieceInProgress {
+		t.Errorf("piece %d is %v after the refused Run, want in progress", piece.index, state)
+	}
+}
+
+func TestSetFilePrioritySkip(t *testing.T) {
+	// a.bin fills piece 0 and shares piece 1 with b.bin
+	download, outputPath := newTestDownload(t, &metainfo.Info{
+		Name:        "content",
+		PieceLength: 16384,
+		Pieces:      strings.Repeat("\x00", 2*20),
+		Files: []metainfo.File{
+			{Length: 20000, Path: []string{"a.bin"}},
+			{Length: 12768, Path: []string{"b.bin"}},
+		},
+	}, nil)
+	aPath := filepath.Join(outputPath, "a.bin")
+
+	content := bytes.Repeat([]byte("0123456789abcdef"), 2*16384/16)
+	if err := download.storage.WritePiece(0, content); err != nil {
+		t.Fatalf("failed to write content: %v", err)
+	}
+	readContent := func() []byte {
+		t.Helper()
+		buf := make([]byte, len(content))
+		if _, err := download.storage.ReadAt(buf, 0); err != nil {
+			t.Fatalf("failed to read content: %v", err)
+		}
+		return buf
+	}
+
+	if err := download.SetFilePriority(0, PrioritySkip); err != nil {
+		t.Fatalf("failed to skip a.bin: %v", err)
+	}
+	if _, err := os.Stat(aPath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("skipped a.bin is still on disk: %v", err)
+	}
+	if !bytes.Equal(readContent(), content) {
+		t.Errorf("content changed after skipping a.bin")
+	}
+	if states := download.picker.States(); states[0] != pieceUnwanted || states[1] != piecePending {
+		t.Errorf("piece states %v after skipping a.bin, want piece 0 unwanted and piece 1 pending", states)
+	}
+
+	if err := download.SetFilePriority(0, PriorityNormal); err != nil {
+		t.Fatalf("failed to unskip a.bin: %v", err)
+	}
+	data, err := os.ReadFile(aPath)
+	if err != nil {
+		t.Fatalf("a.bin not restored: %v", err)
+	}
+	if !bytes.Equal(data, content[:20000]) {
+		t.Errorf("restored a.bin differs from the bytes written")
+	}
+	if states := download.picker.States(); states[0] != piecePending || states[1] != piecePending {
+		t.Errorf("piece states %v after unskipping a.bin, want both pending", states)
+	}
+}
@@ -0,0 +1,224 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// errPieceHashMismatch is the error of a piece failed event for data that didn't verify
+var errPieceHashMismatch = errors.New("piece hash mismatch")
+
+// EventType identifies what an Event reports
+type EventType int
+
+const (
+	EventPeerConnected    EventType = iota // Peer, PeerID and Client are set
+	EventPeerDisconnected                  // Peer and PeerID are set, Err says why if it failed
+	EventPieceVerified                     // Piece, Length and Peer are set
+	EventPieceFailed                       // Piece, Length, Peer and Err are set
+	EventTrackerAnnounce                   // Tracker, Duration and Peers are set, or Err if the announce failed
+	EventMetadataReceived                  // Name and Length of the info dictionary are set
+	EventCompleted                         // Every wanted piece is verified
+	EventDropped                           // Dropped is set, the reader fell behind and missed older events
+)
+
+// maxQueuedEvents bounds the events queued for a subscriber, beyond it the
+// oldest are dropped
+const maxQueuedEvents = 4096
+
+func (t EventType) String() string {
+	switch t {
+	case EventPeerConnected:
+		return "peer connected"
+	case EventPeerDisconnected:
+		return "peer disconnected"
+	case EventPieceVerified:
+		return "piece verified"
+	case EventPieceFailed:
+		return "piece failed"
+	case EventTrackerAnnounce:
+		return "tracker announce"
+	case EventMetadataReceived:
+		return "metadata received"
+	case EventCompleted:
+		return "completed"
+	case EventDropped:
+		return "dropped"
+	}
+	return fmt.Sprintf("EventType(%d)", int(t))
+}
+
+// Event reports progress of a download or activity of its peers and trackers,
+// fields that don't apply to the type are left empty
+type Event struct {
+	Type     EventType
+	Time     time.Time
+	InfoHash string // Hex encoded
+	Peer     string // Peer address
+	PeerID   string // Hex encoded
+	Client   string // Client software of the peer
+	Piece    int
+	Length   int           // Piece or metadata length in bytes
+	Tracker  string        // Announce URL
+	Peers    int           // Peers listed by the tracker
+	Name     string        // Torrent name
+	Duration time.Duration // How long a tracker announce took
+	Dropped  int           // Events missed by the reader
+	Err      error
+}
+
+// Events fans events out to every subscriber. A nil *Events drops them
+type Events struct {
+	mu          sync.Mutex
+	subscribers map[*subscriber]bool
+	closed      bool
+}
+
+// NewEvents creates an event stream without subscribers
+func NewEvents() *Events {
+	return &Events{subscribers: make(map[*subscriber]bool)}
+}
+
+// Subscribe returns a channel receiving every event published from now on.
+// Events queue up instead of stalling the download when the reader falls
+// behind, and once the queue is full the oldest are replaced by an
+// EventDropped. Calling cancel drops queued events and closes the channel
+func (e *Events) Subscribe() (events <-chan Event, cancel func()) {
+	s := &subscriber{
+		ch:     make(chan Event),
+		wake:   make(chan struct{}, 1),
+		cancel: make(chan struct{}),
+	}
+
+	e.mu.Lock()
+	if e.closed {
+		s.closing = true
+	} else {
+		e.subscribers[s] = true
+	}
+	e.mu.Unlock()
+
+	go s.run()
+
+	var once sync.Once
+	return s.ch, func() {
+		once.Do(func() {
+			e.mu.Lock()
+			delete(e.subscribers, s)
+			e.mu.Unlock()
+			close(s.cancel)
+		})
+	}
+}
+
+// Close ends the stream, each subscriber's channel is closed once it has
+// received the events already queued
+func (e *Events) Close() {
+	if e == nil {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.closed = true
+	for s := range e.subscribers {
+		s.close()
+	}
+	clear(e.subscribers)
+}
+
+func (e *Events) publish(event Event) {
+	if e == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for s := range e.subscribers {
+		s.push(event)
+	}
+}
+
+// subscriber queues events for one reader
+type subscriber struct {
+	ch     chan Event
+	wake   chan struct{} // Signalled when the queue grows or closing is set
+	cancel chan struct{} // Closed when the reader unsubscribes
+
+	mu      sync.Mutex
+	queue   []Event
+	dropped int  // Events dropped from the front of the queue since the last EventDropped
+	closing bool // Close the channel once the queue is empty
+}
+
+func (s *subscriber) push(event Event) {
+	s.mu.Lock()
+	if len(s.queue) >= maxQueuedEvents {
+		s.queue[0] = Event{}
+		s.queue = s.queue[1:]
+		s.dropped++
+	}
+	s.queue = append(s.queue, event)
+	s.mu.Unlock()
+	s.signal()
+}
+
+func (s *subscriber) close() {
+	s.mu.Lock()
+	s.closing = true
+	s.mu.Unlock()
+	s.signal()
+}
+
+func (s *subscriber) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run delivers queued events in order until the stream ends
+func (s *subscriber) run() {
+	defer close(s.ch)
+
+	for {
+		s.mu.Lock()
+		if len(s.queue) == 0 {
+			closing := s.closing
+			s.mu.Unlock()
+			if closing {
+				return
+			}
+
+			select {
+			case <-s.wake:
+				continue
+			case <-s.cancel:
+				return
+			}
+		}
+		var event Event
+		if s.dropped > 0 {
+			event = Event{Type: EventDropped, Time: time.Now(), Dropped: s.dropped}
+			s.dropped = 0
+		} else {
+			event = s.queue[0]
+			s.queue[0] = Event{}
+			s.queue = s.queue[1:]
+		}
+		s.mu.Unlock()
+
+		select {
+		case s.ch <- event:
+		case <-s.cancel:
+			return
+		}
+	}
+}
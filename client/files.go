@@ -0,0 +1,193 @@
+package client
+
+import (
+	"fmt"
+	"github.com/codecrafters-io/bittorrent-starter-go/metainfo"
+	"path"
+	"strings"
+)
+
+// FilePriority controls whether and how eagerly a file is downloaded
+type FilePriority int
+
+const (
+	PrioritySkip FilePriority = iota
+	PriorityLow
+	PriorityNormal
+	PriorityHigh
+)
+
+var filePriorityNames = map[string]FilePriority{
+	"skip":   PrioritySkip,
+	"low":    PriorityLow,
+	"normal": PriorityNormal,
+	"high":   PriorityHigh,
+}
+
+// ParseFilePriority converts a priority name into a FilePriority
+func ParseFilePriority(name string) (FilePriority, error) {
+	priority, ok := filePriorityNames[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown file priority %q", name)
+	}
+	return priority, nil
+}
+
+func (p FilePriority) String() string {
+	switch p {
+	case PrioritySkip:
+		return "skip"
+	case PriorityLow:
+		return "low"
+	case PriorityNormal:
+		return "normal"
+	case PriorityHigh:
+		return "high"
+	}
+	return fmt.Sprintf("priority(%d)", int(p))
+}
+
+// FileStats is a snapshot of one file of a download
+type FileStats struct {
+	Path      string // Slash separated path relative to the content root
+	Length    int64
+	Priority  FilePriority
+	BytesDone int64 // Length of the file covered by verified pieces
+}
+
+// fileEntry is one file of the torrent content laid out end to end
+type fileEntry struct {
+	path     string // Slash separated path relative to the content root
+	parts    []string
+	length   int64
+	offset   int64 // Offset of the first byte within the concatenated content
+	priority FilePriority
+}
+
+// buildFileLayout lists the files of a torrent with their content offsets
+func buildFileLayout(info *metainfo.Info) []fileEntry {
+	if len(info.Files) == 0 {
+		return []fileEntry{{
+			path:     info.Name,
+			parts:    []string{info.Name},
+			length:   int64(info.Length),
+			priority: PriorityNormal,
+		}}
+	}
+
+	files := make([]fileEntry, 0, len(info.Files))
+	var offset int64
+	for _, file := range info.Files {
+		files = append(files, fileEntry{
+			path:     strings.Join(file.Path, "/"),
+			parts:    file.Path,
+			length:   int64(file.Length),
+			offset:   offset,
+			priority: PriorityNormal,
+		})
+		offset += int64(file.Length)
+	}
+	return files
+}
+
+// FileSelection describes which files to download and at what priority
+type FileSelection struct {
+	Only       []string // Glob patterns of files to download, empty means all
+	Exclude    []string // Glob patterns of files to skip
+	Indices    []int    // File indices to download, as given by magnet so=
+	Priorities []FilePriorityRule
+}
+
+// FilePriorityRule assigns a priority to every file matching a glob pattern
+type FilePriorityRule struct {
+	Pattern  string
+	Priority FilePriority
+}
+
+// ParseFilePriorityRule parses a rule of the form <glob>=<priority>
+func ParseFilePriorityRule(rule string) (FilePriorityRule, error) {
+	separator := strings.LastIndex(rule, "=")
+	if separator <= 0 {
+		return FilePriorityRule{}, fmt.Errorf("invalid priority rule %q, expected <glob>=<priority>", rule)
+	}
+
+	priority, err := ParseFilePriority(rule[separator+1:])
+	if err != nil {
+		return FilePriorityRule{}, err
+	}
+
+	return FilePriorityRule{Pattern: rule[:separator], Priority: priority}, nil
+}
+
+// Apply sets the priority of each file according to the selection
+func (s *FileSelection) Apply(files []fileEntry) error {
+	for _, pattern := range append(append([]string{}, s.Only...), s.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid file pattern %q: %w", pattern, err)
+		}
+	}
+	indices := make(map[int]bool, len(s.Indices))
+	for _, index := range s.Indices {
+		if index < 0 || index >= len(files) {
+			return fmt.Errorf("file index %d out of range (torrent has %d files)", index, len(files))
+		}
+		indices[index] = true
+	}
+
+	restricted := len(s.Only) > 0 || len(s.Indices) > 0
+	for i := range files {
+		selected := !restricted || matchesAny(files[i].path, s.Only) || indices[i]
+		if !selected || matchesAny(files[i].path, s.Exclude) {
+			files[i].priority = PrioritySkip
+			continue
+		}
+
+		files[i].priority = PriorityNormal
+		for _, rule := range s.Priorities {
+			if matchesGlob(files[i].path, rule.Pattern) {
+				files[i].priority = rule.Priority
+			}
+		}
+	}
+	return nil
+}
+
+// matchesGlob matches a file path against a pattern, patterns without a slash match the base name
+func matchesGlob(filePath, pattern string) bool {
+	if matched, _ := path.Match(pattern, filePath); matched {
+		return true
+	}
+	if !strings.Contains(pattern, "/") {
+		matched, _ := path.Match(pattern, path.Base(filePath))
+		return matched
+	}
+	return false
+}
+
+func matchesAny(filePath string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matchesGlob(filePath, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// piecePriorities returns the highest priority of the files overlapping each piece
+func piecePriorities(info *metainfo.Info, files []fileEntry) []FilePriority {
+	numPieces := info.NumPieces()
+	priorities := make([]FilePriority, numPieces)
+	pieceLength := int64(info.PieceLength)
+
+	for _, file := range files {
+		if file.length == 0 {
+			continue
+		}
+		first := int(file.offset / pieceLength)
+		last := int((file.offset + file.length - 1) / pieceLength)
+		for index := first; index <= last && index < numPieces; index++ {
+			priorities[index] = max(priorities[index], file.priority)
+		}
+	}
+	return priorities
+}
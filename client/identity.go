@@ -0,0 +1,150 @@
+package client
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/codecrafters-io/bittorrent-starter-go/peerwire"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Identity is how we present ourselves for a whole session: the same peer ID
+// goes to trackers and peers, and trackers also get a stable key and their own
+// tracker ID back so they can tell our announces belong together
+type Identity struct {
+	PeerID []byte
+	Key    string
+
+	mu         sync.Mutex
+	trackerIDs map[string]string // Announce URL to the tracker ID it sent
+	path       string            // File the identity is saved to, if any
+}
+
+// identityFile is the saved form of an identity
+type identityFile struct {
+	PeerID     string            `json:"peer_id"`
+	Key        string            `json:"key"`
+	TrackerIDs map[string]string `json:"tracker_ids,omitempty"`
+}
+
+// NewIdentity creates an identity with a peer ID starting with prefix
+func NewIdentity(prefix string) (*Identity, error) {
+	peerID, err := peerwire.GeneratePeerID(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	key := make([]byte, 4)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate tracker key: %w", err)
+	}
+
+	return &Identity{
+		PeerID:     peerID,
+		Key:        hex.EncodeToString(key),
+		trackerIDs: make(map[string]string),
+	}, nil
+}
+
+// LoadIdentity reads the identity saved at path, creating and saving a new one
+// if there is none yet or the saved peer ID doesn't start with prefix
+func LoadIdentity(path, prefix string) (*Identity, error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read identity: %w", err)
+	}
+
+	if err == nil {
+		identity, err := parseIdentity(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse identity %s: %w", path, err)
+		}
+		if bytes.HasPrefix(identity.PeerID, []byte(prefix)) {
+			identity.path = path
+			return identity, nil
+		}
+	}
+
+	identity, err := NewIdentity(prefix)
+	if err != nil {
+		return nil, err
+	}
+	identity.path = path
+	if err := identity.save(); err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+func parseIdentity(data []byte) (*Identity, error) {
+	var file identityFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+
+	peerID, err := hex.DecodeString(file.PeerID)
+	if err != nil || len(peerID) != peerwire.PeerIDLength {
+		return nil, fmt.Errorf("invalid peer id %q", file.PeerID)
+	}
+
+	identity := &Identity{PeerID: peerID, Key: file.Key, trackerIDs: file.TrackerIDs}
+	if identity.trackerIDs == nil {
+		identity.trackerIDs = make(map[string]string)
+	}
+	return identity, nil
+}
+
+// TrackerID returns the tracker ID to echo in announces to a tracker
+func (i *Identity) TrackerID(announceURL string) string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.trackerIDs[announceURL]
+}
+
+// SetTrackerID records the tracker ID a tracker sent in its response
+func (i *Identity) SetTrackerID(announceURL, trackerID string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if trackerID == "" || i.trackerIDs[announceURL] == trackerID {
+		return nil
+	}
+	i.trackerIDs[announceURL] = trackerID
+	return i.saveLocked()
+}
+
+func (i *Identity) save() error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.saveLocked()
+}
+
+func (i *Identity) saveLocked() error {
+	if i.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(identityFile{
+		PeerID:     hex.EncodeToString(i.PeerID),
+		Key:        i.Key,
+		TrackerIDs: i.trackerIDs,
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode identity: %w", err)
+	}
+
+	if dir := filepath.Dir(i.path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create identity directory: %w", err)
+		}
+	}
+	if err := os.WriteFile(i.path, data, 0600); err != nil {
+		return fmt.Errorf("failed to save identity: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,344 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/codecrafters-io/bittorrent-starter-go/metainfo"
+	"github.com/codecrafters-io/bittorrent-starter-go/peerwire"
+	bencode "github.com/jackpal/bencode-go"
+	"sync"
+	"sync/atomic"
+)
+
+// maxMetadataAttempts is the number of full downloads tried before giving up on hash mismatches
+const maxMetadataAttempts = 3
+
+// errMetadataHashMismatch reports assembled metadata that failed verification and was discarded
+var errMetadataHashMismatch = errors.New("metadata hash mismatch, retrying")
+
+// metadataFetcher assembles the info dictionary from pieces fetched from any number of peers
+type metadataFetcher struct {
+	mu       sync.Mutex
+	infoHash []byte
+	size     int
+	pieces   [][]byte
+	pending  []bool
+	attempts int
+	done     chan struct{}
+	info     *metainfo.Info
+	raw      []byte
+	err      error
+}
+
+func newMetadataFetcher(infoHash []byte) *metadataFetcher {
+	return &metadataFetcher{
+		infoHash: infoHash,
+		done:     make(chan struct{}),
+	}
+}
+
+// setSize records the metadata size announced by a peer, the first size seen wins
+func (f *metadataFetcher) setSize(size int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if size <= 0 || size > peerwire.MaxMetadataSize {
+		return fmt.Errorf("invalid metadata size %d", size)
+	}
+
+	if f.size == 0 {
+		f.size = size
+		f.reset()
+		return nil
+	}
+	if f.size != size {
+		return fmt.Errorf("peer metadata size %d does not match %d", size, f.size)
+	}
+	return nil
+}
+
+// reset discards every piece so the metadata is downloaded again
+func (f *metadataFetcher) reset() {
+	numPieces := peerwire.MetadataPieceCount(f.size)
+	f.pieces = make([][]byte, numPieces)
+	f.pending = make([]bool, numPieces)
+}
+
+// nextPiece returns a missing piece to request, preferring pieces no other peer
+// is fetching, or false once the metadata is complete
+func (f *metadataFetcher) nextPiece() (int, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.info != nil || f.err != nil {
+		return 0, false
+	}
+
+	fallback := -1
+	for i, piece := range f.pieces {
+		if piece != nil {
+			continue
+		}
+		if !f.pending[i] {
+			f.pending[i] = true
+			return i, true
+		}
+		if fallback == -1 {
+			fallback = i
+		}
+	}
+	return fallback, fallback >= 0
+}
+
+// release makes a piece available to other peers after a reject or failure
+func (f *metadataFetcher) release(piece int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if piece < len(f.pending) {
+		f.pending[piece] = false
+	}
+}
+
+// receive stores a piece and verifies the metadata once every piece has arrived
+func (f *metadataFetcher) receive(piece int, data []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.info != nil || f.err != nil {
+		return nil
+	}
+
+	numPieces := len(f.pieces)
+	if piece < 0 || piece >= numPieces {
+		return fmt.Errorf("metadata piece %d out of range", piece)
+	}
+
+	expected := peerwire.MetadataPieceSize
+	if piece == numPieces-1 {
+		expected = f.size - piece*peerwire.MetadataPieceSize
+	}
+	if len(data) != expected {
+		f.pending[piece] = false
+		return fmt.Errorf("metadata piece %d has %d bytes, expected %d", piece, len(data), expected)
+	}
+
+	f.pieces[piece] = data
+	for _, p := range f.pieces {
+		if p == nil {
+			return nil
+		}
+	}
+
+	raw := bytes.Join(f.pieces, nil)
+	hash := sha1.Sum(raw)
+	if !bytes.Equal(hash[:], f.infoHash) {
+		f.attempts++
+		if f.attempts >= maxMetadataAttempts {
+			f.err = fmt.Errorf("metadata hash mismatch after %d attempts", f.attempts)
+			close(f.done)
+			return f.err
+		}
+		f.reset()
+		return errMetadataHashMismatch
+	}
+
+	var info metainfo.Info
+	if err := bencode.Unmarshal(bytes.NewReader(raw), &info); err != nil {
+		f.err = fmt.Errorf("failed to unmarshal metadata: %w", err)
+		close(f.done)
+		return f.err
+	}
+	// The hash only proves the peer sent what the magnet link names, which
+	// can still be a malformed info dictionary
+	if err := info.Validate(); err != nil {
+		f.err = fmt.Errorf("invalid metadata: %w", err)
+		close(f.done)
+		return f.err
+	}
+
+	f.info = &info
+	f.raw = raw
+	close(f.done)
+	return nil
+}
+
+// fetchFrom requests missing pieces from one peer until the metadata is complete
+// or the peer rejects or fails a request
+func (f *metadataFetcher) fetchFrom(peerConn *peerwire.PeerConnection) error {
+	extension, ok := peerConn.Extension(peerwire.UTMetadataName).(*peerwire.MetadataExtension)
+	if !ok {
+		return fmt.Errorf("ut_metadata is not registered on the connection")
+	}
+
+	remoteID, ok := peerConn.RemoteExtensionID(peerwire.UTMetadataName)
+	if !ok {
+		return fmt.Errorf("peer does not support metadata exchange")
+	}
+	if err := f.setSize(peerConn.RemoteExtensions.MetadataSize); err != nil {
+		return err
+	}
+
+	for {
+		piece, ok := f.nextPiece()
+		if !ok {
+			return nil
+		}
+
+		if err := peerwire.SendMetadataRequest(peerConn.Conn, remoteID, piece); err != nil {
+			f.release(piece)
+			return fmt.Errorf("failed to send metadata request: %w", err)
+		}
+
+		response, data, err := extension.Receive(peerConn)
+		if err != nil {
+			f.release(piece)
+			return err
+		}
+
+		switch response.MessageType {
+		case peerwire.MetadataDataType:
+			if err := f.receive(response.Piece, data); err != nil {
+				f.release(piece)
+				return err
+			}
+			if response.Piece != piece {
+				f.release(piece)
+			}
+		case peerwire.MetadataRejectType:
+			f.release(piece)
+			return fmt.Errorf("peer rejected metadata piece %d", response.Piece)
+		default:
+			f.release(piece)
+		}
+	}
+}
+
+// result returns the verified info dictionary and its raw bencoded form
+func (f *metadataFetcher) result() (*metainfo.Info, []byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.err != nil {
+		return nil, nil, f.err
+	}
+	if f.info == nil {
+		return nil, nil, fmt.Errorf("metadata incomplete")
+	}
+	return f.info, f.raw, nil
+}
+
+// ReceiveMetadata fetches the complete metadata over a single connection
+func ReceiveMetadata(peerConn *peerwire.PeerConnection, infoHash []byte) (*metainfo.Info, error) {
+	fetcher := newMetadataFetcher(infoHash)
+
+	err := fetcher.fetchFrom(peerConn)
+	for errors.Is(err, errMetadataHashMismatch) {
+		err = fetcher.fetchFrom(peerConn)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	info, _, err := fetcher.result()
+	return info, err
+}
+
+// FetchMetadata downloads the metadata from several peers in parallel
+func FetchMetadata(ctx context.Context, infoHash []byte, peers []string, config Config) (*metainfo.Info, []byte, error) {
+	fetcher := newMetadataFetcher(infoHash)
+	stop := make(chan struct{})
+	defer close(stop)
+
+	// Workers take peers from the queue until one of them completes the
+	// metadata, so peers that fail early do not end the fetch
+	queue := make(chan string, len(peers))
+	for _, peerAddr := range peers {
+		queue <- peerAddr
+	}
+	close(queue)
+
+	var tried atomic.Int64
+	fetch := func(peerAddr string) {
+		tried.Add(1)
+		peerConn, err := peerwire.NewMagnetPeerConnection(ctx, peerAddr, infoHash, config.PeerConfig())
+		if err != nil {
+			return
+		}
+		defer peerConn.Conn.Close()
+
+		// Unblock pending reads once the metadata is complete or we give up
+		closed := make(chan struct{})
+		defer close(closed)
+		go func() {
+			select {
+			case <-fetcher.done:
+			case <-stop:
+			case <-ctx.Done():
+			case <-closed:
+			}
+			peerConn.Conn.Close()
+		}()
+
+		for {
+			err := fetcher.fetchFrom(peerConn)
+			if !errors.Is(err, errMetadataHashMismatch) {
+				return
+			}
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < min(len(peers), maxConcurrent); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for peerAddr := range queue {
+				select {
+				case <-fetcher.done:
+					return
+				case <-stop:
+					return
+				case <-ctx.Done():
+					return
+				default:
+				}
+				fetch(peerAddr)
+			}
+		}()
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-fetcher.done:
+	case <-finished:
+	case <-ctx.Done():
+		return nil, nil, fmt.Errorf("metadata fetch stopped: %w", ctx.Err())
+	}
+
+	info, raw, err := fetcher.result()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch metadata from %d peers: %w", tried.Load(), err)
+	}
+
+	config.logger("peer").Debug("metadata received",
+		"torrent", hex.EncodeToString(infoHash),
+		"name", info.Name,
+		"size", len(raw))
+	config.Events.publish(Event{
+		Type:     EventMetadataReceived,
+		InfoHash: hex.EncodeToString(infoHash),
+		Name:     info.Name,
+		Length:   len(raw),
+	})
+	return info, raw, nil
+}
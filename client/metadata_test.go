@@ -0,0 +1,35 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFetchMetadataTriesEveryPeer(t *testing.T) {
+	// Peers on a port nobody listens on fail straight away
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	peers := make([]string, 3*maxConcurrent)
+	for i := range peers {
+		peers[i] = addr
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	_, _, err = FetchMetadata(ctx, make([]byte, 20), peers, Config{})
+	if err == nil {
+		t.Fatalf("FetchMetadata succeeded without peers")
+	}
+	if want := fmt.Sprintf("from %d peers", len(peers)); !strings.Contains(err.Error(), want) {
+		t.Fatalf("error %q does not mention %q", err, want)
+	}
+}
@@ -0,0 +1,215 @@
+package client
+
+import (
+	"bytes"
+	"encoding/hex"
+	"github.com/codecrafters-io/bittorrent-starter-go/metrics"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// announceBuckets are the bounds in seconds of the announce duration histogram
+var announceBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// Metrics serves Prometheus metrics about downloads. Torrents and peers are
+// read on every scrape, tracker announces are counted from the event stream
+type Metrics struct {
+	cancel func()
+
+	mu       sync.Mutex
+	sources  []func() []torrentMetrics
+	trackers map[string]*trackerMetrics // By announce URL
+}
+
+// torrentMetrics is what a scrape reads from one torrent
+type torrentMetrics struct {
+	infoHash        string
+	name            string
+	stats           DownloadStats
+	choked          int // Connected peers choking us
+	unchoked        int
+	pendingRequests int
+}
+
+func newTorrentMetrics(infoHash, name string, stats DownloadStats, peers []PeerStats) torrentMetrics {
+	t := torrentMetrics{infoHash: infoHash, name: name, stats: stats}
+	for _, peer := range peers {
+		if peer.Choked {
+			t.choked++
+		} else {
+			t.unchoked++
+		}
+		t.pendingRequests += peer.PendingRequests
+	}
+	return t
+}
+
+type trackerMetrics struct {
+	errors   int64
+	duration *metrics.Histogram
+}
+
+// NewMetrics starts counting the tracker announces published to events, the
+// torrents to report are added with WatchClient and WatchDownload
+func NewMetrics(events *Events) *Metrics {
+	m := &Metrics{
+		cancel:   func() {},
+		trackers: make(map[string]*trackerMetrics),
+	}
+	if events == nil {
+		return m
+	}
+
+	ch, cancel := events.Subscribe()
+	m.cancel = cancel
+	go func() {
+		for event := range ch {
+			if event.Type == EventTrackerAnnounce {
+				m.observeAnnounce(event)
+			}
+		}
+	}()
+	return m
+}
+
+// WatchClient reports every torrent of a client
+func (m *Metrics) WatchClient(c *Client) {
+	m.watch(func() []torrentMetrics {
+		var torrents []torrentMetrics
+		for _, t := range c.Torrents() {
+			stats := t.Stats()
+			torrents = append(torrents, newTorrentMetrics(stats.InfoHash, stats.Name, stats.DownloadStats, t.Peers()))
+		}
+		return torrents
+	})
+}
+
+// WatchDownload reports a download running on its own
+func (m *Metrics) WatchDownload(d *Download) {
+	m.watch(func() []torrentMetrics {
+		return []torrentMetrics{newTorrentMetrics(hex.EncodeToString(d.infoHash), d.info.Name, d.Stats(), d.Peers())}
+	})
+}
+
+func (m *Metrics) watch(source func() []torrentMetrics) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sources = append(m.sources, source)
+}
+
+// Close stops counting tracker announces
+func (m *Metrics) Close() {
+	m.cancel()
+}
+
+func (m *Metrics) observeAnnounce(event Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tracker := m.trackers[event.Tracker]
+	if tracker == nil {
+		tracker = &trackerMetrics{duration: metrics.NewHistogram(announceBuckets...)}
+		m.trackers[event.Tracker] = tracker
+	}
+	tracker.duration.Observe(event.Duration.Seconds())
+	if event.Err != nil {
+		tracker.errors++
+	}
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	m.mu.Lock()
+	sources := slices.Clone(m.sources)
+	m.mu.Unlock()
+
+	var torrents []torrentMetrics
+	for _, source := range sources {
+		torrents = append(torrents, source()...)
+	}
+	slices.SortFunc(torrents, func(a, b torrentMetrics) int {
+		return strings.Compare(a.infoHash, b.infoHash)
+	})
+
+	var buf bytes.Buffer
+	writer := metrics.NewWriter(&buf)
+	writeTorrentMetrics(writer, torrents)
+	m.writeTrackerMetrics(writer)
+
+	writer.Family("flowstream_dht_nodes", metrics.TypeGauge, "Nodes in the DHT routing table, always 0 as DHT is not supported")
+	writer.Sample("flowstream_dht_nodes", 0)
+
+	if err := writer.Flush(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", metrics.ContentType)
+	w.Write(buf.Bytes())
+}
+
+func writeTorrentMetrics(w *metrics.Writer, torrents []torrentMetrics) {
+	w.Family("flowstream_torrent_info", metrics.TypeGauge, "Torrents being downloaded, labelled with their name")
+	for _, t := range torrents {
+		w.Sample("flowstream_torrent_info", 1, "torrent", t.infoHash, "name", t.name)
+	}
+
+	families := []struct {
+		name       string
+		metricType metrics.Type
+		help       string
+		value      func(t torrentMetrics) int64
+	}{
+		{"flowstream_torrent_downloaded_bytes_total", metrics.TypeCounter, "Piece data received, including pieces that failed verification",
+			func(t torrentMetrics) int64 { return t.stats.BytesDownloaded }},
+		{"flowstream_torrent_uploaded_bytes_total", metrics.TypeCounter, "Piece data sent to peers, always 0 as pieces are not uploaded",
+			func(t torrentMetrics) int64 { return 0 }},
+		{"flowstream_torrent_wanted_bytes", metrics.TypeGauge, "Length of the pieces overlapping the selected files",
+			func(t torrentMetrics) int64 { return t.stats.BytesWanted }},
+		{"flowstream_torrent_verified_bytes", metrics.TypeGauge, "Length of the wanted pieces verified and written",
+			func(t torrentMetrics) int64 { return t.stats.BytesDone }},
+		{"flowstream_torrent_piece_verification_failures_total", metrics.TypeCounter, "Pieces received that failed verification",
+			func(t torrentMetrics) int64 { return t.stats.PiecesFailed }},
+		{"flowstream_torrent_peers_connected", metrics.TypeGauge, "Open peer connections",
+			func(t torrentMetrics) int64 { return int64(t.stats.Peers) }},
+		{"flowstream_torrent_peers_choked", metrics.TypeGauge, "Connected peers choking us",
+			func(t torrentMetrics) int64 { return int64(t.choked) }},
+		{"flowstream_torrent_peers_unchoked", metrics.TypeGauge, "Connected peers not choking us",
+			func(t torrentMetrics) int64 { return int64(t.unchoked) }},
+		{"flowstream_torrent_request_queue_depth", metrics.TypeGauge, "Block requests sent to peers and waiting for their block",
+			func(t torrentMetrics) int64 { return int64(t.pendingRequests) }},
+	}
+	for _, family := range families {
+		w.Family(family.name, family.metricType, family.help)
+		for _, t := range torrents {
+			w.Sample(family.name, float64(family.value(t)), "torrent", t.infoHash)
+		}
+	}
+}
+
+func (m *Metrics) writeTrackerMetrics(w *metrics.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	urls := make([]string, 0, len(m.trackers))
+	for url := range m.trackers {
+		urls = append(urls, url)
+	}
+	slices.Sort(urls)
+
+	w.Family("flowstream_tracker_announce_duration_seconds", metrics.TypeHistogram, "Time taken by tracker announces, including failed ones")
+	for _, url := range urls {
+		w.Histogram("flowstream_tracker_announce_duration_seconds", m.trackers[url].duration, "tracker", url)
+	}
+
+	w.Family("flowstream_tracker_announce_errors_total", metrics.TypeCounter, "Tracker announces that failed")
+	for _, url := range urls {
+		w.Sample("flowstream_tracker_announce_errors_total", float64(m.trackers[url].errors), "tracker", url)
+	}
+}
@@ -0,0 +1,152 @@
+// Package client downloads and streams torrents from their peers
+package client
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"github.com/codecrafters-io/bittorrent-starter-go/peerwire"
+	"github.com/codecrafters-io/bittorrent-starter-go/tracker"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Config holds the settings for talking to trackers and peers
+type Config struct {
+	Encryption peerwire.EncryptionPolicy
+	Timeouts   peerwire.Timeouts
+	Identity   *Identity             // Shared by every tracker and peer connection of the session
+	Limiter    *peerwire.RateLimiter // Caps the download rate across connections, nil for no limit
+	Events     *Events               // Receives peer, piece and tracker events, nil to drop them
+	Logger     *slog.Logger          // Receives diagnostic records, nil for slog.Default
+	ListenPort int                   // Port incoming peers connect to, 0 when not listening
+}
+
+// DefaultConfig returns the settings used for downloads by default, the
+// identity has to be set before connecting
+func DefaultConfig() Config {
+	peerConfig := peerwire.DefaultConfig()
+	return Config{
+		Encryption: peerConfig.Encryption,
+		Timeouts:   peerConfig.Timeouts,
+	}
+}
+
+// PeerConfig returns the settings for peer connections, using the peer ID of
+// the session identity
+func (c Config) PeerConfig() peerwire.Config {
+	config := peerwire.Config{
+		Encryption: c.Encryption,
+		Timeouts:   c.Timeouts,
+		Limiter:    c.Limiter,
+		Logger:     c.Logger,
+		ListenPort: c.ListenPort,
+	}
+	if c.Identity != nil {
+		config.PeerID = c.Identity.PeerID
+	}
+	return config
+}
+
+// logger returns the logger for a subsystem such as tracker, peer or storage
+func (c Config) logger(subsystem string) *slog.Logger {
+	logger := c.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return logger.With("subsystem", subsystem)
+}
+
+// GetPeers announces to a tracker with the session identity and returns the peers it lists
+func GetPeers(ctx context.Context, announceURL string, infoHash []byte, left int, config Config) ([]string, error) {
+	response, err := announce(ctx, announceURL, tracker.Request{
+		InfoHash: infoHash,
+		Port:     peerwire.DefaultPort,
+		Left:     left,
+	}, config)
+	if err != nil {
+		return nil, err
+	}
+	return response.PeerAddrs(), nil
+}
+
+// announce fills in the session identity and sends the request, bounded by the request timeout
+func announce(ctx context.Context, announceURL string, request tracker.Request, config Config) (*tracker.Response, error) {
+	if config.Identity == nil {
+		return nil, fmt.Errorf("config has no identity")
+	}
+
+	if config.Timeouts.Request > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.Timeouts.Request)
+		defer cancel()
+	}
+
+	request.PeerID = config.Identity.PeerID
+	request.Key = config.Identity.Key
+	request.TrackerID = config.Identity.TrackerID(announceURL)
+	start := time.Now()
+	response, err := tracker.Announce(ctx, announceURL, request)
+	logger := config.logger("tracker").With("tracker", announceURL, "torrent", hex.EncodeToString(request.InfoHash))
+	event := Event{
+		Type:     EventTrackerAnnounce,
+		InfoHash: hex.EncodeToString(request.InfoHash),
+		Tracker:  announceURL,
+		Duration: time.Since(start),
+		Err:      err,
+	}
+	if err != nil {
+		logger.Info("announce failed", "event", request.Event, "err", err)
+		config.Events.publish(event)
+		return nil, err
+	}
+	event.Peers = len(response.PeerAddrs())
+	logger.Debug("announced", "event", request.Event, "peers", event.Peers, "interval", response.Interval)
+	config.Events.publish(event)
+
+	// Failing to save the identity doesn't affect this announce
+	config.Identity.SetTrackerID(announceURL, response.TrackerID)
+
+	return response, nil
+}
+
+// PeerIdentity is the client a peer runs, or why the handshake with it failed
+type PeerIdentity struct {
+	Addr   string
+	PeerID string // Hex encoded
+	Client peerwire.ClientInfo
+	Err    error
+}
+
+func (p PeerIdentity) String() string {
+	if p.Err != nil {
+		return fmt.Sprintf("unreachable: %v", p.Err)
+	}
+	return p.Client.String()
+}
+
+// IdentifyPeers handshakes with every peer in parallel to find the client each one runs
+func IdentifyPeers(ctx context.Context, peers []string, infoHash []byte, config Config) []PeerIdentity {
+	identities := make([]PeerIdentity, len(peers))
+
+	var wg sync.WaitGroup
+	for i, peerAddr := range peers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			identities[i].Addr = peerAddr
+			peerConn, err := peerwire.NewPeerConnection(ctx, peerAddr, infoHash, config.PeerConfig())
+			if err != nil {
+				identities[i].Err = err
+				return
+			}
+			peerConn.Conn.Close()
+			identities[i].PeerID = peerConn.PeerID
+			identities[i].Client = peerConn.Client
+		}()
+	}
+	wg.Wait()
+	return identities
+}
@@ -0,0 +1,330 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"slices"
+	"sync"
+)
+
+// PieceStrategy selects the order in which pieces of equal priority are downloaded
+type PieceStrategy int
+
+const (
+	// StrategyRandom spreads requests over the torrent, which keeps the swarm healthy
+	StrategyRandom PieceStrategy = iota
+	// StrategySequential downloads pieces in order, starting from the playhead
+	StrategySequential
+)
+
+// DefaultReadahead is the number of pieces after the playhead fetched before anything else
+const DefaultReadahead = 8
+
+type pieceState int
+
+const (
+	piecePending pieceState = iota
+	pieceInProgress
+	pieceDone
+	pieceUnwanted
+)
+
+// pieceQuery restricts and orders the pieces handed to one peer
+type pieceQuery struct {
+	available func(index int) bool // Pieces the peer can serve, nil means any
+	preferred func(index int) bool // Pieces favoured over others of equal priority, such as suggestions
+}
+
+// piecePicker hands out pieces to download workers, highest priority first
+type piecePicker struct {
+	mu         sync.Mutex
+	cond       *sync.Cond
+	pieces     []pieceWork
+	priorities []FilePriority
+	states     []pieceState
+	order      []int
+	strategy   PieceStrategy
+	playhead   int
+	readahead  int
+	remaining  int
+	closed     bool
+}
+
+func newPiecePicker(pieces []pieceWork, priorities []FilePriority) *piecePicker {
+	picker := &piecePicker{
+		pieces:     pieces,
+		priorities: priorities,
+		states:     make([]pieceState, len(pieces)),
+		order:      rand.Perm(len(pieces)),
+	}
+	picker.cond = sync.NewCond(&picker.mu)
+
+	for i := range pieces {
+		if priorities[i] == PrioritySkip {
+			picker.states[i] = pieceUnwanted
+			continue
+		}
+		picker.remaining++
+	}
+	return picker
+}
+
+// SetStrategy changes the piece order and the size of the read-ahead window
+func (p *piecePicker) SetStrategy(strategy PieceStrategy, readahead int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.strategy = strategy
+	p.readahead = readahead
+}
+
+// Next blocks until a piece matching the query is available and returns it,
+// or returns false once every wanted piece is done
+func (p *piecePicker) Next(query pieceQuery) (pieceWork, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for {
+		if p.remaining == 0 || p.closed {
+			return pieceWork{}, false
+		}
+
+		if index := p.pick(query); index >= 0 {
+			p.states[index] = pieceInProgress
+			return p.pieces[index], true
+		}
+
+		p.cond.Wait()
+	}
+}
+
+// TryNext returns a piece matching the query without waiting for one
+func (p *piecePicker) TryNext(query pieceQuery) (pieceWork, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.remaining == 0 || p.closed {
+		return pieceWork{}, false
+	}
+
+	index := p.pick(query)
+	if index < 0 {
+		return pieceWork{}, false
+	}
+	p.states[index] = pieceInProgress
+	return p.pieces[index], true
+}
+
+// pick returns the next pending piece to download matching the query, or -1
+func (p *piecePicker) pick(query pieceQuery) int {
+	numPieces := len(p.states)
+	pickable := func(i int) bool {
+		return p.states[i] == piecePending && (query.available == nil || query.available(i))
+	}
+	preferred := func(i int) bool {
+		return query.preferred != nil && query.preferred(i)
+	}
+
+	// Pieces inside the read-ahead window come first, in order
+	for i := p.playhead; i < min(p.playhead+p.readahead, numPieces); i++ {
+		if pickable(i) {
+			return i
+		}
+	}
+
+	best := -1
+	for k := 0; k < numPieces; k++ {
+		i := p.order[k]
+		if p.strategy == StrategySequential {
+			i = (p.playhead + k) % numPieces
+		}
+
+		if !pickable(i) {
+			continue
+		}
+		if best == -1 || p.priorities[i] > p.priorities[best] {
+			best = i
+			continue
+		}
+
+		// Preferences only break ties in random order, sequential order is kept for streaming
+		if p.strategy == StrategyRandom && p.priorities[i] == p.priorities[best] && preferred(i) && !preferred(best) {
+			best = i
+		}
+	}
+	return best
+}
+
+// Focus moves the playhead to a piece so it and the read-ahead window after it
+// are downloaded before anything else
+func (p *piecePicker) Focus(index int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.playhead = index
+	p.cond.Broadcast()
+}
+
+// WaitFor blocks until a piece has been downloaded and verified
+func (p *piecePicker) WaitFor(ctx context.Context, index int) error {
+	stop := context.AfterFunc(ctx, func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.cond.Broadcast()
+	})
+	defer stop()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for p.states[index] != pieceDone {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if p.closed {
+			return fmt.Errorf("download stopped before piece %d was verified", index)
+		}
+		p.cond.Wait()
+	}
+	return nil
+}
+
+// Complete marks a piece as downloaded and verified
+func (p *piecePicker) Complete(index int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.states[index] == pieceDone {
+		return
+	}
+	p.states[index] = pieceDone
+	p.remaining--
+	p.cond.Broadcast()
+}
+
+// Requeue returns a piece that failed to download to the pending set
+func (p *piecePicker) Requeue(index int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.states[index] == pieceInProgress {
+		p.release(index)
+		p.cond.Broadcast()
+	}
+}
+
+// release makes a piece that is no longer in progress pending again, or
+// unwanted if its files were skipped meanwhile
+func (p *piecePicker) release(index int) {
+	if p.priorities[index] == PrioritySkip {
+		p.states[index] = pieceUnwanted
+		p.remaining--
+		return
+	}
+	p.states[index] = piecePending
+}
+
+// SetPriorities changes the piece priorities. Pending pieces that are now
+// skipped are no longer wanted and unwanted ones that aren't become pending,
+// pieces in progress are decided once they are done or requeued
+func (p *piecePicker) SetPriorities(priorities []FilePriority) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.priorities = priorities
+	for i, priority := range priorities {
+		switch {
+		case priority == PrioritySkip && p.states[i] == piecePending:
+			p.states[i] = pieceUnwanted
+			p.remaining--
+		case priority != PrioritySkip && p.states[i] == pieceUnwanted:
+			p.states[i] = piecePending
+			p.remaining++
+		}
+	}
+	p.cond.Broadcast()
+}
+
+// NumPieces returns the number of pieces in the torrent
+func (p *piecePicker) NumPieces() int {
+	return len(p.pieces)
+}
+
+// Stopped reports whether the picker will hand out no more pieces
+func (p *piecePicker) Stopped() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.remaining == 0 || p.closed
+}
+
+// Remaining returns the number of wanted pieces not yet done
+func (p *piecePicker) Remaining() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.remaining
+}
+
+// Reopen hands out pieces again after Close, pieces that were in progress are
+// pending again as their workers have stopped
+func (p *piecePicker) Reopen() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = false
+	for i, state := range p.states {
+		if state == pieceInProgress {
+			p.release(i)
+		}
+	}
+}
+
+// Progress returns the number of wanted pieces and their length, and how much
+// of that is done
+func (p *piecePicker) Progress() (pieces, piecesDone int, bytes, bytesDone int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, state := range p.states {
+		if state == pieceUnwanted {
+			continue
+		}
+		pieces++
+		bytes += int64(p.pieces[i].length)
+		if state == pieceDone {
+			piecesDone++
+			bytesDone += int64(p.pieces[i].length)
+		}
+	}
+	return pieces, piecesDone, bytes, bytesDone
+}
+
+// Verified returns which pieces have been downloaded and verified
+func (p *piecePicker) Verified() []bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	verified := make([]bool, len(p.states))
+	for i, state := range p.states {
+		verified[i] = state == pieceDone
+	}
+	return verified
+}
+
+// States returns the state of every piece
+func (p *piecePicker) States() []pieceState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Clone(p.states)
+}
+
+// Close wakes every waiting worker and stops handing out pieces
+func (p *piecePicker) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+	p.cond.Broadcast()
+}
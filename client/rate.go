@@ -0,0 +1,47 @@
+package client
+
+import (
+	"sync"
+	"time"
+)
+
+// rateWindow is how many seconds of transfers a rate is averaged over
+const rateWindow = 5
+
+// rateMeter measures a transfer rate over the last few seconds
+type rateMeter struct {
+	mu      sync.Mutex
+	buckets [rateWindow]int64 // Bytes per second, indexed by Unix time modulo rateWindow
+	seconds [rateWindow]int64 // Unix time each bucket counts
+}
+
+// add counts n bytes transferred now
+func (m *rateMeter) add(n int64) {
+	now := time.Now().Unix()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := now % rateWindow
+	if m.seconds[i] != now {
+		m.seconds[i] = now
+		m.buckets[i] = 0
+	}
+	m.buckets[i] += n
+}
+
+// rate returns the average bytes per second over the window
+func (m *rateMeter) rate() int64 {
+	now := time.Now().Unix()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var total int64
+	for i, second := range m.seconds {
+		if now-second < rateWindow {
+			total += m.buckets[i]
+		}
+	}
+	return total / rateWindow
+}
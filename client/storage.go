@@ -0,0 +1,253 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"github.com/codecrafters-io/bittorrent-starter-go/metainfo"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+// PartFileName is where bytes of skipped files sharing a piece with wanted files are kept
+const PartFileName = ".flowstream.parts"
+
+// fileStorage maps piece data onto the files of a torrent on disk
+type fileStorage struct {
+	mu       sync.Mutex
+	files    []fileEntry
+	paths    []string
+	handles  map[int]*os.File
+	partPath string
+	partFile *os.File
+}
+
+// newFileStorage prepares storage rooted at outputPath, which names the file
+// itself for single-file torrents and the content directory otherwise
+func newFileStorage(outputPath string, info *metainfo.Info, files []fileEntry) (*fileStorage, error) {
+	storage := &fileStorage{
+		files:   slices.Clone(files), // Priorities change under our own lock
+		paths:   make([]string, len(files)),
+		handles: make(map[int]*os.File),
+	}
+
+	if len(info.Files) == 0 {
+		storage.paths[0] = outputPath
+		storage.partPath = filepath.Join(filepath.Dir(outputPath), PartFileName)
+	} else {
+		for i, file := range files {
+			storage.paths[i] = filepath.Join(append([]string{outputPath}, file.parts...)...)
+		}
+		storage.partPath = filepath.Join(outputPath, PartFileName)
+	}
+
+	// Zero length files never receive piece data, so create them up front
+	for i, file := range files {
+		if file.length == 0 && file.priority != PrioritySkip {
+			if _, err := storage.openFile(i); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return storage, nil
+}
+
+// WritePiece writes verified piece data starting at the given content offset
+func (s *fileStorage) WritePiece(offset int64, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.forEachSegment(offset, int64(len(data)), func(fileIndex int, fileOffset int64, start, end int64) error {
+		if s.files[fileIndex].priority == PrioritySkip {
+			partFile, err := s.openPartFile()
+			if err != nil {
+				return err
+			}
+			_, err = partFile.WriteAt(data[start:end], offset+start)
+			return err
+		}
+
+		file, err := s.openFile(fileIndex)
+		if err != nil {
+			return err
+		}
+		_, err = file.WriteAt(data[start:end], fileOffset)
+		return err
+	})
+}
+
+// SetPriority changes the priority of a file. When it starts or stops being
+// skipped, the bytes already written move between the file and the part file,
+// and a skipped file is removed from disk
+func (s *fileStorage) SetPriority(index int, priority FilePriority) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file := &s.files[index]
+	wasSkipped, skipped := file.priority == PrioritySkip, priority == PrioritySkip
+	if wasSkipped != skipped && file.length > 0 {
+		var err error
+		if skipped {
+			err = s.copyRange(s.paths[index], 0, s.partPath, file.offset, file.length)
+		} else {
+			err = s.copyRange(s.partPath, file.offset, s.paths[index], 0, file.length)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to move %s: %w", file.path, err)
+		}
+	}
+
+	file.priority = priority
+	switch {
+	case skipped && !wasSkipped:
+		return s.removeFile(index)
+	case file.length == 0 && !skipped:
+		_, err := s.openFile(index)
+		return err
+	}
+	return nil
+}
+
+// removeFile closes and deletes a file whose bytes now live in the part file
+func (s *fileStorage) removeFile(index int) error {
+	if file, ok := s.handles[index]; ok {
+		file.Close()
+		delete(s.handles, index)
+	}
+	if err := os.Remove(s.paths[index]); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove skipped %s: %w", s.files[index].path, err)
+	}
+	return nil
+}
+
+// copyRange copies up to length bytes between two files at the given offsets,
+// a missing or shorter source copies only what is there
+func (s *fileStorage) copyRange(srcPath string, srcOffset int64, dstPath string, dstOffset, length int64) error {
+	src, err := os.Open(srcPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dstPath), 0755); err != nil {
+		return err
+	}
+	dst, err := os.OpenFile(dstPath, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	_, err = io.Copy(io.NewOffsetWriter(dst, dstOffset), io.NewSectionReader(src, srcOffset, length))
+	return err
+}
+
+// ReadAt reads content bytes starting at the given content offset
+func (s *fileStorage) ReadAt(buf []byte, offset int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	read := 0
+	err := s.forEachSegment(offset, int64(len(buf)), func(fileIndex int, fileOffset int64, start, end int64) error {
+		var file *os.File
+		var err error
+		if s.files[fileIndex].priority == PrioritySkip {
+			file, err = s.openPartFile()
+			fileOffset = offset + start
+		} else {
+			file, err = s.openFile(fileIndex)
+		}
+		if err != nil {
+			return err
+		}
+
+		n, err := file.ReadAt(buf[start:end], fileOffset)
+		read += n
+		return err
+	})
+	if err == nil && read < len(buf) {
+		err = io.EOF
+	}
+	return read, err
+}
+
+// forEachSegment calls fn for each file overlapping [offset, offset+length),
+// with start and end relative to offset
+func (s *fileStorage) forEachSegment(offset, length int64, fn func(fileIndex int, fileOffset int64, start, end int64) error) error {
+	end := offset + length
+	for i, file := range s.files {
+		fileEnd := file.offset + file.length
+		if file.length == 0 || fileEnd <= offset || file.offset >= end {
+			continue
+		}
+
+		segmentStart := max(offset, file.offset)
+		segmentEnd := min(end, fileEnd)
+		if err := fn(i, segmentStart-file.offset, segmentStart-offset, segmentEnd-offset); err != nil {
+			return fmt.Errorf("storage access to %s: %w", file.path, err)
+		}
+	}
+	return nil
+}
+
+func (s *fileStorage) openFile(index int) (*os.File, error) {
+	if file, ok := s.handles[index]; ok {
+		return file, nil
+	}
+
+	path := s.paths[index]
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory for %s: %w", path, err)
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	s.handles[index] = file
+	return file, nil
+}
+
+func (s *fileStorage) openPartFile() (*os.File, error) {
+	if s.partFile != nil {
+		return s.partFile, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.partPath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory for part file: %w", err)
+	}
+
+	file, err := os.OpenFile(s.partPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open part file: %w", err)
+	}
+	s.partFile = file
+	return file, nil
+}
+
+// Close flushes and closes every open file
+func (s *fileStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var firstErr error
+	for index, file := range s.handles {
+		if err := file.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(s.handles, index)
+	}
+	if s.partFile != nil {
+		if err := s.partFile.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		s.partFile = nil
+	}
+	return firstErr
+}
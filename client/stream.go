@@ -0,0 +1,137 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// streamServer exposes the files of a download over HTTP while they download
+type streamServer struct {
+	download *Download
+}
+
+// NewStreamServer serves the files of a download over HTTP with Range support,
+// reads block until the pieces they touch are verified
+func NewStreamServer(download *Download) http.Handler {
+	return &streamServer{download: download}
+}
+
+func (s *streamServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	filePath := strings.TrimPrefix(r.URL.Path, "/")
+	if filePath == "" {
+		s.serveIndex(w)
+		return
+	}
+
+	for i, file := range s.download.files {
+		if file.path == filePath && file.priority != PrioritySkip {
+			reader := s.download.newFileReader(r.Context(), i)
+			http.ServeContent(w, r, path.Base(file.path), time.Time{}, reader)
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+// serveIndex lists the streamable files
+func (s *streamServer) serveIndex(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintln(w, "<!DOCTYPE html><ul>")
+	for _, file := range s.download.files {
+		if file.priority == PrioritySkip {
+			continue
+		}
+		fmt.Fprintf(w, "<li><a href=\"/%s\">%s</a> (%d bytes)</li>\n", streamURLPath(file.path), html.EscapeString(file.path), file.length)
+	}
+	fmt.Fprintln(w, "</ul>")
+}
+
+// streamURLPath escapes each component of a torrent file path for use in a URL
+func streamURLPath(filePath string) string {
+	parts := strings.Split(filePath, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return strings.Join(parts, "/")
+}
+
+// fileReader reads one file of a download, blocking until the pieces it needs are verified
+type fileReader struct {
+	ctx      context.Context
+	download *Download
+	file     fileEntry
+	position int64
+}
+
+func (d *Download) newFileReader(ctx context.Context, fileIndex int) *fileReader {
+	return &fileReader{
+		ctx:      ctx,
+		download: d,
+		file:     d.files[fileIndex],
+	}
+}
+
+func (r *fileReader) Read(buf []byte) (int, error) {
+	if r.position >= r.file.length {
+		return 0, io.EOF
+	}
+
+	offset := r.file.offset + r.position
+	piece := r.download.pieceAt(offset)
+
+	// Move the read-ahead window here before waiting so the piece is fetched next
+	r.download.picker.Focus(piece.index)
+	if err := r.download.picker.WaitFor(r.ctx, piece.index); err != nil {
+		return 0, err
+	}
+
+	available := min(piece.offset+int64(piece.length), r.file.offset+r.file.length) - offset
+	if int64(len(buf)) > available {
+		buf = buf[:available]
+	}
+
+	n, err := r.download.storage.ReadAt(buf, offset)
+	r.position += int64(n)
+	if errors.Is(err, io.EOF) && n == len(buf) {
+		err = nil
+	}
+	return n, err
+}
+
+func (r *fileReader) Seek(offset int64, whence int) (int64, error) {
+	var position int64
+	switch whence {
+	case io.SeekStart:
+		position = offset
+	case io.SeekCurrent:
+		position = r.position + offset
+	case io.SeekEnd:
+		position = r.file.length + offset
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+
+	if position < 0 {
+		return 0, fmt.Errorf("negative position %d", position)
+	}
+	r.position = position
+	return position, nil
+}
+
+// pieceAt returns the piece containing the given content offset
+func (d *Download) pieceAt(offset int64) pieceWork {
+	return d.pieces[int(offset/int64(d.info.PieceLength))]
+}
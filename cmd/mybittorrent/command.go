@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Exit statuses
+const (
+	exitOK    = 0
+	exitError = 1 // The command failed
+	exitUsage = 2 // The command line was invalid
+)
+
+// runFunc runs a command with the positional arguments left after its flags
+type runFunc func(ctx context.Context, args []string) error
+
+// command is a subcommand of the CLI
+type command struct {
+	name    string
+	aliases []string
+	args    string // Positional arguments shown in the usage line
+	summary string
+	minArgs int
+	maxArgs int // -1 for no limit
+
+	// setup defines the command's flags and returns the function running it
+	setup func(flags *flag.FlagSet) runFunc
+}
+
+// usageError reports arguments that are invalid in a way flag parsing can't catch
+type usageError struct {
+	message string
+}
+
+func (e *usageError) Error() string {
+	return e.message
+}
+
+func usageErrorf(format string, args ...any) error {
+	return &usageError{message: fmt.Sprintf(format, args...)}
+}
+
+// findCommand looks up a command by name or alias
+func findCommand(name string) (*command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name || slices.Contains(cmd.aliases, name) {
+			return cmd, true
+		}
+	}
+	return nil, false
+}
+
+// flagSet creates the command's flags, printing errors and usage to stderr
+func (c *command) flagSet() (*flag.FlagSet, runFunc) {
+	flags := flag.NewFlagSet(c.name, flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	run := c.setup(flags)
+
+	flags.Usage = func() {
+		hasFlags := false
+		flags.VisitAll(func(*flag.Flag) { hasFlags = true })
+
+		usage := c.name
+		if hasFlags {
+			usage += " [flags]"
+		}
+		fmt.Fprintf(os.Stderr, "Usage: mybittorrent %s %s\n\n%s\n", usage, c.args, c.summary)
+		if len(c.aliases) > 0 {
+			fmt.Fprintf(os.Stderr, "\nAliases: %s\n", strings.Join(c.aliases, ", "))
+		}
+
+		if hasFlags {
+			fmt.Fprintln(os.Stderr, "\nFlags:")
+			flags.PrintDefaults()
+		}
+	}
+	return flags, run
+}
+
+// execute parses the command line of the command, runs it and returns the exit status
+func (c *command) execute(ctx context.Context, args []string) int {
+	flags, run := c.flagSet()
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	if flags.NArg() < c.minArgs || (c.maxArgs >= 0 && flags.NArg() > c.maxArgs) {
+		fmt.Fprintf(os.Stderr, "mybittorrent %s: wrong number of arguments\n", c.name)
+		flags.Usage()
+		return exitUsage
+	}
+
+	if err := run(ctx, flags.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "mybittorrent %s: %v\n", c.name, err)
+
+		var usageErr *usageError
+		if errors.As(err, &usageErr) {
+			flags.Usage()
+			return exitUsage
+		}
+		return exitError
+	}
+	return exitOK
+}
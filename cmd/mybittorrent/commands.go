@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/codecrafters-io/bittorrent-starter-go/bencode"
+	"github.com/codecrafters-io/bittorrent-starter-go/client"
+	"github.com/codecrafters-io/bittorrent-starter-go/magnet"
+	"github.com/codecrafters-io/bittorrent-starter-go/metainfo"
+	"github.com/codecrafters-io/bittorrent-starter-go/peerwire"
+	"time"
+)
+
+// Example:
+// - 5:hello -> hello
+// - 10:hello12345 -> hello12345
+func decodeCommand(flags *flag.FlagSet) runFunc {
+	binary := flags.String("binary", "hex", "encoding of byte strings that aren't valid UTF-8: hex or base64")
+
+	return func(ctx context.Context, args []string) error {
+		encode, ok := binaryEncodings[*binary]
+		if !ok {
+			return usageErrorf("invalid --binary %q: use hex or base64", *binary)
+		}
+
+		startIndex := 0
+		decoded, err := bencode.Decode(args[0], &startIndex)
+		if err != nil {
+			return err
+		}
+
+		jsonOutput, err := json.Marshal(encodeBinaryStrings(decoded, encode))
+		if err != nil {
+			return fmt.Errorf("failed to encode JSON: %w", err)
+		}
+		fmt.Println(string(jsonOutput))
+		return nil
+	}
+}
+
+func infoCommand(flags *flag.FlagSet) runFunc {
+	jsonOutput := addJSONFlag(flags)
+
+	return func(ctx context.Context, args []string) error {
+		torrent, infoHash, err := readTorrent(args[0])
+		if err != nil {
+			return err
+		}
+
+		if *jsonOutput {
+			return printJSON(newTorrentJSON(torrent, infoHash))
+		}
+		printTorrentDetails(torrent, infoHash)
+		return nil
+	}
+}
+
+func peersCommand(flags *flag.FlagSet) runFunc {
+	identify := flags.Bool("identify", false, "handshake with each peer to show the client it runs")
+	jsonOutput := addJSONFlag(flags)
+
+	return func(ctx context.Context, args []string) error {
+		config, err := plaintextConfig()
+		if err != nil {
+			return err
+		}
+
+		torrent, infoHash, err := readTorrent(args[0])
+		if err != nil {
+			return err
+		}
+
+		peers, err := client.GetPeers(ctx, torrent.Announce, infoHash, torrent.Info.TotalLength(), config)
+		if err != nil {
+			return fmt.Errorf("failed to get peers: %w", err)
+		}
+
+		if *jsonOutput {
+			output := peersJSON{InfoHash: newInfoHashJSON(infoHash), Peers: make([]peerJSON, len(peers))}
+			for i, peer := range peers {
+				output.Peers[i] = peerJSON{Address: peer}
+			}
+			if *identify {
+				for i, identity := range client.IdentifyPeers(ctx, peers, infoHash, config) {
+					output.Peers[i] = newPeerJSON(identity)
+				}
+			}
+			return printJSON(output)
+		}
+
+		if *identify {
+			printIdentifiedPeers(client.IdentifyPeers(ctx, peers, infoHash, config))
+			return nil
+		}
+		printPeers(peers)
+		return nil
+	}
+}
+
+func handshakeCommand(flags *flag.FlagSet) runFunc {
+	jsonOutput := addJSONFlag(flags)
+
+	return func(ctx context.Context, args []string) error {
+		config, err := plaintextConfig()
+		if err != nil {
+			return err
+		}
+
+		_, infoHash, err := readTorrent(args[0])
+		if err != nil {
+			return err
+		}
+
+		peerConnection, err := peerwire.NewPeerConnection(ctx, args[1], infoHash, config.PeerConfig())
+		if err != nil {
+			return err
+		}
+		defer peerConnection.Conn.Close()
+
+		if *jsonOutput {
+			return printJSON(newHandshakeJSON(peerConnection, args[1]))
+		}
+		fmt.Printf("Info Hash: %x\n", infoHash)
+		fmt.Printf("Peer ID: %s\n", peerConnection.PeerID)
+		fmt.Printf("Peer Client: %s\n", peerConnection.Client)
+		return nil
+	}
+}
+
+func createCommand(flags *flag.FlagSet) runFunc {
+	var trackers, webSeeds stringListFlag
+	outputFile := flags.String("o", "", "output torrent file (default <name>.torrent)")
+	pieceLength := flags.Int("piece-length", 0, "piece length in bytes (default chosen from content size)")
+	private := flags.Bool("private", false, "mark the torrent as private")
+	comment := flags.String("comment", "", "torrent comment")
+	createdBy := flags.String("created-by", metainfo.DefaultCreatedBy, "creating program name")
+	noDate := flags.Bool("no-date", false, "omit the creation date")
+	source := flags.String("source", "", "source tag added to the info dictionary")
+	flags.Var(&trackers, "announce", "tracker announce URL (repeatable)")
+	flags.Var(&webSeeds, "web-seed", "web seed URL (repeatable)")
+
+	return func(ctx context.Context, args []string) error {
+		builder := metainfo.NewBuilder(args[0]).
+			WithPieceLength(*pieceLength).
+			WithTrackers(trackers).
+			WithWebSeeds(webSeeds).
+			WithComment(*comment).
+			WithCreatedBy(*createdBy).
+			WithPrivate(*private).
+			WithSource(*source).
+			WithProgress(printCreateProgress)
+		if *noDate {
+			builder.WithCreationDate(time.Time{})
+		}
+
+		torrent, err := builder.Build()
+		if err != nil {
+			return fmt.Errorf("failed to create torrent: %w", err)
+		}
+
+		if *outputFile == "" {
+			*outputFile = torrent.Info.Name + ".torrent"
+		}
+
+		if err := metainfo.WriteFile(*outputFile, torrent); err != nil {
+			return fmt.Errorf("failed to save torrent: %w", err)
+		}
+
+		infoHash, err := torrent.Info.Hash()
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Created %s.\n", *outputFile)
+		fmt.Printf("Info Hash: %x\n", infoHash)
+		fmt.Printf("Magnet Link: %s\n", magnet.New(infoHash, torrent.Info.Name, trackers))
+		return nil
+	}
+}
+
+func magnetParseCommand(flags *flag.FlagSet) runFunc {
+	jsonOutput := addJSONFlag(flags)
+
+	return func(ctx context.Context, args []string) error {
+		magnetLink, infoHash, err := parseMagnet(args[0])
+		if err != nil {
+			return err
+		}
+
+		if *jsonOutput {
+			return printJSON(newMagnetJSON(magnetLink, infoHash))
+		}
+
+		fmt.Printf("Tracker URL: %s\n", magnetLink.TrackerURL)
+		fmt.Printf("Info Hash: %s\n", magnetLink.InfoHash)
+		return nil
+	}
+}
+
+func magnetHandshakeCommand(flags *flag.FlagSet) runFunc {
+	jsonOutput := addJSONFlag(flags)
+
+	return func(ctx context.Context, args []string) error {
+		config, err := plaintextConfig()
+		if err != nil {
+			return err
+		}
+
+		peerConnection, _, err := connectMagnetPeer(ctx, args[0], config)
+		if err != nil {
+			return err
+		}
+		defer peerConnection.Conn.Close()
+
+		if *jsonOutput {
+			return printJSON(newHandshakeJSON(peerConnection, peerConnection.Conn.RemoteAddr().String()))
+		}
+		fmt.Printf("Peer ID: %s\n", peerConnection.PeerID)
+		if id, ok := peerConnection.RemoteExtensionID(peerwire.UTMetadataName); ok {
+			fmt.Printf("Peer Metadata Extension ID: %d\n", id)
+		}
+		fmt.Printf("Peer Client: %s\n", peerConnection.Client)
+		return nil
+	}
+}
+
+func magnetInfoCommand(flags *flag.FlagSet) runFunc {
+	jsonOutput := addJSONFlag(flags)
+
+	return func(ctx context.Context, args []string) error {
+		config, err := plaintextConfig()
+		if err != nil {
+			return err
+		}
+
+		magnetLink, _, err := parseMagnet(args[0])
+		if err != nil {
+			return err
+		}
+		if !*jsonOutput {
+			fmt.Printf("Tracker URL: %s\n", magnetLink.TrackerURL)
+		}
+
+		peerConnection, infoHash, err := connectMagnetPeer(ctx, args[0], config)
+		if err != nil {
+			return err
+		}
+		defer peerConnection.Conn.Close()
+
+		if !peerConnection.SupportsExtension(peerwire.UTMetadataName) {
+			return fmt.Errorf("peer does not support metadata exchange")
+		}
+
+		metadata, err := client.ReceiveMetadata(peerConnection, infoHash)
+		if err != nil {
+			return fmt.Errorf("failed to receive metadata: %w", err)
+		}
+
+		if *jsonOutput {
+			output := newInfoJSON(metadata, infoHash)
+			output.Trackers = newMagnetJSON(magnetLink, infoHash).Trackers
+			return printJSON(output)
+		}
+		fmt.Printf("Info Hash: %s\n", magnetLink.InfoHash)
+		printTorrentInfo(metadata)
+		return nil
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/codecrafters-io/bittorrent-starter-go/api"
+	"github.com/codecrafters-io/bittorrent-starter-go/client"
+	"github.com/codecrafters-io/bittorrent-starter-go/peerwire"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Timeouts of our HTTP servers, so slow clients can't hold connections open.
+// Responses get no write timeout as streams run as long as the player reads
+const (
+	httpReadHeaderTimeout = 10 * time.Second
+	httpReadTimeout       = time.Minute
+	httpIdleTimeout       = 2 * time.Minute
+)
+
+// newHTTPServer creates a server for handler with our request timeouts
+func newHTTPServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: httpReadHeaderTimeout,
+		ReadTimeout:       httpReadTimeout,
+		IdleTimeout:       httpIdleTimeout,
+	}
+}
+
+func daemonCommand(flags *flag.FlagSet) runFunc {
+	apiAddr := flags.String("api", DefaultAPIAddr, "address the HTTP API listens on")
+	tokenFile := flags.String("token-file", defaultTokenFile(), "file holding the API token, created if missing")
+	dataDir := flags.String("data-dir", ".", "directory torrents are saved into")
+	listenAddr := flags.String("listen", fmt.Sprintf(":%d", peerwire.DefaultPort), "address for incoming TCP and uTP peers, empty to not listen")
+	maxConnections := flags.Int("max-connections", client.DefaultMaxConnections, "peer connections across all torrents (0 for no limit)")
+	downloadRate := flags.Int("download-rate", 0, "download limit in bytes per second across all torrents (0 for no limit)")
+	metricsAddr := addMetricsFlag(flags)
+	peerOptions := addPeerFlags(flags)
+
+	return func(ctx context.Context, args []string) error {
+		config, err := peerOptions.Config()
+		if err != nil {
+			return fmt.Errorf("failed to set up session: %w", err)
+		}
+
+		token, err := api.LoadOrCreateToken(*tokenFile)
+		if err != nil {
+			return err
+		}
+
+		c, err := client.NewClientBuilder().
+			WithConfig(config).
+			WithDataDir(*dataDir).
+			WithListenAddr(*listenAddr).
+			WithMaxConnections(*maxConnections).
+			WithDownloadRate(*downloadRate).
+			Build()
+		if err != nil {
+			return fmt.Errorf("failed to start client: %w", err)
+		}
+		defer c.Close()
+
+		metrics, err := startMetrics(ctx, *metricsAddr, c.Events())
+		if err != nil {
+			return err
+		}
+		if metrics != nil {
+			defer metrics.Close()
+			metrics.WatchClient(c)
+		}
+
+		listener, err := net.Listen("tcp", *apiAddr)
+		if err != nil {
+			return fmt.Errorf("failed to listen for API requests: %w", err)
+		}
+
+		handler, err := api.NewServer(c, token)
+		if err != nil {
+			return err
+		}
+		server := newHTTPServer(handler)
+		go func() {
+			<-ctx.Done()
+			server.Shutdown(context.Background())
+		}()
+
+		fmt.Printf("API listening on http://%s/ with the token in %s.\n", listener.Addr(), *tokenFile)
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			return fmt.Errorf("failed to serve API: %w", err)
+		}
+		return nil
+	}
+}
+
+func addCommand(flags *flag.FlagSet) runFunc {
+	paused := flags.Bool("paused", false, "add without starting the download")
+	remote := addRemoteFlags(flags)
+
+	return func(ctx context.Context, args []string) error {
+		daemon, err := remote.Client()
+		if err != nil {
+			return err
+		}
+
+		for _, source := range args {
+			request := api.AddRequest{Paused: *paused}
+			if isMagnet(source) {
+				request.Magnet = source
+			} else if request.Torrent, err = os.ReadFile(source); err != nil {
+				return fmt.Errorf("failed to read torrent: %w", err)
+			}
+
+			torrent, err := daemon.Add(ctx, request)
+			if err != nil {
+				return fmt.Errorf("failed to add %s: %w", source, err)
+			}
+			fmt.Printf("Added %s (%s).\n", torrent.Name, torrent.InfoHash)
+		}
+		return nil
+	}
+}
+
+func listCommand(flags *flag.FlagSet) runFunc {
+	jsonOutput := addJSONFlag(flags)
+	remote := addRemoteFlags(flags)
+
+	return func(ctx context.Context, args []string) error {
+		daemon, err := remote.Client()
+		if err != nil {
+			return err
+		}
+
+		torrents, err := daemon.Torrents(ctx)
+		if err != nil {
+			return err
+		}
+
+		if *jsonOutput {
+			return printJSON(torrents)
+		}
+		printTorrentList(torrents)
+		return nil
+	}
+}
+
+func statusCommand(flags *flag.FlagSet) runFunc {
+	jsonOutput := addJSONFlag(flags)
+	remote := addRemoteFlags(flags)
+
+	return func(ctx context.Context, args []string) error {
+		daemon, err := remote.Client()
+		if err != nil {
+			return err
+		}
+
+		torrent, err := daemon.Torrent(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		files, err := daemon.Files(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		peers, err := daemon.Peers(ctx, args[0])
+		if err != nil {
+			return err
+		}
+
+		if *jsonOutput {
+			return printJSON(torrentStatusJSON{Torrent: *torrent, Files: files, Peers: peers})
+		}
+		printTorrentStatus(torrent, files, peers)
+		return nil
+	}
+}
+
+// torrentControlCommand returns the setup of a command applying an action to
+// every torrent named on the command line
+func torrentControlCommand(action func(ctx context.Context, daemon *api.Client, infoHash string) (string, error)) func(*flag.FlagSet) runFunc {
+	return func(flags *flag.FlagSet) runFunc {
+		remote := addRemoteFlags(flags)
+
+		return func(ctx context.Context, args []string) error {
+			daemon, err := remote.Client()
+			if err != nil {
+				return err
+			}
+
+			for _, infoHash := range args {
+				message, err := action(ctx, daemon, infoHash)
+				if err != nil {
+					return fmt.Errorf("%s: %w", infoHash, err)
+				}
+				fmt.Println(message)
+			}
+			return nil
+		}
+	}
+}
+
+var (
+	pauseCommand = torrentControlCommand(func(ctx context.Context, daemon *api.Client, infoHash string) (string, error) {
+		torrent, err := daemon.Pause(ctx, infoHash)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Paused %s (%s).", torrent.Name, torrent.State), nil
+	})
+
+	resumeCommand = torrentControlCommand(func(ctx context.Context, daemon *api.Client, infoHash string) (string, error) {
+		torrent, err := daemon.Resume(ctx, infoHash)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Resumed %s (%s).", torrent.Name, torrent.State), nil
+	})
+
+	removeCommand = torrentControlCommand(func(ctx context.Context, daemon *api.Client, infoHash string) (string, error) {
+		if err := daemon.Remove(ctx, infoHash); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Removed %s.", infoHash), nil
+	})
+)
+
+func priorityCommand(flags *flag.FlagSet) runFunc {
+	remote := addRemoteFlags(flags)
+
+	return func(ctx context.Context, args []string) error {
+		var priorities []api.FilePriority
+		for _, arg := range args[1:] {
+			indexText, priority, ok := strings.Cut(arg, "=")
+			index, err := strconv.Atoi(indexText)
+			if !ok || err != nil {
+				return usageErrorf("invalid file priority %q, expected <file-index>=<priority>", arg)
+			}
+			if _, err := client.ParseFilePriority(priority); err != nil {
+				return usageErrorf("%v", err)
+			}
+			priorities = append(priorities, api.FilePriority{Index: index, Priority: priority})
+		}
+
+		daemon, err := remote.Client()
+		if err != nil {
+			return err
+		}
+
+		files, err := daemon.SetFilePriorities(ctx, args[0], priorities)
+		if err != nil {
+			return err
+		}
+		printFiles(files)
+		return nil
+	}
+}
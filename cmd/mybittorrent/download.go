@@ -1,175 +1,311 @@
 package main
 
 import (
-	"bytes"
-	"crypto/sha1"
+	"context"
+	"flag"
 	"fmt"
-	"math"
-	"sync"
+	"github.com/codecrafters-io/bittorrent-starter-go/client"
+	"github.com/codecrafters-io/bittorrent-starter-go/magnet"
+	"github.com/codecrafters-io/bittorrent-starter-go/metainfo"
+	"github.com/codecrafters-io/bittorrent-starter-go/peerwire"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 )
 
-const (
-	maxRetries    = 3 // Maximum retries for piece download
-	maxConcurrent = 5 // Maximum concurrent piece downloads
-)
+func downloadPieceCommand(flags *flag.FlagSet) runFunc {
+	outputFile := flags.String("o", "", "output file (default piece-<index>)")
 
-type pieceWork struct {
-	index  int
-	length int
-	hash   []byte
-	offset int64
-}
+	return func(ctx context.Context, args []string) error {
+		pieceIndex, err := strconv.Atoi(args[1])
+		if err != nil || pieceIndex < 0 {
+			return usageErrorf("invalid piece index %q", args[1])
+		}
+		if *outputFile == "" {
+			*outputFile = "piece-" + args[1]
+		}
 
-func DownloadPiece(peerConn *PeerConnection, torrentInfo *TorrentInfo, pieceIndex int) ([]byte, error) {
-	if err := setupConnection(peerConn); err != nil {
-		return nil, fmt.Errorf("Failed to establish connection: %w", err)
+		config, err := plaintextConfig()
+		if err != nil {
+			return err
+		}
 
-	}
+		var peerConnection *peerwire.PeerConnection
+		var info *metainfo.Info
+		if isMagnet(args[0]) {
+			var infoHash []byte
+			peerConnection, infoHash, err = connectMagnetPeer(ctx, args[0], config)
+			if err != nil {
+				return err
+			}
+			defer peerConnection.Conn.Close()
 
-	pieceLength := calculatePieceLength(torrentInfo, pieceIndex)
-	return downloadPiece(peerConn, pieceIndex, pieceLength)
-}
+			info, err = client.ReceiveMetadata(peerConnection, infoHash)
+			if err != nil {
+				return fmt.Errorf("failed to receive metadata: %w", err)
+			}
+		} else {
+			torrent, infoHash, err := readTorrent(args[0])
+			if err != nil {
+				return err
+			}
+			info = &torrent.Info
 
-func downloadPiece(peerConn *PeerConnection, pieceIndex int, pieceLength int) ([]byte, error) {
-	numBlocks := int(math.Ceil(float64(pieceLength) / float64(BlockSize)))
-	pieceData := make([]byte, pieceLength)
+			peers, err := client.GetPeers(ctx, torrent.Announce, infoHash, info.TotalLength(), config)
+			if err != nil {
+				return fmt.Errorf("failed to get peers: %w", err)
+			}
 
-	for blockIndex := 0; blockIndex < numBlocks; blockIndex++ {
-		begin := blockIndex * BlockSize
-		length := calculateBlockLength(begin, BlockSize, pieceLength)
+			peerConnection, err = connectAnyPeer(ctx, peers, infoHash, config)
+			if err != nil {
+				return err
+			}
+			defer peerConnection.Conn.Close()
+		}
 
-		if err := downloadBlock(peerConn, pieceIndex, begin, length, pieceData); err != nil {
-			return nil, fmt.Errorf("download block %d: %w", blockIndex, err)
+		if pieceIndex >= info.NumPieces() {
+			return fmt.Errorf("piece index %d out of range (torrent has %d pieces)", pieceIndex, info.NumPieces())
 		}
-		fmt.Printf("Block %d downloaded.\n", blockIndex)
-	}
 
-	return pieceData, nil
-}
+		pieceData, err := client.DownloadPiece(peerConnection, info, pieceIndex)
+		if err != nil {
+			return fmt.Errorf("failed to download piece: %w", err)
+		}
 
-func DownloadFile(torrentInfo *TorrentInfo, peers []string, infoHash []byte) ([]byte, error) {
-	if len(peers) == 0 {
-		return nil, fmt.Errorf("no peers available")
+		if err := os.WriteFile(*outputFile, pieceData, 0644); err != nil {
+			return fmt.Errorf("failed to write piece to disk: %w", err)
+		}
+
+		fmt.Printf("Piece %d downloaded to %s.\n", pieceIndex, *outputFile)
+		return nil
 	}
+}
+
+func downloadCommand(flags *flag.FlagSet) runFunc {
+	outputPath := flags.String("o", "", "output file, or directory for multi-file torrents (default the torrent name)")
+	selection := addSelectionFlags(flags)
+	metricsAddr := addMetricsFlag(flags)
+	progressMode := addProgressFlag(flags)
+	peerOptions := addPeerFlags(flags)
+
+	return func(ctx context.Context, args []string) error {
+		live, err := liveProgress(*progressMode)
+		if err != nil {
+			return err
+		}
+
+		config, err := peerOptions.Config()
+		if err != nil {
+			return fmt.Errorf("failed to set up session: %w", err)
+		}
+		progress, stopProgress := showProgress(config.Events, live)
+		defer stopProgress()
+
+		metrics, err := startMetrics(ctx, *metricsAddr, config.Events)
+		if err != nil {
+			return err
+		}
+		if metrics != nil {
+			defer metrics.Close()
+		}
+
+		info, infoHash, peers, selectOnly, err := loadTorrentOrMagnet(ctx, args[0], config)
+		if err != nil {
+			return err
+		}
+		selection.Indices = append(selection.Indices, selectOnly...)
 
-	workQueue := make(chan pieceWork, len(torrentInfo.Pieces)/20)
-	results := make(chan pieceWork, len(torrentInfo.Pieces)/20)
+		if *outputPath == "" {
+			*outputPath = info.Name
+		}
 
-	// Initialize work queue with piece offsets
-	initializeWorkQueue(torrentInfo, workQueue)
+		download, err := client.NewDownload(info, infoHash, *outputPath, selection)
+		if err != nil {
+			return fmt.Errorf("failed to prepare download: %w", err)
+		}
+		defer download.Close()
+		download.SetConfig(config)
+		if metrics != nil {
+			metrics.WatchDownload(download)
+		}
+		progress.watch(download)
 
-	// Start workers
-	var workers sync.WaitGroup
-	numWorkers := min(len(peers), maxConcurrent)
-	for i := 0; i < numWorkers; i++ {
-		workers.Add(1)
-		go func(peerAddr string) {
-			defer workers.Done()
-			worker(peerAddr, infoHash, workQueue, results)
-		}(peers[i])
+		if err := download.Run(ctx, peers); err != nil {
+			return fmt.Errorf("failed to download: %w", err)
+		}
+
+		stopProgress()
+		fmt.Printf("Downloaded %s to %s.\n", info.Name, *outputPath)
+		return nil
 	}
+}
 
-	// Close results when all workers are done
-	go func() {
-		workers.Wait()
-		close(results)
-	}()
+func streamCommand(flags *flag.FlagSet) runFunc {
+	outputDir := flags.String("o", "", "directory to download into (default a new temporary directory)")
+	addr := flags.String("addr", DefaultStreamAddr, "address for the HTTP server")
+	readahead := flags.Int("readahead", client.DefaultReadahead, "pieces fetched ahead of the read position")
+	peerOptions := addPeerFlags(flags)
 
-	// Collect and assemble results
-	fileData := make([]byte, torrentInfo.Length)
-	var downloaded int
-	numPieces := len(torrentInfo.Pieces) / 20
+	return func(ctx context.Context, args []string) error {
+		config, err := peerOptions.Config()
+		if err != nil {
+			return fmt.Errorf("failed to set up session: %w", err)
+		}
+		stopEvents := printEvents(config.Events)
+		defer stopEvents()
 
-	for piece := range results {
-		copy(fileData[piece.offset:], piece.hash)
-		downloaded++
-		if downloaded == numPieces {
-			break
+		info, infoHash, peers, selectOnly, err := loadTorrentOrMagnet(ctx, args[0], config)
+		if err != nil {
+			return err
 		}
+
+		if *outputDir == "" {
+			*outputDir, err = os.MkdirTemp("", "flowstream-")
+			if err != nil {
+				return fmt.Errorf("failed to create download directory: %w", err)
+			}
+		}
+
+		download, err := client.NewDownload(info, infoHash, filepath.Join(*outputDir, info.Name), &client.FileSelection{Indices: selectOnly})
+		if err != nil {
+			return fmt.Errorf("failed to prepare download: %w", err)
+		}
+		defer download.Close()
+		download.SetStrategy(client.StrategySequential, *readahead)
+		download.SetConfig(config)
+
+		go func() {
+			if err := download.Run(ctx, peers); err != nil {
+				slog.Error("download failed", "err", err)
+				return
+			}
+			stopEvents()
+			fmt.Printf("Downloaded %s to %s.\n", info.Name, *outputDir)
+		}()
+
+		server := newHTTPServer(client.NewStreamServer(download))
+		server.Addr = *addr
+		go func() {
+			<-ctx.Done()
+			server.Shutdown(context.Background())
+		}()
+
+		fmt.Printf("Streaming %s on http://%s/\n", info.Name, *addr)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			return fmt.Errorf("failed to serve stream: %w", err)
+		}
+		return nil
 	}
+}
 
-	return fileData, nil
+// isMagnet reports whether a torrent argument is a magnet link rather than a file
+func isMagnet(source string) bool {
+	return strings.HasPrefix(source, "magnet:")
 }
 
-func worker(peerAddr string, infoHash []byte, workQueue chan pieceWork, results chan pieceWork) {
-	peerConn, err := NewPeerConnection(peerAddr, infoHash)
+// readTorrent reads a torrent file and computes its info hash
+func readTorrent(path string) (*metainfo.Torrent, []byte, error) {
+	torrent, err := metainfo.ReadFile(path)
 	if err != nil {
-		return
+		return nil, nil, err
 	}
-	defer peerConn.Conn.Close()
 
-	if err := setupConnection(peerConn); err != nil {
-		return
+	infoHash, err := torrent.Info.Hash()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to calculate info hash: %w", err)
 	}
+	return torrent, infoHash, nil
+}
 
-	for work := range workQueue {
-		for retry := 0; retry < maxRetries; retry++ {
-			pieceData, err := downloadPiece(peerConn, work.index, work.length)
-			if err != nil {
-				continue
-			}
+// parseMagnet parses a magnet link and decodes its info hash
+func parseMagnet(uri string) (*magnet.Link, []byte, error) {
+	magnetLink, err := magnet.Parse(uri)
+	if err != nil {
+		return nil, nil, usageErrorf("invalid magnet link: %v", err)
+	}
 
-			if verifyPiece(pieceData, work.hash) {
-				work.hash = pieceData // Store the actual data in the hash field
-				results <- work
-				fmt.Printf("Piece %d downloaded and verified.\n", work.index)
-				break
-			}
-		}
+	infoHash, err := magnetLink.InfoHashBytes()
+	if err != nil {
+		return nil, nil, usageErrorf("invalid magnet link: %v", err)
 	}
+	return magnetLink, infoHash, nil
 }
 
-func initializeWorkQueue(torrentInfo *TorrentInfo, workQueue chan pieceWork) {
-	numPieces := len(torrentInfo.Pieces) / 20
-	var offset int64
+// connectMagnetPeer connects to the first peer of a magnet link's tracker,
+// completing the extension handshake
+func connectMagnetPeer(ctx context.Context, uri string, config client.Config) (*peerwire.PeerConnection, []byte, error) {
+	magnetLink, infoHash, err := parseMagnet(uri)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	for i := 0; i < numPieces; i++ {
-		pieceLength := calculatePieceLength(torrentInfo, i)
-		work := pieceWork{
-			index:  i,
-			length: pieceLength,
-			hash:   []byte(torrentInfo.Pieces[i*20 : (i+1)*20]),
-			offset: offset,
-		}
-		offset += int64(pieceLength)
-		workQueue <- work
+	peers, err := client.GetPeers(ctx, magnetLink.TrackerURL, infoHash, 16384, config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get peers: %w", err)
+	}
+	if len(peers) == 0 {
+		return nil, nil, fmt.Errorf("no peers available")
 	}
-	close(workQueue)
+
+	peerConnection, err := peerwire.NewMagnetPeerConnection(ctx, peers[0], infoHash, config.PeerConfig())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to peer: %w", err)
+	}
+	return peerConnection, infoHash, nil
 }
 
-func calculatePieceLength(torrentInfo *TorrentInfo, pieceIndex int) int {
-	totalPieces := (torrentInfo.Length + torrentInfo.PieceLength - 1) / torrentInfo.PieceLength
-	if pieceIndex == totalPieces-1 {
-		lastPieceSize := torrentInfo.Length % torrentInfo.PieceLength
-		if lastPieceSize != 0 {
-			return lastPieceSize
+// connectAnyPeer connects to the first peer that completes a handshake
+func connectAnyPeer(ctx context.Context, peers []string, infoHash []byte, config client.Config) (*peerwire.PeerConnection, error) {
+	if len(peers) == 0 {
+		return nil, fmt.Errorf("no peers available")
+	}
+
+	for _, peerAddr := range peers {
+		peerConnection, err := peerwire.NewPeerConnection(ctx, peerAddr, infoHash, config.PeerConfig())
+		if err == nil {
+			return peerConnection, nil
 		}
+		slog.Info("failed to connect to peer", "peer", peerAddr, "err", err)
 	}
-	return torrentInfo.PieceLength
+	return nil, fmt.Errorf("unable to connect to any of %d peers", len(peers))
 }
 
-func calculateBlockLength(begin, blockSize, pieceLength int) int {
-	if begin+blockSize > pieceLength {
-		return pieceLength - begin
+// loadTorrentOrMagnet reads a torrent file or fetches the metadata for a magnet
+// link, returning the info dictionary, info hash, peers and magnet file selection
+func loadTorrentOrMagnet(ctx context.Context, source string, config client.Config) (*metainfo.Info, []byte, []string, []int, error) {
+	if !isMagnet(source) {
+		torrent, infoHash, err := readTorrent(source)
+		if err != nil {
+			return nil, nil, nil, nil, err
+		}
+
+		peers, err := client.GetPeers(ctx, torrent.Announce, infoHash, torrent.Info.TotalLength(), config)
+		if err != nil {
+			return nil, nil, nil, nil, fmt.Errorf("failed to get peers: %w", err)
+		}
+		return &torrent.Info, infoHash, peers, nil, nil
 	}
-	return blockSize
-}
 
-func downloadBlock(peerConn *PeerConnection, pieceIndex, begin, length int, pieceData []byte) error {
-	if err := sendRequest(peerConn.Conn, uint32(pieceIndex), uint32(begin), uint32(length)); err != nil {
-		return err
+	magnetLink, infoHash, err := parseMagnet(source)
+	if err != nil {
+		return nil, nil, nil, nil, err
 	}
 
-	blockData, err := receiveBlock(peerConn.Conn)
+	peers, err := client.GetPeers(ctx, magnetLink.TrackerURL, infoHash, 16384, config)
 	if err != nil {
-		return err
+		return nil, nil, nil, nil, fmt.Errorf("failed to get peers: %w", err)
+	}
+	if len(peers) == 0 {
+		return nil, nil, nil, nil, fmt.Errorf("no peers available")
 	}
 
-	copy(pieceData[begin:], blockData)
-	return nil
-}
+	metadata, _, err := client.FetchMetadata(ctx, infoHash, peers, config)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("failed to receive metadata: %w", err)
+	}
 
-func verifyPiece(pieceData []byte, expectedHash []byte) bool {
-	hash := sha1.Sum(pieceData)
-	return bytes.Equal(hash[:], expectedHash)
+	return metadata, infoHash, peers, magnetLink.SelectOnly, nil
 }
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"flag"
+	"github.com/codecrafters-io/bittorrent-starter-go/api"
+	"github.com/codecrafters-io/bittorrent-starter-go/client"
+	"github.com/codecrafters-io/bittorrent-starter-go/peerwire"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// addSelectionFlags adds the flags picking which files of a torrent to download
+func addSelectionFlags(flags *flag.FlagSet) *client.FileSelection {
+	selection := &client.FileSelection{}
+
+	flags.Var((*stringListFlag)(&selection.Only), "only", "download only files matching the glob (repeatable)")
+	flags.Var((*stringListFlag)(&selection.Exclude), "exclude", "skip files matching the glob (repeatable)")
+	flags.Func("priority", "set <glob>=skip|low|normal|high for matching files (repeatable)", func(value string) error {
+		rule, err := client.ParseFilePriorityRule(value)
+		if err != nil {
+			return err
+		}
+		selection.Priorities = append(selection.Priorities, rule)
+		return nil
+	})
+
+	return selection
+}
+
+// addJSONFlag adds the flag switching a command's output to JSON
+func addJSONFlag(flags *flag.FlagSet) *bool {
+	return flags.Bool("json", false, "print machine-readable JSON instead of text")
+}
+
+// peerFlags holds the command line settings for peer connections
+type peerFlags struct {
+	config       client.Config
+	peerIDPrefix string
+	identityFile string
+}
+
+// addPeerFlags adds the flags controlling peer connections to a command
+func addPeerFlags(flags *flag.FlagSet) *peerFlags {
+	options := &peerFlags{config: client.DefaultConfig(), peerIDPrefix: peerwire.DefaultPeerIDPrefix}
+	config := &options.config
+
+	flags.Var(&config.Encryption, "encryption", "peer encryption: prefer, require or disable")
+	flags.StringVar(&options.peerIDPrefix, "peer-id-prefix", options.peerIDPrefix, "client prefix of our peer ID, such as -FS0100-")
+	flags.StringVar(&options.identityFile, "identity-file", "", "file keeping our peer ID and tracker key across runs")
+	flags.DurationVar(&config.Timeouts.Connect, "connect-timeout", config.Timeouts.Connect, "time allowed to connect to a peer (0 for no limit)")
+	flags.DurationVar(&config.Timeouts.Handshake, "handshake-timeout", config.Timeouts.Handshake, "time allowed for the handshakes with a peer (0 for no limit)")
+	flags.DurationVar(&config.Timeouts.Request, "request-timeout", config.Timeouts.Request, "time allowed for a peer or tracker to answer a request (0 for no limit)")
+	flags.DurationVar(&config.Timeouts.Snub, "snub-timeout", config.Timeouts.Snub, "time without a requested block before moving requests to other peers (0 for no limit)")
+	flags.DurationVar(&config.Timeouts.Idle, "idle-timeout", config.Timeouts.Idle, "time before dropping a silent peer or one keeping us choked (0 for no limit)")
+
+	return options
+}
+
+// Config returns the parsed settings with the identity for this session,
+// loaded from the identity file if one was given
+func (f *peerFlags) Config() (client.Config, error) {
+	var identity *client.Identity
+	var err error
+	if f.identityFile != "" {
+		identity, err = client.LoadIdentity(f.identityFile, f.peerIDPrefix)
+	} else {
+		identity, err = client.NewIdentity(f.peerIDPrefix)
+	}
+	if err != nil {
+		return client.Config{}, err
+	}
+
+	config := f.config
+	config.Identity = identity
+	config.Events = client.NewEvents()
+	return config, nil
+}
+
+// plaintextConfig is used by the single peer commands, which talk plain BitTorrent
+func plaintextConfig() (client.Config, error) {
+	identity, err := client.NewIdentity(peerwire.DefaultPeerIDPrefix)
+	if err != nil {
+		return client.Config{}, err
+	}
+
+	config := client.DefaultConfig()
+	config.Encryption = peerwire.EncryptionDisable
+	config.Identity = identity
+	return config, nil
+}
+
+// remoteFlags holds how the thin client commands reach the daemon
+type remoteFlags struct {
+	addr      string
+	tokenFile string
+}
+
+// addRemoteFlags adds the flags locating the daemon's API to a command
+func addRemoteFlags(flags *flag.FlagSet) *remoteFlags {
+	options := &remoteFlags{}
+	flags.StringVar(&options.addr, "api", DefaultAPIAddr, "address of the daemon's API")
+	flags.StringVar(&options.tokenFile, "token-file", defaultTokenFile(), "file holding the daemon's API token")
+	return options
+}
+
+// Client returns an API client authenticated with the daemon's token
+func (f *remoteFlags) Client() (*api.Client, error) {
+	token, err := api.ReadToken(f.tokenFile)
+	if err != nil {
+		return nil, err
+	}
+	return api.NewClient(f.addr, token), nil
+}
+
+// defaultTokenFile is where the daemon saves its API token, in the user's
+// config directory when there is one
+func defaultTokenFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ".flowstream-token"
+	}
+	return filepath.Join(dir, "flowstream", "token")
+}
+
+// stringListFlag collects the values of a repeatable command line flag
+type stringListFlag []string
+
+func (s *stringListFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringListFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/codecrafters-io/bittorrent-starter-go/api"
+	"github.com/codecrafters-io/bittorrent-starter-go/client"
+	"github.com/codecrafters-io/bittorrent-starter-go/magnet"
+	"github.com/codecrafters-io/bittorrent-starter-go/metainfo"
+	"github.com/codecrafters-io/bittorrent-starter-go/peerwire"
+	"path"
+	"slices"
+	"unicode/utf8"
+)
+
+// The types below are the --json output schema. Fields are only ever added,
+// so scripts can rely on the existing ones
+
+// infoHashJSON holds the info hashes of a torrent. V2 is null as BitTorrent v2
+// torrents aren't supported yet
+type infoHashJSON struct {
+	V1 string  `json:"v1"`
+	V2 *string `json:"v2"`
+}
+
+type fileJSON struct {
+	Path   string `json:"path"` // Joined with "/"
+	Length int    `json:"length"`
+}
+
+type torrentJSON struct {
+	InfoHash     infoHashJSON `json:"info_hash"`
+	Name         string       `json:"name"`
+	Length       int          `json:"length"`
+	PieceLength  int          `json:"piece_length"`
+	Private      bool         `json:"private"`
+	Source       string       `json:"source,omitempty"`
+	Files        []fileJSON   `json:"files"`
+	PieceHashes  []string     `json:"piece_hashes"`
+	Trackers     []string     `json:"trackers"`
+	WebSeeds     []string     `json:"web_seeds"`
+	Comment      string       `json:"comment,omitempty"`
+	CreatedBy    string       `json:"created_by,omitempty"`
+	CreationDate int64        `json:"creation_date,omitempty"` // Unix time
+}
+
+type peerJSON struct {
+	Address string `json:"address"`
+	PeerID  string `json:"peer_id,omitempty"` // Hex encoded
+	Client  string `json:"client,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+type peersJSON struct {
+	InfoHash infoHashJSON `json:"info_hash"`
+	Peers    []peerJSON   `json:"peers"`
+}
+
+type capabilitiesJSON struct {
+	Extensions bool `json:"extensions"`
+	Fast       bool `json:"fast"`
+}
+
+type handshakeJSON struct {
+	InfoHash            infoHashJSON     `json:"info_hash"`
+	Peer                peerJSON         `json:"peer"`
+	Capabilities        capabilitiesJSON `json:"capabilities"`
+	MetadataExtensionID *int             `json:"metadata_extension_id,omitempty"`
+}
+
+type magnetJSON struct {
+	InfoHash   infoHashJSON `json:"info_hash"`
+	Name       string       `json:"name,omitempty"`
+	Trackers   []string     `json:"trackers"`
+	SelectOnly []int        `json:"select_only"`
+}
+
+// torrentStatusJSON is the status of a torrent in the daemon with its files and peers
+type torrentStatusJSON struct {
+	api.Torrent
+	Files []api.File `json:"files"`
+	Peers []api.Peer `json:"peers"`
+}
+
+// printJSON writes a value to stdout as indented JSON
+func printJSON(v any) error {
+	output, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode JSON: %w", err)
+	}
+	fmt.Println(string(output))
+	return nil
+}
+
+func newInfoHashJSON(infoHash []byte) infoHashJSON {
+	return infoHashJSON{V1: hex.EncodeToString(infoHash)}
+}
+
+// newInfoJSON describes an info dictionary, leaving out what only the
+// surrounding torrent file knows
+func newInfoJSON(info *metainfo.Info, infoHash []byte) torrentJSON {
+	files := make([]fileJSON, 0, max(len(info.Files), 1))
+	if len(info.Files) == 0 {
+		files = append(files, fileJSON{Path: info.Name, Length: info.Length})
+	}
+	for _, file := range info.Files {
+		files = append(files, fileJSON{Path: path.Join(file.Path...), Length: file.Length})
+	}
+
+	pieceHashes := make([]string, info.NumPieces())
+	for i := range pieceHashes {
+		pieceHashes[i] = hex.EncodeToString(info.PieceHash(i))
+	}
+
+	return torrentJSON{
+		InfoHash:    newInfoHashJSON(infoHash),
+		Name:        info.Name,
+		Length:      info.TotalLength(),
+		PieceLength: info.PieceLength,
+		Private:     info.Private == 1,
+		Source:      info.Source,
+		Files:       files,
+		PieceHashes: pieceHashes,
+		Trackers:    []string{},
+		WebSeeds:    []string{},
+	}
+}
+
+func newTorrentJSON(torrent *metainfo.Torrent, infoHash []byte) torrentJSON {
+	output := newInfoJSON(&torrent.Info, infoHash)
+	output.Trackers = trackerURLs(torrent)
+	if torrent.URLList != nil {
+		output.WebSeeds = torrent.URLList
+	}
+	output.Comment = torrent.Comment
+	output.CreatedBy = torrent.CreatedBy
+	output.CreationDate = torrent.CreationDate
+	return output
+}
+
+// trackerURLs flattens the announce URL and every tier of announce-list,
+// dropping duplicates
+func trackerURLs(torrent *metainfo.Torrent) []string {
+	trackers := []string{}
+	add := func(url string) {
+		if url != "" && !slices.Contains(trackers, url) {
+			trackers = append(trackers, url)
+		}
+	}
+
+	add(torrent.Announce)
+	for _, tier := range torrent.AnnounceList {
+		for _, url := range tier {
+			add(url)
+		}
+	}
+	return trackers
+}
+
+func newPeerJSON(identity client.PeerIdentity) peerJSON {
+	if identity.Err != nil {
+		return peerJSON{Address: identity.Addr, Error: identity.Err.Error()}
+	}
+	return peerJSON{Address: identity.Addr, PeerID: identity.PeerID, Client: identity.Client.String()}
+}
+
+func newHandshakeJSON(peerConn *peerwire.PeerConnection, peerAddr string) handshakeJSON {
+	output := handshakeJSON{
+		InfoHash: newInfoHashJSON(peerConn.InfoHash),
+		Peer:     peerJSON{Address: peerAddr, PeerID: peerConn.PeerID, Client: peerConn.Client.String()},
+		Capabilities: capabilitiesJSON{
+			Extensions: peerConn.Capabilities.Extensions,
+			Fast:       peerConn.Capabilities.Fast,
+		},
+	}
+	if id, ok := peerConn.RemoteExtensionID(peerwire.UTMetadataName); ok {
+		metadataID := int(id)
+		output.MetadataExtensionID = &metadataID
+	}
+	return output
+}
+
+func newMagnetJSON(magnetLink *magnet.Link, infoHash []byte) magnetJSON {
+	output := magnetJSON{
+		InfoHash:   newInfoHashJSON(infoHash),
+		Name:       magnetLink.Name,
+		Trackers:   []string{},
+		SelectOnly: []int{},
+	}
+	if magnetLink.Trackers != nil {
+		output.Trackers = magnetLink.Trackers
+	} else if magnetLink.TrackerURL != "" {
+		output.Trackers = []string{magnetLink.TrackerURL}
+	}
+	if magnetLink.SelectOnly != nil {
+		output.SelectOnly = magnetLink.SelectOnly
+	}
+	return output
+}
+
+// binaryEncodings maps the --binary values of decode to their encoders
+var binaryEncodings = map[string]func([]byte) string{
+	"hex":    hex.EncodeToString,
+	"base64": base64.StdEncoding.EncodeToString,
+}
+
+// encodeBinaryStrings replaces the byte strings of a decoded bencode value that
+// aren't valid UTF-8, such as piece hashes, so they survive JSON encoding
+func encodeBinaryStrings(value any, encode func([]byte) string) any {
+	switch v := value.(type) {
+	case string:
+		if utf8.ValidString(v) {
+			return v
+		}
+		return encode([]byte(v))
+	case []interface{}:
+		list := make([]any, len(v))
+		for i, item := range v {
+			list[i] = encodeBinaryStrings(item, encode)
+		}
+		return list
+	case map[string]interface{}:
+		dict := make(map[string]any, len(v))
+		for key, item := range v {
+			dict[encodeBinaryStrings(key, encode).(string)] = encodeBinaryStrings(item, encode)
+		}
+		return dict
+	default:
+		return value
+	}
+}
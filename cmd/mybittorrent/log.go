@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// logFlags holds the global flags controlling diagnostic logging
+type logFlags struct {
+	verbose bool
+	level   string
+	format  string
+}
+
+// addLogFlags adds the logging flags, which go before the command
+func addLogFlags(flags *flag.FlagSet) *logFlags {
+	options := &logFlags{}
+	flags.BoolVar(&options.verbose, "v", false, "log debug records, same as --log-level debug")
+	flags.StringVar(&options.level, "log-level", "warn", "lowest level logged: debug, info, warn or error")
+	flags.StringVar(&options.format, "log-format", "text", "log record format: text or json")
+	return options
+}
+
+// Logger returns a logger writing to stderr, keeping stdout for command output
+func (f *logFlags) Logger() (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(f.level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q", f.level)
+	}
+	if f.verbose {
+		level = slog.LevelDebug
+	}
+
+	options := &slog.HandlerOptions{Level: level}
+	switch f.format {
+	case "text":
+		return slog.New(slog.NewTextHandler(os.Stderr, options)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(os.Stderr, options)), nil
+	}
+	return nil, fmt.Errorf("invalid log format %q, expected text or json", f.format)
+}
@@ -1,454 +1,120 @@
 package main
 
 import (
-	"encoding/hex"
-	"encoding/json"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"log/slog"
 	"os"
-	"path/filepath"
-	"strconv"
+	"os/signal"
+	"syscall"
 )
 
-// Example:
-// - 5:hello -> hello
-// - 10:hello12345 -> hello12345
-
-func main() {
-	// You can use print statements as follows for debugging, they'll be visible when running tests.
-
-	command := os.Args[1]
-	args := os.Args[2:]
-	startIndex := 0
-
-	switch command {
-	case "decode":
-		bencodedValue := os.Args[2]
-
-		decoded, err := Decode(bencodedValue, &startIndex)
-		if err != nil {
-			fmt.Println(err)
-			return
-		}
-
-		jsonOutput, _ := json.Marshal(decoded)
-		fmt.Println(string(jsonOutput))
-
-	case "info":
-		torrentFile := os.Args[2]
-
-		torrent, err := readTorrentFile(torrentFile)
-
-		if err != nil {
-			fmt.Println(err)
-			return
-		}
-
-		infoHash, err := calculateInfoHash(&torrent.Info)
-
-		if err != nil {
-			fmt.Println(err)
-			return
-		}
-
-		printTorrentDetails(torrent, infoHash)
-
-	case "peers":
-		torrentFile := os.Args[2]
-
-		torrent, err := readTorrentFile(torrentFile)
-
-		if err != nil {
-			fmt.Println(err)
-			return
-		}
-
-		infoHash, err := calculateInfoHash(&torrent.Info)
-
-		if err != nil {
-			fmt.Println(err)
-			return
-		}
-
-		peers, err := getPeers(torrent.Announce, infoHash, torrent.Info.Length)
-
-		if err != nil {
-			fmt.Println(err)
-			return
-		}
-
-		printPeers(peers)
-
-	case "handshake":
-		torrentFile := os.Args[2]
-		peerAddr := os.Args[3]
-
-		torrent, err := readTorrentFile(torrentFile)
-
-		if err != nil {
-			fmt.Println(err)
-			return
-		}
-
-		infoHash, err := calculateInfoHash(&torrent.Info)
-
-		fmt.Printf("Info Hash: %x\n", infoHash)
-
-		if err != nil {
-			fmt.Println(err)
-			return
-		}
-
-		peerConnection, err := NewPeerConnection(peerAddr, infoHash)
-
-		if err != nil {
-			fmt.Println(err)
-			return
-		}
-
-		fmt.Printf("Peer ID: %s\n", peerConnection.PeerID)
-	case "download_piece":
-		var torrentFile string
-		var outputFile string
-		var pieceIndexStr string
-
-		if args[0] == "-o" {
-			outputFile = args[1]
-			torrentFile = args[2]
-			pieceIndexStr = args[3]
-		} else {
-			torrentFile = args[0]
-			pieceIndexStr = args[1]
-			outputFile = "piece-" + pieceIndexStr
-		}
-
-		pieceIndex, err := strconv.Atoi(pieceIndexStr)
-		if err != nil {
-			fmt.Println("Invalid piece index:", err)
-			return
-		}
-
-		torrent, err := readTorrentFile(torrentFile)
-		if err != nil {
-			fmt.Println("Error reading torrent file:", err)
-			return
-		}
-
-		infoHash, err := calculateInfoHash(&torrent.Info)
-		if err != nil {
-			fmt.Println("Error calculating info hash:", err)
-			return
-		}
-
-		peers, err := getPeers(torrent.Announce, infoHash, torrent.Info.Length)
-		if err != nil {
-			fmt.Println("Error getting peers:", err)
-			return
-		}
-
-		if len(peers) == 0 {
-			fmt.Println("No peers available")
-			return
-		}
-
-		var peerConnection *PeerConnection
-
-		for _, peerAddr := range peers {
-			peerConnection, err = NewPeerConnection(peerAddr, infoHash)
-			if err == nil {
-				// Successfully connected to a peer
-				break
-			}
-			fmt.Printf("Failed to connect to peer %s: %v\n", peerAddr, err)
-		}
-
-		if peerConnection == nil {
-			fmt.Println("Error: Unable to connect to any peers")
-			return
-		}
-
-		fmt.Printf("Successfully connected to peer: %s\n", peerConnection.PeerID)
-
-		fmt.Printf("Output file: %s\n", outputFile)
-
-		pieceData, err := DownloadPiece(peerConnection, &torrent.Info, pieceIndex)
-		if err != nil {
-			fmt.Println("Error downloading piece:", err)
-			return
-		}
-
-		if err := os.WriteFile(outputFile, pieceData, 0644); err != nil {
-			fmt.Printf("Failed to write piece to disk: %s\n", err)
-			return
-		}
-
-		fmt.Printf("Piece %d downloaded to %s.\n", pieceIndex, outputFile)
-
-	case "download":
-		var outputFile string
-		var torrentFile string
-		if args[0] == "-o" {
-			outputFile = args[1]
-			torrentFile = args[2]
-		} else {
-			fmt.Println("Invalid arguments for download command")
-			return
-		}
-
-		torrent, err := readTorrentFile(torrentFile)
-		if err != nil {
-			fmt.Println("Error reading torrent file:", err)
-			return
-		}
-
-		infoHash, err := calculateInfoHash(&torrent.Info)
-		if err != nil {
-			fmt.Println("Error calculating info hash:", err)
-			return
-		}
-
-		peers, err := getPeers(torrent.Announce, infoHash, torrent.Info.Length)
-		if err != nil {
-			fmt.Println("Error getting peers:", err)
-			return
-		}
-
-		if len(peers) == 0 {
-			fmt.Println("No peers available.")
-			return
-		}
-
-		fileData, err := DownloadFile(&torrent.Info, peers, infoHash)
-		if err != nil {
-			fmt.Println("Error downloading file:", err)
-			return
-		}
-
-		err = os.WriteFile(outputFile, fileData, 0644)
-		if err != nil {
-			fmt.Println("Error saving file:", err)
-			return
-		}
-
-		fmt.Printf("Downloaded %s to %s.\n", filepath.Base(torrentFile), outputFile)
-
-	case "magnet_parse":
-		if len(args) < 1 {
-			fmt.Println("Missing magnet link argument")
-			return
-		}
-
-		magnetLink, err := ParseMagnetLink(args[0])
-		if err != nil {
-			fmt.Printf("Error parsing magnet link: %v\n", err)
-			return
-		}
-
-		fmt.Printf("Tracker URL: %s\n", magnetLink.TrackerURL)
-		fmt.Printf("Info Hash: %s\n", magnetLink.InfoHash)
-	case "magnet_handshake":
-
-		if len(args) < 1 {
-			fmt.Println("Missing magnet link argument")
-			return
-		}
-
-		magnetLink, err := ParseMagnetLink(args[0])
-		if err != nil {
-			fmt.Printf("Error parsing magnet link: %v\n", err)
-			return
-		}
-		infoHashBytes, err := hex.DecodeString(magnetLink.InfoHash)
-		if err != nil {
-			fmt.Printf("Failed to decode info hash: %v\n", err)
-			return
-		}
-
-		peers, err := getPeers(magnetLink.TrackerURL, infoHashBytes, 16384)
-		if err != nil {
-			fmt.Printf("Error getting peers: %v\n", err)
-			return
-		}
-
-		if len(peers) == 0 {
-			fmt.Println("No peers available")
-			return
-		}
-
-		peerConnection, err := newMagnetPeerConnection(peers[0], infoHashBytes)
-		if err != nil {
-			fmt.Printf("Error connecting to peer: %v\n", err)
-			return
-		}
-
-		fmt.Printf("Peer ID: %x\n", peerConnection.PeerID)
-
-	case "magnet_info":
-
-		magnetLink, err := ParseMagnetLink(args[0])
-		if err != nil {
-			fmt.Printf("Error parsing magnet link: %v\n", err)
-			return
-		}
-
-		fmt.Printf("Tracker URL: %s\n", magnetLink.TrackerURL)
-
-		infoHashBytes, err := hex.DecodeString(magnetLink.InfoHash)
-		if err != nil {
-			fmt.Printf("Failed to decode info hash: %v\n", err)
-			return
-		}
-
-		peers, err := getPeers(magnetLink.TrackerURL, infoHashBytes, 16384)
-		if err != nil {
-			fmt.Printf("Error getting peers: %v\n", err)
-			return
-		}
-
-		peerConnection, err := newMagnetPeerConnection(peers[0], infoHashBytes)
-		if err != nil {
-			fmt.Printf("Error connecting to peer: %v\n", err)
-			return
-		}
-
-		if peerConnection.MetadataExtensionID == nil {
-			return
-		}
-
-		if err := sendMetadataRequest(peerConnection.Conn, *peerConnection.MetadataExtensionID); err != nil {
-			fmt.Printf("Error sending metadata request: %v\n", err)
-			return
-		}
-
-		metadata, err := receiveMetadata(peerConnection.Conn)
-		if err != nil {
-			fmt.Printf("Error receiving metadata: %v\n", err)
-			return
-		}
-
-		fmt.Printf("Info Hash: %s\n", magnetLink.InfoHash)
-		printTorrentInfo(metadata)
-
-	case "magnet_download_piece":
-
-		if args[0] != "-o" {
-			fmt.Println("Missing -o flag")
-			return
-		}
-
-		outputFile := args[1]
-		magnetLink, err := ParseMagnetLink(args[2])
-		if err != nil {
-			fmt.Printf("Error parsing magnet link: %v\n", err)
-			return
-		}
-
-		pieceIndex, err := strconv.Atoi(args[3])
-		if err != nil {
-			fmt.Println("Invalid piece index:", err)
-			return
-		}
-
-		infoHashBytes, err := hex.DecodeString(magnetLink.InfoHash)
-		if err != nil {
-			fmt.Printf("Failed to decode info hash: %v\n", err)
-			return
-		}
-
-		peers, err := getPeers(magnetLink.TrackerURL, infoHashBytes, 16384)
-		if err != nil {
-			fmt.Printf("Error getting peers: %v\n", err)
-			return
-		}
-
-		peerConnection, err := newMagnetPeerConnection(peers[0], infoHashBytes)
-		if err != nil {
-			fmt.Printf("Error connecting to peer: %v\n", err)
-			return
-		}
-
-		if err := sendMetadataRequest(peerConnection.Conn, *peerConnection.MetadataExtensionID); err != nil {
-			fmt.Printf("Error sending metadata request: %v\n", err)
-			return
-		}
-
-		metadata, err := receiveMetadata(peerConnection.Conn)
-		if err != nil {
-			fmt.Printf("Error receiving metadata: %v\n", err)
-			return
-		}
-
-		pieceData, err := DownloadPiece(peerConnection, metadata, pieceIndex)
-		if err != nil {
-			fmt.Println("Error downloading piece:", err)
-			return
-		}
-
-		if err := os.WriteFile(outputFile, pieceData, 0644); err != nil {
-			fmt.Printf("Failed to write piece to disk: %s\n", err)
-			return
-		}
-
-		fmt.Printf("Piece %d downloaded to %s.\n", pieceIndex, outputFile)
+const (
+	// DefaultStreamAddr is the address the stream command listens on
+	DefaultStreamAddr = "127.0.0.1:8080"
+	// DefaultAPIAddr is the address of the daemon's API
+	DefaultAPIAddr = "127.0.0.1:9080"
+)
 
-	case "magnet_download":
-		if args[0] != "-o" {
-			fmt.Println("Missing -o flag")
-			return
-		}
-		outputFile := args[1]
-		magnetLink, err := ParseMagnetLink(args[2])
-		if err != nil {
-			fmt.Printf("Error parsing magnet link: %v\n", err)
-			return
-		}
+// commands lists every subcommand in the order shown by help
+var commands = []*command{
+	{name: "decode", args: "<bencoded-value>", summary: "Decode a bencoded value and print it as JSON.", minArgs: 1, maxArgs: 1, setup: decodeCommand},
+	{name: "info", args: "<torrent-file>", summary: "Print the tracker, length, info hash and piece hashes of a torrent.", minArgs: 1, maxArgs: 1, setup: infoCommand},
+	{name: "peers", args: "<torrent-file>", summary: "List the peers a torrent's tracker returns.", minArgs: 1, maxArgs: 1, setup: peersCommand},
+	{name: "handshake", args: "<torrent-file> <peer-address>", summary: "Handshake with a peer and print its peer ID and client.", minArgs: 2, maxArgs: 2, setup: handshakeCommand},
+	{name: "download_piece", aliases: []string{"magnet_download_piece"}, args: "<torrent-file|magnet-link> <piece-index>", summary: "Download and verify a single piece from one peer.", minArgs: 2, maxArgs: 2, setup: downloadPieceCommand},
+	{name: "download", aliases: []string{"magnet_download"}, args: "<torrent-file|magnet-link>", summary: "Download a torrent, optionally only some of its files.", minArgs: 1, maxArgs: 1, setup: downloadCommand},
+	{name: "stream", args: "<torrent-file|magnet-link>", summary: "Download pieces in order and serve the content over HTTP meanwhile.", minArgs: 1, maxArgs: 1, setup: streamCommand},
+	{name: "create", args: "<path>", summary: "Hash a file or directory into a new torrent file.", minArgs: 1, maxArgs: 1, setup: createCommand},
+	{name: "magnet_parse", args: "<magnet-link>", summary: "Print the tracker and info hash of a magnet link.", minArgs: 1, maxArgs: 1, setup: magnetParseCommand},
+	{name: "magnet_handshake", args: "<magnet-link>", summary: "Handshake with a magnet link's first peer, including the extension handshake.", minArgs: 1, maxArgs: 1, setup: magnetHandshakeCommand},
+	{name: "magnet_info", args: "<magnet-link>", summary: "Fetch the metadata of a magnet link from a peer and print it.", minArgs: 1, maxArgs: 1, setup: magnetInfoCommand},
+	{name: "daemon", args: "", summary: "Run a client for many torrents, controlled over an HTTP API.", minArgs: 0, maxArgs: 0, setup: daemonCommand},
+	{name: "add", args: "<torrent-file|magnet-link>...", summary: "Add torrents to the daemon and start them.", minArgs: 1, maxArgs: -1, setup: addCommand},
+	{name: "list", args: "", summary: "List the torrents in the daemon.", minArgs: 0, maxArgs: 0, setup: listCommand},
+	{name: "status", args: "<info-hash>", summary: "Show the progress, files and peers of a torrent in the daemon.", minArgs: 1, maxArgs: 1, setup: statusCommand},
+	{name: "pause", args: "<info-hash>...", summary: "Pause torrents in the daemon.", minArgs: 1, maxArgs: -1, setup: pauseCommand},
+	{name: "resume", args: "<info-hash>...", summary: "Resume paused torrents in the daemon.", minArgs: 1, maxArgs: -1, setup: resumeCommand},
+	{name: "remove", args: "<info-hash>...", summary: "Remove torrents from the daemon, keeping their files.", minArgs: 1, maxArgs: -1, setup: removeCommand},
+	{name: "priority", args: "<info-hash> <file-index>=<skip|low|normal|high>...", summary: "Change the priorities of files of a torrent in the daemon.", minArgs: 2, maxArgs: -1, setup: priorityCommand},
+}
 
-		infoHashBytes, err := hex.DecodeString(magnetLink.InfoHash)
-		if err != nil {
-			fmt.Printf("Failed to decode info hash: %v\n", err)
-			return
-		}
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
 
-		peers, err := getPeers(magnetLink.TrackerURL, infoHashBytes, 16384)
-		if err != nil {
-			fmt.Printf("Error getting peers: %v\n", err)
-			return
-		}
+// run parses the global flags, dispatches to the command and returns the exit status
+func run(args []string) int {
+	globalFlags := flag.NewFlagSet("mybittorrent", flag.ContinueOnError)
+	globalFlags.SetOutput(os.Stderr)
+	logOptions := addLogFlags(globalFlags)
+	globalFlags.Usage = func() {
+		printUsage(globalFlags)
+	}
 
-		peerConnection, err := newMagnetPeerConnection(peers[0], infoHashBytes)
-		if err != nil {
-			fmt.Printf("Error connecting to peer: %v\n", err)
-			return
+	if err := globalFlags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
 		}
+		return exitUsage
+	}
+	if globalFlags.NArg() < 1 {
+		printUsage(globalFlags)
+		return exitUsage
+	}
 
-		if err := sendMetadataRequest(peerConnection.Conn, *peerConnection.MetadataExtensionID); err != nil {
-			fmt.Printf("Error sending metadata request: %v\n", err)
-			return
-		}
+	name := globalFlags.Arg(0)
+	if name == "help" {
+		return help(globalFlags)
+	}
 
-		metadata, err := receiveMetadata(peerConnection.Conn)
-		if err != nil {
-			fmt.Printf("Error receiving metadata: %v\n", err)
-			return
-		}
+	cmd, ok := findCommand(name)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "mybittorrent: unknown command %q\n", name)
+		printUsage(globalFlags)
+		return exitUsage
+	}
 
-		fileData, err := DownloadFile(metadata, peers, infoHashBytes)
-		if err != nil {
-			fmt.Println("Error downloading file:", err)
-			return
-		}
+	logger, err := logOptions.Logger()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mybittorrent: %v\n", err)
+		return exitUsage
+	}
+	slog.SetDefault(logger)
 
-		err = os.WriteFile(outputFile, fileData, 0644)
-		if err != nil {
-			fmt.Println("Error saving file:", err)
-			return
-		}
+	// Ctrl-C cancels network operations in flight so downloads stop cleanly
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-		fmt.Printf("Downloaded file to %s\n", outputFile)
+	return cmd.execute(ctx, globalFlags.Args()[1:])
+}
 
-	default:
-		fmt.Println("Invalid command")
-		os.Exit(1)
+// help prints the usage of the command named after help, or of the whole CLI
+func help(globalFlags *flag.FlagSet) int {
+	if globalFlags.NArg() < 2 {
+		printUsage(globalFlags)
+		return exitOK
+	}
 
+	cmd, ok := findCommand(globalFlags.Arg(1))
+	if !ok {
+		fmt.Fprintf(os.Stderr, "mybittorrent help: unknown command %q\n", globalFlags.Arg(1))
+		return exitUsage
 	}
+	flags, _ := cmd.flagSet()
+	flags.Usage()
+	return exitOK
+}
 
+func printUsage(globalFlags *flag.FlagSet) {
+	fmt.Fprintln(os.Stderr, "Usage: mybittorrent [global flags] <command> [flags] [arguments]")
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(os.Stderr, "\nGlobal flags:")
+	globalFlags.PrintDefaults()
+	fmt.Fprintln(os.Stderr, "\nRun 'mybittorrent help <command>' for the flags of a command.")
 }
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/codecrafters-io/bittorrent-starter-go/client"
+	"log/slog"
+	"net"
+	"net/http"
+)
+
+// addMetricsFlag adds the flag serving Prometheus metrics
+func addMetricsFlag(flags *flag.FlagSet) *string {
+	return flags.String("metrics-addr", "", "address to serve Prometheus metrics on at /metrics, empty to not serve them")
+}
+
+// startMetrics serves metrics on addr until ctx is done, counting tracker
+// announces from events. Without an address it returns nil
+func startMetrics(ctx context.Context, addr string, events *client.Events) (*client.Metrics, error) {
+	if addr == "" {
+		return nil, nil
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for metrics requests: %w", err)
+	}
+
+	metrics := client.NewMetrics(events)
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics)
+	server := newHTTPServer(mux)
+	go func() {
+		<-ctx.Done()
+		server.Shutdown(context.Background())
+	}()
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			slog.Error("failed to serve metrics", "err", err)
+		}
+	}()
+
+	fmt.Printf("Metrics on http://%s/metrics\n", listener.Addr())
+	return metrics, nil
+}
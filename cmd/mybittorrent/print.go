@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"github.com/codecrafters-io/bittorrent-starter-go/api"
+	"github.com/codecrafters-io/bittorrent-starter-go/client"
+	"github.com/codecrafters-io/bittorrent-starter-go/metainfo"
+	"os"
+	"sync"
+	"text/tabwriter"
+)
+
+// Print torrent details.
+func printTorrentDetails(torrent *metainfo.Torrent, infoHash []byte) {
+	fmt.Printf("Tracker URL: %s\n", torrent.Announce)
+	fmt.Printf("Length: %d\n", torrent.Info.TotalLength())
+	fmt.Printf("Info Hash: %x\n", infoHash)
+	fmt.Printf("Piece Length: %d\n", torrent.Info.PieceLength)
+
+	fmt.Println("Piece Hashes: ")
+	for i := 0; i < len(torrent.Info.Pieces); i += 20 {
+		fmt.Printf("%x\n", torrent.Info.Pieces[i:i+20])
+	}
+}
+
+func printTorrentInfo(metadata *metainfo.Info) {
+	fmt.Printf("Length: %d\n", metadata.TotalLength())
+	fmt.Printf("Piece Length: %d\n", metadata.PieceLength)
+	fmt.Println("Piece Hashes:")
+
+	for i := 0; i < len(metadata.Pieces); i += 20 {
+		fmt.Printf("%x\n", metadata.Pieces[i:i+20])
+	}
+}
+
+// printEvents prints download progress as it happens. The returned function
+// ends the stream and waits for the queued events to be printed
+func printEvents(events *client.Events) func() {
+	stream, _ := events.Subscribe()
+	printed := make(chan struct{})
+
+	go func() {
+		defer close(printed)
+		for event := range stream {
+			if message, ok := eventMessage(event); ok {
+				fmt.Println(message)
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			events.Close()
+			<-printed
+		})
+	}
+}
+
+// eventMessage describes the events worth a line of output
+func eventMessage(event client.Event) (string, bool) {
+	switch event.Type {
+	case client.EventPieceVerified:
+		return fmt.Sprintf("Piece %d downloaded and verified.", event.Piece), true
+	case client.EventPieceFailed:
+		return fmt.Sprintf("Piece %d from %s failed verification.", event.Piece, event.Peer), true
+	case client.EventPeerDisconnected:
+		if event.Err != nil {
+			return fmt.Sprintf("Dropped peer %s: %v", event.Peer, event.Err), true
+		}
+	case client.EventTrackerAnnounce:
+		if event.Err != nil {
+			return fmt.Sprintf("Announce to %s failed: %v", event.Tracker, event.Err), true
+		}
+	case client.EventDropped:
+		return fmt.Sprintf("Missed %d events while falling behind.", event.Dropped), true
+	}
+	return "", false
+}
+
+func printPeers(peers []string) {
+	for i, peer := range peers {
+		fmt.Printf("Peer %d: %s\n", i+1, peer)
+	}
+}
+
+func printIdentifiedPeers(identities []client.PeerIdentity) {
+	for i, identity := range identities {
+		fmt.Printf("Peer %d: %s (%s)\n", i+1, identity.Addr, identity)
+	}
+}
+
+func printTorrentList(torrents []api.Torrent) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "INFO HASH\tSTATE\tDONE\tPEERS\tNAME")
+	for _, torrent := range torrents {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", torrent.InfoHash, torrent.State, percent(torrent.BytesDone, torrent.BytesWanted), torrent.Peers, torrent.Name)
+	}
+	w.Flush()
+}
+
+func printTorrentStatus(torrent *api.Torrent, files []api.File, peers []api.Peer) {
+	fmt.Printf("Name: %s\n", torrent.Name)
+	fmt.Printf("Info Hash: %s\n", torrent.InfoHash)
+	fmt.Printf("State: %s\n", torrent.State)
+	if torrent.Error != "" {
+		fmt.Printf("Error: %s\n", torrent.Error)
+	}
+	fmt.Printf("Progress: %s (%d/%d pieces, %d/%d bytes)\n", percent(torrent.BytesDone, torrent.BytesWanted), torrent.PiecesDone, torrent.PiecesWanted, torrent.BytesDone, torrent.BytesWanted)
+	fmt.Printf("Downloaded: %d bytes\n", torrent.BytesDownloaded)
+
+	fmt.Println("Files:")
+	printFiles(files)
+
+	fmt.Printf("Peers: %d\n", len(peers))
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, peer := range peers {
+		choked := "unchoked"
+		if peer.Choked {
+			choked = "choked"
+		}
+		direction := "outgoing"
+		if peer.Incoming {
+			direction = "incoming"
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%d bytes\n", peer.Address, peer.Client, direction, choked, peer.Downloaded)
+	}
+	w.Flush()
+}
+
+func printFiles(files []api.File) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, file := range files {
+		fmt.Fprintf(w, "  %d\t%s\t%s\t%s\n", file.Index, file.Priority, percent(file.BytesDone, file.Length), file.Path)
+	}
+	w.Flush()
+}
+
+// percent formats how much of total is done, "-" while the total is unknown
+func percent(done, total int64) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", float64(done)*100/float64(total))
+}
+
+func printCreateProgress(done, total int) {
+	fmt.Fprintf(os.Stderr, "\rHashing pieces: %d/%d (%.1f%%)", done, total, float64(done)*100/float64(total))
+	if done == total {
+		fmt.Fprintln(os.Stderr)
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"cmp"
+	"flag"
+	"fmt"
+	"github.com/codecrafters-io/bittorrent-starter-go/client"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	liveRefresh   = 250 * time.Millisecond // Redraw interval of the live display
+	plainInterval = 5 * time.Second        // Interval between plain progress lines
+	pieceMapWidth = 60                     // Cells of the piece map, each covering a run of pieces
+	maxLivePeers  = 8                      // Peers listed in the live display, fastest first
+)
+
+// addProgressFlag adds the flag choosing how download shows its progress
+func addProgressFlag(flags *flag.FlagSet) *string {
+	return flags.String("progress", "auto", "progress display: live redraws in place, plain prints a line every few seconds, auto picks live on a terminal")
+}
+
+// liveProgress reports whether a --progress value asks for the live display
+func liveProgress(mode string) (bool, error) {
+	switch mode {
+	case "auto":
+		return isTerminal(os.Stdout), nil
+	case "live":
+		return true, nil
+	case "plain":
+		return false, nil
+	}
+	return false, usageErrorf("invalid --progress %q: use auto, live or plain", mode)
+}
+
+// isTerminal reports whether f is a terminal that understands cursor movement
+func isTerminal(f *os.File) bool {
+	if os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// terminalWidth returns the columns of the terminal from $COLUMNS, or 80
+func terminalWidth() int {
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		return columns
+	}
+	return 80
+}
+
+// progressDisplay prints the events of a download and its progress, redrawn
+// in place on a terminal or as a plain line every few seconds otherwise
+type progressDisplay struct {
+	live  bool
+	width int // Live lines are cut to fit the terminal
+	lines int // Lines of the live display on screen
+
+	mu       sync.Mutex
+	download *client.Download
+}
+
+// showProgress prints events as they arrive, and the progress of the download
+// once watch hands it over. The returned function ends the stream and leaves
+// the last live display on screen
+func showProgress(events *client.Events, live bool) (*progressDisplay, func()) {
+	stream, _ := events.Subscribe()
+	p := &progressDisplay{live: live, width: terminalWidth()}
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		interval := plainInterval
+		if live {
+			interval = liveRefresh
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case event, ok := <-stream:
+				if !ok {
+					p.refresh()
+					return
+				}
+				// Verified pieces show up in the progress instead
+				if message, ok := eventMessage(event); ok && event.Type != client.EventPieceVerified {
+					p.println(message)
+				}
+			case <-ticker.C:
+				p.refresh()
+			}
+		}
+	}()
+
+	var once sync.Once
+	return p, func() {
+		once.Do(func() {
+			events.Close()
+			<-stopped
+		})
+	}
+}
+
+// watch starts showing the progress of a download
+func (p *progressDisplay) watch(download *client.Download) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.download = download
+}
+
+// println prints a line above the live display
+func (p *progressDisplay) println(line string) {
+	p.clear()
+	fmt.Println(line)
+	if p.live {
+		p.draw()
+	}
+}
+
+// refresh redraws the live display, or prints a plain progress line
+func (p *progressDisplay) refresh() {
+	p.mu.Lock()
+	download := p.download
+	p.mu.Unlock()
+	if download == nil {
+		return
+	}
+
+	if !p.live {
+		fmt.Println(progressSummary(download, download.Stats(), download.Peers()))
+		return
+	}
+	p.clear()
+	p.draw()
+}
+
+// draw prints the live display below the cursor
+func (p *progressDisplay) draw() {
+	p.mu.Lock()
+	download := p.download
+	p.mu.Unlock()
+	if download == nil {
+		return
+	}
+
+	lines := liveLines(download)
+	for _, line := range lines {
+		fmt.Println(truncate(line, p.width-1))
+	}
+	p.lines = len(lines)
+}
+
+// clear erases the live display, leaving the cursor where it started
+func (p *progressDisplay) clear() {
+	if p.lines > 0 {
+		fmt.Printf("\x1b[%dA\x1b[J", p.lines)
+		p.lines = 0
+	}
+}
+
+// liveLines renders the summary, piece map and fastest peers of a download
+func liveLines(download *client.Download) []string {
+	stats := download.Stats()
+	peers := download.Peers()
+	lines := []string{
+		progressSummary(download, stats, peers),
+		pieceMap(download.Pieces()),
+	}
+
+	slices.SortStableFunc(peers, func(a, b client.PeerStats) int {
+		return cmp.Compare(b.DownloadRate, a.DownloadRate)
+	})
+	for _, peer := range peers[:min(len(peers), maxLivePeers)] {
+		choked := ""
+		if peer.Choked {
+			choked = "choked"
+		}
+		line := fmt.Sprintf("  %-21s %-24s %12s  %s", peer.Addr, peer.Client, formatBytes(peer.DownloadRate)+"/s", choked)
+		lines = append(lines, strings.TrimRight(line, " "))
+	}
+	if len(peers) > maxLivePeers {
+		lines = append(lines, fmt.Sprintf("  and %d more peers", len(peers)-maxLivePeers))
+	}
+	return lines
+}
+
+// progressSummary describes the progress of a download on one line
+func progressSummary(download *client.Download, stats client.DownloadStats, peers []client.PeerStats) string {
+	unchoked := 0
+	for _, peer := range peers {
+		if !peer.Choked {
+			unchoked++
+		}
+	}
+
+	eta := "-"
+	if left := stats.BytesWanted - stats.BytesDone; left == 0 {
+		eta = "0s"
+	} else if stats.DownloadRate > 0 {
+		eta = (time.Duration(left/stats.DownloadRate) * time.Second).String()
+	}
+
+	return fmt.Sprintf("%s: %s (%s of %s) at %s/s, ETA %s, %d peers (%d unchoked)",
+		download.Info().Name,
+		percent(stats.BytesDone, stats.BytesWanted),
+		formatBytes(stats.BytesDone),
+		formatBytes(stats.BytesWanted),
+		formatBytes(stats.DownloadRate),
+		eta,
+		len(peers),
+		unchoked)
+}
+
+// pieceMap draws the pieces as a bar, each cell covering a run of pieces:
+// full when all are verified, shaded when some are verified or downloading,
+// light when none are and blank when all are skipped
+func pieceMap(pieces []client.PieceState) string {
+	cells := min(len(pieces), pieceMapWidth)
+
+	var b strings.Builder
+	b.WriteByte('[')
+	for i := 0; i < cells; i++ {
+		var verified, started, skipped int
+		run := pieces[i*len(pieces)/cells : (i+1)*len(pieces)/cells]
+		for _, state := range run {
+			switch state {
+			case client.PieceVerified:
+				verified++
+				started++
+			case client.PieceDownloading:
+				started++
+			case client.PieceSkipped:
+				skipped++
+			}
+		}
+
+		switch {
+		case skipped == len(run):
+			b.WriteRune(' ')
+		case verified == len(run)-skipped:
+			b.WriteRune('█')
+		case started > 0:
+			b.WriteRune('▒')
+		default:
+			b.WriteRune('░')
+		}
+	}
+	b.WriteByte(']')
+	return b.String()
+}
+
+// formatBytes formats a byte count with binary units
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	value := float64(n)
+	for _, prefix := range "KMGT" {
+		value /= unit
+		if value < unit || prefix == 'T' {
+			return fmt.Sprintf("%.1f %ciB", value, prefix)
+		}
+	}
+	return ""
+}
+
+// truncate cuts a line to at most width characters
+func truncate(line string, width int) string {
+	runes := []rune(line)
+	if width <= 0 || len(runes) <= width {
+		return line
+	}
+	return string(runes[:width])
+}
@@ -0,0 +1,151 @@
+// Package magnet parses and builds magnet links (BEP 9, BEP 53)
+package magnet
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// MaxFileIndex bounds the file indices of the so= parameter, so a range
+// cannot expand into more indices than any torrent has files
+const MaxFileIndex = 1 << 16
+
+// Link is a parsed magnet link
+type Link struct {
+	InfoHash   string
+	Name       string
+	TrackerURL string
+	Trackers   []string
+	SelectOnly []int // File indices from the so= parameter (BEP 53)
+}
+
+// Parse reads a magnet URI
+func Parse(magnetURL string) (*Link, error) {
+	if !strings.HasPrefix(magnetURL, "magnet:?") {
+		return nil, fmt.Errorf("invalid magnet link format")
+	}
+
+	// Remove the "magnet:?" prefix
+	queryString := strings.TrimPrefix(magnetURL, "magnet:?")
+
+	// Parse the query parameters
+	values, err := url.ParseQuery(queryString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse magnet link: %v", err)
+	}
+
+	magnet := &Link{}
+
+	// Extract info hash
+	xt := values.Get("xt")
+	if xt == "" {
+		return nil, fmt.Errorf("missing info hash (xt parameter)")
+	}
+	if !strings.HasPrefix(xt, "urn:btih:") {
+		return nil, fmt.Errorf("invalid info hash format")
+	}
+	magnet.InfoHash = strings.TrimPrefix(xt, "urn:btih:")
+	if _, err := magnet.InfoHashBytes(); err != nil {
+		return nil, err
+	}
+
+	// Extract name (optional)
+	magnet.Name = values.Get("dn")
+
+	// Extract tracker URLs, keeping the first one as the primary tracker
+	magnet.Trackers = values["tr"]
+	magnet.TrackerURL = values.Get("tr")
+
+	// Extract file selection (optional)
+	if so := values.Get("so"); so != "" {
+		magnet.SelectOnly, err = parseSelectOnly(so)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return magnet, nil
+}
+
+// parseSelectOnly parses a BEP 53 index list such as "0,2,4-6", each index
+// is listed once however often it is repeated
+func parseSelectOnly(value string) ([]int, error) {
+	var indices []int
+	seen := make(map[int]bool)
+	for _, item := range strings.Split(value, ",") {
+		first, last, isRange := strings.Cut(item, "-")
+
+		start, err := strconv.Atoi(first)
+		if err != nil || start < 0 || start >= MaxFileIndex {
+			return nil, fmt.Errorf("invalid file index %q in so parameter", item)
+		}
+
+		end := start
+		if isRange {
+			end, err = strconv.Atoi(last)
+			if err != nil || end < start || end >= MaxFileIndex {
+				return nil, fmt.Errorf("invalid file range %q in so parameter", item)
+			}
+		}
+
+		for index := start; index <= end; index++ {
+			if !seen[index] {
+				seen[index] = true
+				indices = append(indices, index)
+			}
+		}
+	}
+	return indices, nil
+}
+
+// New creates a magnet link for the given info hash
+func New(infoHash []byte, name string, trackers []string) *Link {
+	magnet := &Link{
+		InfoHash: hex.EncodeToString(infoHash),
+		Name:     name,
+		Trackers: trackers,
+	}
+	if len(trackers) > 0 {
+		magnet.TrackerURL = trackers[0]
+	}
+	return magnet
+}
+
+// String renders the magnet link as a URI
+func (m *Link) String() string {
+	var b strings.Builder
+	b.WriteString("magnet:?xt=urn:btih:")
+	b.WriteString(m.InfoHash)
+
+	if m.Name != "" {
+		b.WriteString("&dn=")
+		b.WriteString(url.QueryEscape(m.Name))
+	}
+
+	trackers := m.Trackers
+	if len(trackers) == 0 && m.TrackerURL != "" {
+		trackers = []string{m.TrackerURL}
+	}
+	for _, tracker := range trackers {
+		b.WriteString("&tr=")
+		b.WriteString(url.QueryEscape(tracker))
+	}
+
+	return b.String()
+}
+
+// InfoHashBytes decodes the hex encoded info hash, which must be a SHA-1 hash
+func (m *Link) InfoHashBytes() ([]byte, error) {
+	infoHash, err := hex.DecodeString(m.InfoHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode info hash: %w", err)
+	}
+	if len(infoHash) != sha1.Size {
+		return nil, fmt.Errorf("info hash is %d bytes, expected %d", len(infoHash), sha1.Size)
+	}
+	return infoHash, nil
+}
@@ -0,0 +1,52 @@
+package magnet
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testInfoHash = "7c64cbb06ff108c644500e3d8acd76c1d6461668"
+
+func TestParse(t *testing.T) {
+	link, err := Parse("magnet:?xt=urn:btih:" + testInfoHash + "&dn=big.bin&tr=http%3A%2F%2F127.0.0.1%3A9000%2Fannounce&so=0,2-3")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if link.InfoHash != testInfoHash || link.Name != "big.bin" || link.TrackerURL != "http://127.0.0.1:9000/announce" {
+		t.Errorf("parsed %+v", link)
+	}
+	if want := []int{0, 2, 3}; !reflect.DeepEqual(link.SelectOnly, want) {
+		t.Errorf("select only %v, want %v", link.SelectOnly, want)
+	}
+	if infoHash, err := link.InfoHashBytes(); err != nil || len(infoHash) != 20 {
+		t.Errorf("InfoHashBytes() = %x, %v", infoHash, err)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []string{
+		"http://example.com",
+		"magnet:?dn=missing",
+		"magnet:?xt=urn:sha1:" + testInfoHash,
+		"magnet:?xt=urn:btih:abcd",
+		"magnet:?xt=urn:btih:",
+		"magnet:?xt=urn:btih:" + testInfoHash + "00",
+		"magnet:?xt=urn:btih:" + strings.Repeat("zz", 20),
+		"magnet:?xt=urn:btih:" + testInfoHash + "&so=0-2147483647",
+		"magnet:?xt=urn:btih:" + testInfoHash + "&so=3-1",
+		"magnet:?xt=urn:btih:" + testInfoHash + "&so=-1",
+	}
+	for _, uri := range tests {
+		if link, err := Parse(uri); err == nil {
+			t.Errorf("Parse(%q) = %+v, want an error", uri, link)
+		}
+	}
+}
+
+func TestInfoHashBytesLength(t *testing.T) {
+	link := &Link{InfoHash: "abcd"}
+	if _, err := link.InfoHashBytes(); err == nil {
+		t.Errorf("a 2 byte info hash was accepted")
+	}
+}
@@ -0,0 +1,336 @@
+package metainfo
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Piece length bounds used when picking a piece length automatically
+const (
+	MinPieceLength    = 16 * 1024
+	MaxPieceLength    = 16 * 1024 * 1024
+	TargetPieceCount  = 1500
+	DefaultCreatedBy  = "FlowStream"
+	hashQueueMultiple = 2 // Pieces buffered per hashing worker
+)
+
+// sourceFile is a file on disk that is part of a torrent being created
+type sourceFile struct {
+	path   string
+	length int64
+	parts  []string
+}
+
+// Builder handles the construction of torrent metainfo from files on disk
+type Builder struct {
+	root         string
+	pieceLength  int
+	trackers     []string
+	webSeeds     []string
+	comment      string
+	createdBy    string
+	creationDate time.Time
+	private      bool
+	source       string
+	progress     func(done, total int)
+}
+
+// NewBuilder creates a new Builder for a file or directory
+func NewBuilder(root string) *Builder {
+	return &Builder{
+		root:         root,
+		createdBy:    DefaultCreatedBy,
+		creationDate: time.Now(),
+	}
+}
+
+// WithPieceLength sets the piece length, zero selects one automatically
+func (b *Builder) WithPieceLength(pieceLength int) *Builder {
+	b.pieceLength = pieceLength
+	return b
+}
+
+// WithTrackers sets the announce URLs, each one in its own tier
+func (b *Builder) WithTrackers(trackers []string) *Builder {
+	b.trackers = trackers
+	return b
+}
+
+// WithWebSeeds sets the web seed URLs
+func (b *Builder) WithWebSeeds(webSeeds []string) *Builder {
+	b.webSeeds = webSeeds
+	return b
+}
+
+// WithComment sets the torrent comment
+func (b *Builder) WithComment(comment string) *Builder {
+	b.comment = comment
+	return b
+}
+
+// WithCreatedBy sets the creating program name
+func (b *Builder) WithCreatedBy(createdBy string) *Builder {
+	b.createdBy = createdBy
+	return b
+}
+
+// WithCreationDate sets the creation date, the zero time omits it
+func (b *Builder) WithCreationDate(date time.Time) *Builder {
+	b.creationDate = date
+	return b
+}
+
+// WithPrivate marks the torrent as private
+func (b *Builder) WithPrivate(private bool) *Builder {
+	b.private = private
+	return b
+}
+
+// WithSource sets the source tag in the info dictionary
+func (b *Builder) WithSource(source string) *Builder {
+	b.source = source
+	return b
+}
+
+// WithProgress sets a callback invoked as pieces are hashed
+func (b *Builder) WithProgress(progress func(done, total int)) *Builder {
+	b.progress = progress
+	return b
+}
+
+// Build hashes the content and constructs the torrent
+func (b *Builder) Build() (*Torrent, error) {
+	rootInfo, err := os.Stat(b.root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat %s: %w", b.root, err)
+	}
+
+	// Resolve the root so "." and relative paths are named after their directory
+	absRoot, err := filepath.Abs(b.root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", b.root, err)
+	}
+	name := filepath.Base(absRoot)
+	if !ValidName(name) {
+		return nil, fmt.Errorf("invalid torrent name %q for %s", name, absRoot)
+	}
+
+	files, err := collectSourceFiles(b.root, rootInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	var totalLength int64
+	for _, file := range files {
+		totalLength += file.length
+	}
+	if totalLength == 0 {
+		return nil, fmt.Errorf("no content to hash in %s", b.root)
+	}
+
+	pieceLength := b.pieceLength
+	if pieceLength == 0 {
+		pieceLength = choosePieceLength(totalLength)
+	}
+	if pieceLength < MinPieceLength || pieceLength&(pieceLength-1) != 0 {
+		return nil, fmt.Errorf("invalid piece length %d: must be a power of two of at least %d", pieceLength, MinPieceLength)
+	}
+
+	pieces, err := hashPieces(files, totalLength, pieceLength, b.progress)
+	if err != nil {
+		return nil, err
+	}
+
+	info := Info{
+		Name:        name,
+		PieceLength: pieceLength,
+		Pieces:      pieces,
+		Source:      b.source,
+	}
+	if b.private {
+		info.Private = 1
+	}
+
+	if rootInfo.IsDir() {
+		for _, file := range files {
+			info.Files = append(info.Files, File{
+				Length: int(file.length),
+				Path:   file.parts,
+			})
+		}
+	} else {
+		info.Length = int(totalLength)
+	}
+
+	torrent := &Torrent{
+		Comment:   b.comment,
+		CreatedBy: b.createdBy,
+		URLList:   b.webSeeds,
+		Info:      info,
+	}
+
+	if !b.creationDate.IsZero() {
+		torrent.CreationDate = b.creationDate.Unix()
+	}
+
+	if len(b.trackers) > 0 {
+		torrent.Announce = b.trackers[0]
+	}
+	if len(b.trackers) > 1 {
+		for _, tracker := range b.trackers {
+			torrent.AnnounceList = append(torrent.AnnounceList, []string{tracker})
+		}
+	}
+
+	return torrent, nil
+}
+
+// collectSourceFiles lists the regular files under root in lexical walk order
+func collectSourceFiles(root string, rootInfo fs.FileInfo) ([]sourceFile, error) {
+	if !rootInfo.IsDir() {
+		return []sourceFile{{path: root, length: rootInfo.Size()}}, nil
+	}
+
+	var files []sourceFile
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		files = append(files, sourceFile{
+			path:   path,
+			length: info.Size(),
+			parts:  splitPath(rel),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk %s: %w", root, err)
+	}
+
+	return files, nil
+}
+
+func splitPath(rel string) []string {
+	return strings.Split(filepath.ToSlash(rel), "/")
+}
+
+// choosePieceLength picks the smallest power of two giving at most TargetPieceCount pieces
+func choosePieceLength(totalLength int64) int {
+	pieceLength := MinPieceLength
+	for pieceLength < MaxPieceLength && totalLength/int64(pieceLength) > TargetPieceCount {
+		pieceLength *= 2
+	}
+	return pieceLength
+}
+
+type hashJob struct {
+	index int
+	data  []byte
+}
+
+// hashPieces reads the files as one contiguous stream and hashes each piece in parallel
+func hashPieces(files []sourceFile, totalLength int64, pieceLength int, progress func(done, total int)) (string, error) {
+	numPieces := int((totalLength + int64(pieceLength) - 1) / int64(pieceLength))
+	pieces := make([]byte, numPieces*sha1.Size)
+
+	numWorkers := runtime.NumCPU()
+	jobs := make(chan hashJob, numWorkers*hashQueueMultiple)
+	done := make(chan struct{}, numPieces)
+
+	var workers sync.WaitGroup
+	for i := 0; i < numWorkers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for job := range jobs {
+				hash := sha1.Sum(job.data)
+				copy(pieces[job.index*sha1.Size:], hash[:])
+				done <- struct{}{}
+			}
+		}()
+	}
+
+	var reporter sync.WaitGroup
+	reporter.Add(1)
+	go func() {
+		defer reporter.Done()
+		for completed := 1; completed <= numPieces; completed++ {
+			if _, ok := <-done; !ok {
+				return
+			}
+			if progress != nil {
+				progress(completed, numPieces)
+			}
+		}
+	}()
+
+	readErr := readPieces(files, pieceLength, jobs)
+	close(jobs)
+	workers.Wait()
+	close(done)
+	reporter.Wait()
+
+	if readErr != nil {
+		return "", readErr
+	}
+	return string(pieces), nil
+}
+
+// readPieces splits the concatenated file contents into piece sized jobs
+func readPieces(files []sourceFile, pieceLength int, jobs chan<- hashJob) error {
+	index := 0
+	buffer := make([]byte, 0, pieceLength)
+
+	for _, file := range files {
+		f, err := os.Open(file.path)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", file.path, err)
+		}
+
+		remaining := file.length
+		for remaining > 0 {
+			chunk := min(int64(pieceLength-len(buffer)), remaining)
+			start := len(buffer)
+			buffer = buffer[:start+int(chunk)]
+			if _, err := io.ReadFull(f, buffer[start:]); err != nil {
+				f.Close()
+				return fmt.Errorf("failed to read %s: %w", file.path, err)
+			}
+			remaining -= chunk
+
+			if len(buffer) == pieceLength {
+				jobs <- hashJob{index: index, data: buffer}
+				index++
+				buffer = make([]byte, 0, pieceLength)
+			}
+		}
+		f.Close()
+	}
+
+	if len(buffer) > 0 {
+		jobs <- hashJob{index: index, data: buffer}
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+// Package metainfo reads, writes and creates .torrent files (BEP 3)
+package metainfo
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	bencode "github.com/jackpal/bencode-go"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+type Torrent struct {
+	Announce     string     `bencode:"announce,omitempty"`
+	AnnounceList [][]string `bencode:"announce-list,omitempty"`
+	Comment      string     `bencode:"comment,omitempty"`
+	CreatedBy    string     `bencode:"created by,omitempty"`
+	CreationDate int64      `bencode:"creation date,omitempty"`
+	URLList      []string   `bencode:"url-list,omitempty"`
+	Info         Info       `bencode:"info"`
+}
+
+// Info is the info dictionary, the part of a torrent hashed into its info hash
+type Info struct {
+	Files       []File `bencode:"files,omitempty"`
+	Length      int    `bencode:"length,omitempty"`
+	Name        string `bencode:"name"`
+	PieceLength int    `bencode:"piece length"`
+	Pieces      string `bencode:"pieces"`
+	Private     int    `bencode:"private,omitempty"`
+	Source      string `bencode:"source,omitempty"`
+}
+
+// File describes one entry of a multi-file torrent
+type File struct {
+	Length int      `bencode:"length"`
+	Path   []string `bencode:"path"`
+}
+
+// ValidName reports whether name is safe to use as a single file or directory
+// name on disk, names come from the torrent and must not escape the directory
+// they are written to
+func ValidName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
+
+// Validate checks that the name and every file path element of the info
+// dictionary are valid names, and that the pieces cover the content exactly
+func (info *Info) Validate() error {
+	if !ValidName(info.Name) {
+		return fmt.Errorf("invalid torrent name %q", info.Name)
+	}
+
+	totalLength := info.Length
+	if len(info.Files) > 0 {
+		totalLength = 0
+	}
+	for _, file := range info.Files {
+		if len(file.Path) == 0 {
+			return fmt.Errorf("empty path in file list")
+		}
+		for _, part := range file.Path {
+			if !ValidName(part) {
+				return fmt.Errorf("invalid path component %q in file list", part)
+			}
+		}
+		if file.Length < 0 || file.Length > math.MaxInt-totalLength {
+			return fmt.Errorf("invalid length %d of file %s", file.Length, strings.Join(file.Path, "/"))
+		}
+		totalLength += file.Length
+	}
+	if totalLength < 0 {
+		return fmt.Errorf("invalid length %d", totalLength)
+	}
+
+	if info.PieceLength <= 0 {
+		return fmt.Errorf("invalid piece length %d", info.PieceLength)
+	}
+	if len(info.Pieces)%sha1.Size != 0 {
+		return fmt.Errorf("pieces length %d is not a multiple of %d", len(info.Pieces), sha1.Size)
+	}
+	numPieces := totalLength / info.PieceLength
+	if totalLength%info.PieceLength != 0 {
+		numPieces++
+	}
+	if info.NumPieces() != numPieces {
+		return fmt.Errorf("torrent has %d piece hashes, expected %d for %d bytes", info.NumPieces(), numPieces, totalLength)
+	}
+	return nil
+}
+
+// TotalLength returns the combined length of all files in the torrent
+func (info *Info) TotalLength() int {
+	if len(info.Files) == 0 {
+		return info.Length
+	}
+
+	total := 0
+	for _, file := range info.Files {
+		total += file.Length
+	}
+	return total
+}
+
+// NumPieces returns the number of pieces listed in the info dictionary
+func (info *Info) NumPieces() int {
+	return len(info.Pieces) / sha1.Size
+}
+
+// PieceHash returns the SHA-1 hash of a piece
+func (info *Info) PieceHash(index int) []byte {
+	return []byte(info.Pieces[index*sha1.Size : (index+1)*sha1.Size])
+}
+
+// PieceSize returns the length of a piece, which is shorter than PieceLength
+// only for the last piece
+func (info *Info) PieceSize(index int) int {
+	totalLength := info.TotalLength()
+	totalPieces := (totalLength + info.PieceLength - 1) / info.PieceLength
+	if index == totalPieces-1 {
+		lastPieceSize := totalLength % info.PieceLength
+		if lastPieceSize != 0 {
+			return lastPieceSize
+		}
+	}
+	return info.PieceLength
+}
+
+// Marshal encodes the info dictionary as served to peers and hashed into the info hash
+func (info *Info) Marshal() ([]byte, error) {
+	var b bytes.Buffer
+	if err := bencode.Marshal(&b, *info); err != nil {
+		return nil, fmt.Errorf("error marshalling torrent info: %w", err)
+	}
+	return b.Bytes(), nil
+}
+
+// Hash returns the info hash identifying the torrent
+func (info *Info) Hash() ([]byte, error) {
+	infoBytes, err := info.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("error hashing torrent info: %w", err)
+	}
+
+	hash := sha1.Sum(infoBytes)
+	return hash[:], nil
+}
+
+// Read decodes a torrent from r and validates its info dictionary
+func Read(r io.Reader) (*Torrent, error) {
+	var torrent Torrent
+	if err := bencode.Unmarshal(r, &torrent); err != nil {
+		return nil, fmt.Errorf("error unmarshalling torrent data: %w", err)
+	}
+	if err := torrent.Info.Validate(); err != nil {
+		return nil, err
+	}
+	return &torrent, nil
+}
+
+// ReadFile reads and decodes a torrent file
+func ReadFile(filePath string) (*Torrent, error) {
+	fileData, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading file: %w", err)
+	}
+
+	defer fileData.Close()
+
+	return Read(fileData)
+}
+
+// WriteFile encodes a torrent and writes it to disk
+func WriteFile(filePath string, torrent *Torrent) error {
+	var b bytes.Buffer
+	if err := bencode.Marshal(&b, *torrent); err != nil {
+		return fmt.Errorf("error marshalling torrent data: %w", err)
+	}
+
+	if err := os.WriteFile(filePath, b.Bytes(), 0644); err != nil {
+		return fmt.Errorf("error writing file: %w", err)
+	}
+	return nil
+}
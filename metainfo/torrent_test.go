@@ -0,0 +1,64 @@
+package metainfo
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func testInfo() Info {
+	return Info{
+		Name:        "test",
+		PieceLength: 16384,
+		Pieces:      strings.Repeat("\x00", 3*20),
+		Files: []File{
+			{Length: 20000, Path: []string{"a.bin"}},
+			{Length: 20000, Path: []string{"sub", "b.bin"}},
+		},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(info *Info)
+		wantErr bool
+	}{
+		{"valid multi-file", func(info *Info) {}, false},
+		{"valid single file", func(info *Info) { info.Files = nil; info.Length = 40000 }, false},
+		{"empty content", func(info *Info) { info.Files = nil; info.Pieces = "" }, false},
+		{"parent name", func(info *Info) { info.Name = ".." }, true},
+		{"slash in name", func(info *Info) { info.Name = "../evil" }, true},
+		{"empty name", func(info *Info) { info.Name = "" }, true},
+		{"parent path", func(info *Info) { info.Files[1].Path = []string{"..", "b.bin"} }, true},
+		{"backslash in path", func(info *Info) { info.Files[1].Path = []string{`..\b.bin`} }, true},
+		{"empty path", func(info *Info) { info.Files[1].Path = nil }, true},
+		{"zero piece length", func(info *Info) { info.PieceLength = 0 }, true},
+		{"negative piece length", func(info *Info) { info.PieceLength = -16384 }, true},
+		{"partial piece hash", func(info *Info) { info.Pieces += "\x00" }, true},
+		{"missing piece hash", func(info *Info) { info.Pieces = info.Pieces[20:] }, true},
+		{"extra piece hash", func(info *Info) { info.Pieces += strings.Repeat("\x00", 20) }, true},
+		{"negative file length", func(info *Info) { info.Files[0].Length = -1 }, true},
+		{"negative length", func(info *Info) { info.Files = nil; info.Length = -1; info.Pieces = "" }, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			info := testInfo()
+			test.modify(&info)
+			err := info.Validate()
+			if test.wantErr && err == nil {
+				t.Errorf("Validate() accepted %+v", info)
+			}
+			if !test.wantErr && err != nil {
+				t.Errorf("Validate() failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestReadValidates(t *testing.T) {
+	data := "d4:infod6:lengthi5e4:name4:test12:piece lengthi0e6:pieces20:" + strings.Repeat("\x00", 20) + "ee"
+	if _, err := Read(bytes.NewReader([]byte(data))); err == nil {
+		t.Errorf("Read accepted a piece length of 0")
+	}
+}
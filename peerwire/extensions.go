@@ -0,0 +1,272 @@
+package peerwire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	bencode "github.com/jackpal/bencode-go"
+	"net"
+	"sync"
+)
+
+// Constants for extension protocol
+const (
+	ExtensionMessageID   = 20
+	HandshakeExtensionID = 0
+)
+
+// Values we advertise in our extension handshake
+const (
+	ClientVersion       = "FlowStream 0.1"
+	DefaultRequestQueue = 250 // Outstanding requests we accept from a peer (reqq)
+)
+
+// Extension is a BEP 10 extension protocol spoken over a peer connection
+type Extension interface {
+	// Name is the key the extension is advertised under in the "m" dictionary
+	Name() string
+	// ExtendHandshake adds the extension's own fields to our extension handshake
+	ExtendHandshake(handshake *ExtensionHandshake)
+	// HandleMessage processes a message the peer sent to this extension
+	HandleMessage(peerConn *PeerConnection, payload []byte) error
+}
+
+// ExtensionMessage represents a BitTorrent extension message
+type ExtensionMessage struct {
+	length      uint32
+	messageID   uint8
+	extensionID uint8
+	payload     []byte
+}
+
+// ExtensionMessageBuilder handles building extension messages
+type ExtensionMessageBuilder struct {
+	message   ExtensionMessage
+	handshake *ExtensionHandshake
+}
+
+// ExtensionHandshake is the BEP 10 handshake dictionary exchanged by both sides
+type ExtensionHandshake struct {
+	M            map[string]int `bencode:"m"`
+	Version      string         `bencode:"v,omitempty"`
+	Port         int            `bencode:"p,omitempty"`
+	RequestQueue int            `bencode:"reqq,omitempty"`
+	YourIP       string         `bencode:"yourip,omitempty"`
+	IPv4         string         `bencode:"ipv4,omitempty"`
+	IPv6         string         `bencode:"ipv6,omitempty"`
+	MetadataSize int            `bencode:"metadata_size,omitempty"`
+	UploadOnly   int            `bencode:"upload_only,omitempty"`
+}
+
+// YourIPAddr returns the address the peer sees us connecting from, if it told us
+func (h *ExtensionHandshake) YourIPAddr() net.IP {
+	return compactIP(h.YourIP)
+}
+
+// ExternalIPs returns the addresses the peer says it can be reached on
+func (h *ExtensionHandshake) ExternalIPs() []net.IP {
+	var ips []net.IP
+	for _, ip := range []net.IP{compactIP(h.IPv4), compactIP(h.IPv6)} {
+		if ip != nil {
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}
+
+// IsUploadOnly reports whether the peer only uploads, typically because it is a seed
+func (h *ExtensionHandshake) IsUploadOnly() bool {
+	return h.UploadOnly != 0
+}
+
+// compactIP decodes a 4 or 16 byte binary address
+func compactIP(raw string) net.IP {
+	if len(raw) != net.IPv4len && len(raw) != net.IPv6len {
+		return nil
+	}
+	return net.IP([]byte(raw))
+}
+
+// ExtensionRegistry assigns local message IDs to the extensions of a connection
+type ExtensionRegistry struct {
+	mu         sync.Mutex
+	ids        map[string]uint8
+	extensions []Extension
+}
+
+// NewExtensionRegistry creates an empty registry
+func NewExtensionRegistry() *ExtensionRegistry {
+	return &ExtensionRegistry{ids: make(map[string]uint8)}
+}
+
+// Register adds an extension and returns its local ID, replacing any
+// extension registered under the same name
+func (r *ExtensionRegistry) Register(extension Extension) uint8 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if id, ok := r.ids[extension.Name()]; ok {
+		r.extensions[id-1] = extension
+		return id
+	}
+	if len(r.extensions) == 255 {
+		panic("extension registry is full")
+	}
+
+	r.extensions = append(r.extensions, extension)
+	id := uint8(len(r.extensions))
+	r.ids[extension.Name()] = id
+	return id
+}
+
+// ID returns the local ID assigned to an extension
+func (r *ExtensionRegistry) ID(name string) (uint8, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id, ok := r.ids[name]
+	return id, ok
+}
+
+// Lookup returns the extension registered under a local ID
+func (r *ExtensionRegistry) Lookup(id uint8) (Extension, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if id == HandshakeExtensionID || int(id) > len(r.extensions) {
+		return nil, false
+	}
+	return r.extensions[id-1], true
+}
+
+// Get returns the extension registered under a name
+func (r *ExtensionRegistry) Get(name string) (Extension, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id, ok := r.ids[name]
+	if !ok {
+		return nil, false
+	}
+	return r.extensions[id-1], true
+}
+
+// Handshake returns our extension handshake with every registered extension's contribution
+func (r *ExtensionRegistry) Handshake() *ExtensionHandshake {
+	r.mu.Lock()
+	extensions := append([]Extension{}, r.extensions...)
+	r.mu.Unlock()
+
+	handshake := &ExtensionHandshake{
+		M:            make(map[string]int, len(extensions)),
+		Version:      ClientVersion,
+		RequestQueue: DefaultRequestQueue,
+	}
+	for i, extension := range extensions {
+		handshake.M[extension.Name()] = i + 1
+		extension.ExtendHandshake(handshake)
+	}
+	return handshake
+}
+
+// NewExtensionMessageBuilder creates a new extension message builder
+func NewExtensionMessageBuilder() *ExtensionMessageBuilder {
+	return &ExtensionMessageBuilder{
+		message: ExtensionMessage{
+			messageID: ExtensionMessageID,
+		},
+	}
+}
+
+// WithHandshakePayload adds handshake payload advertising the registered extensions
+func (b *ExtensionMessageBuilder) WithHandshakePayload(registry *ExtensionRegistry) *ExtensionMessageBuilder {
+	b.message.extensionID = HandshakeExtensionID
+	b.handshake = registry.Handshake()
+	return b
+}
+
+// WithExtensionID sets the peer's ID for the extension the message is addressed to
+func (b *ExtensionMessageBuilder) WithExtensionID(id uint8) *ExtensionMessageBuilder {
+	b.message.extensionID = id
+	return b
+}
+
+// WithPayload sets the extension specific payload
+func (b *ExtensionMessageBuilder) WithPayload(payload []byte) *ExtensionMessageBuilder {
+	b.message.payload = payload
+	b.message.length = uint32(2 + len(payload)) // 1 byte for message ID, 1 byte for extension ID
+	return b
+}
+
+// WithListenPort advertises the port we accept incoming connections on
+func (b *ExtensionMessageBuilder) WithListenPort(port int) *ExtensionMessageBuilder {
+	if b.handshake != nil {
+		b.handshake.Port = port
+	}
+	return b
+}
+
+// WithYourIP tells the peer which address we see it connecting from
+func (b *ExtensionMessageBuilder) WithYourIP(addr net.Addr) *ExtensionMessageBuilder {
+	if b.handshake == nil {
+		return b
+	}
+	if ip := addrIP(addr); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			b.handshake.YourIP = string(ip4)
+		} else {
+			b.handshake.YourIP = string(ip.To16())
+		}
+	}
+	return b
+}
+
+// Build constructs the final extension message
+func (b *ExtensionMessageBuilder) Build() []byte {
+	if b.handshake != nil {
+		var payload bytes.Buffer
+		_ = bencode.Marshal(&payload, *b.handshake)
+		b.message.payload = payload.Bytes()
+		b.message.length = uint32(2 + len(b.message.payload)) // 1 byte for message ID, 1 byte for extension ID
+	}
+
+	buf := make([]byte, 4+b.message.length)
+
+	// Write message length
+	binary.BigEndian.PutUint32(buf[0:4], b.message.length)
+
+	// Write extension message ID
+	buf[4] = b.message.messageID
+
+	// Write extension ID
+	buf[5] = b.message.extensionID
+
+	// Write payload
+	copy(buf[6:], b.message.payload)
+
+	return buf
+}
+
+func sendExtensionHandshake(conn net.Conn, registry *ExtensionRegistry, listenPort int) error {
+	message := NewExtensionMessageBuilder().
+		WithHandshakePayload(registry).
+		WithListenPort(listenPort).
+		WithYourIP(conn.RemoteAddr()).
+		Build()
+
+	_, err := conn.Write(message)
+	if err != nil {
+		return fmt.Errorf("failed to send extension handshake: %w", err)
+	}
+
+	return nil
+}
+
+// parseExtensionHandshake decodes the dictionary of an extension handshake payload
+func parseExtensionHandshake(payload []byte) (*ExtensionHandshake, error) {
+	var handshake ExtensionHandshake
+	if err := bencode.Unmarshal(bytes.NewReader(payload), &handshake); err != nil {
+		return nil, fmt.Errorf("failed to decode extension handshake: %w", err)
+	}
+	return &handshake, nil
+}
@@ -0,0 +1,72 @@
+package peerwire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+)
+
+// readExtensionHandshake reads the extension handshake sent on conn and decodes its payload
+func readExtensionHandshake(t *testing.T, conn net.Conn) *ExtensionHandshake {
+	t.Helper()
+	var length [4]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		t.Fatalf("failed to read message length: %v", err)
+	}
+	message := make([]byte, binary.BigEndian.Uint32(length[:]))
+	if _, err := io.ReadFull(conn, message); err != nil {
+		t.Fatalf("failed to read message: %v", err)
+	}
+	if len(message) < 2 || message[0] != ExtensionMessageID || message[1] != HandshakeExtensionID {
+		t.Fatalf("sent %x, want an extension handshake", message)
+	}
+
+	handshake, err := parseExtensionHandshake(message[2:])
+	if err != nil {
+		t.Fatalf("failed to decode sent handshake: %v", err)
+	}
+	return handshake
+}
+
+func TestStartExtensionsSendsHandshake(t *testing.T) {
+	metadata := bytes.Repeat([]byte{'x'}, 100)
+
+	tests := []struct {
+		name       string
+		listenPort int
+	}{
+		{"listening", 51413},
+		{"not listening", 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a, b := pipe(t)
+			peerConn := newPeerConnection(a, testInfoHash, bytes.Repeat([]byte{'p'}, PeerIDLength), Config{ListenPort: test.listenPort})
+			peerConn.Capabilities.Extensions = true
+			peerConn.RegisterExtension(NewMetadataExtension(metadata))
+
+			sent := make(chan error, 1)
+			go func() { sent <- peerConn.StartExtensions() }()
+			handshake := readExtensionHandshake(t, b)
+			if err := <-sent; err != nil {
+				t.Fatalf("StartExtensions failed: %v", err)
+			}
+
+			if handshake.Port != test.listenPort {
+				t.Errorf("advertised port %d, want %d", handshake.Port, test.listenPort)
+			}
+			if handshake.M[UTMetadataName] != 1 {
+				t.Errorf("advertised extensions %v, want %s as 1", handshake.M, UTMetadataName)
+			}
+			if handshake.MetadataSize != len(metadata) {
+				t.Errorf("advertised metadata size %d, want %d", handshake.MetadataSize, len(metadata))
+			}
+			if handshake.Version != ClientVersion || handshake.RequestQueue != DefaultRequestQueue {
+				t.Errorf("advertised version %q and request queue %d, want %q and %d",
+					handshake.Version, handshake.RequestQueue, ClientVersion, DefaultRequestQueue)
+			}
+		})
+	}
+}
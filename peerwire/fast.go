@@ -0,0 +1,138 @@
+package peerwire
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+)
+
+// Message IDs added by the Fast Extension (BEP 6)
+const (
+	IDSuggestPiece  = uint8(13)
+	IDHaveAll       = uint8(14)
+	IDHaveNone      = uint8(15)
+	IDRejectRequest = uint8(16)
+	IDAllowedFast   = uint8(17)
+)
+
+// AllowedFastCount is the number of pieces a peer may request from us while choked
+const AllowedFastCount = 10
+
+var (
+	// ErrRequestRejected reports a block request the peer explicitly refused
+	ErrRequestRejected = errors.New("request rejected by peer")
+	// ErrPeerChoked reports a choke that dropped our outstanding requests
+	ErrPeerChoked = errors.New("choked by peer")
+)
+
+// allowedFastSet computes the canonical allowed fast set (BEP 6) for a peer,
+// which is only defined for IPv4 addresses
+func allowedFastSet(ip net.IP, infoHash []byte, numPieces, count int) []int {
+	ip4 := ip.To4()
+	if ip4 == nil || numPieces == 0 {
+		return nil
+	}
+	count = min(count, numPieces)
+
+	// Peers on the same /24 share a set so they can't collect extra free pieces
+	x := append([]byte{ip4[0], ip4[1], ip4[2], 0}, infoHash...)
+
+	set := make([]int, 0, count)
+	for len(set) < count {
+		hash := sha1.Sum(x)
+		x = hash[:]
+		for i := 0; i < 5 && len(set) < count; i++ {
+			index := int(binary.BigEndian.Uint32(x[i*4:]) % uint32(numPieces))
+			if !slices.Contains(set, index) {
+				set = append(set, index)
+			}
+		}
+	}
+	return set
+}
+
+// StartFast sends the opening messages of the Fast Extension: our (empty) piece
+// availability and the peer's allowed fast set
+func (p *PeerConnection) StartFast(numPieces int) error {
+	if !p.Capabilities.Fast {
+		return nil
+	}
+
+	if _, err := p.Conn.Write(NewHaveNoneMessage()); err != nil {
+		return fmt.Errorf("failed to send have none: %w", err)
+	}
+
+	for _, index := range allowedFastSet(addrIP(p.Conn.RemoteAddr()), p.InfoHash, numPieces, AllowedFastCount) {
+		if _, err := p.Conn.Write(NewAllowedFastMessage(uint32(index))); err != nil {
+			return fmt.Errorf("failed to send allowed fast: %w", err)
+		}
+	}
+	return nil
+}
+
+// handleFastMessage updates the peer state from a Fast Extension message
+func (p *PeerConnection) handleFastMessage(id uint8, payload []byte) error {
+	if !p.Capabilities.Fast {
+		return fmt.Errorf("peer sent fast extension message %d without negotiating it", id)
+	}
+
+	switch id {
+	case IDHaveAll:
+		p.hasAll = true
+		p.pieces = nil
+
+	case IDHaveNone:
+		p.hasAll = false
+		p.pieces = nil
+
+	case IDSuggestPiece, IDAllowedFast:
+		if len(payload) < 4 {
+			return fmt.Errorf("fast extension message %d too short", id)
+		}
+		index := int(binary.BigEndian.Uint32(payload))
+		if err := p.checkPieceIndex(index); err != nil {
+			return err
+		}
+		if id == IDSuggestPiece {
+			p.suggested[index] = true
+		} else {
+			p.allowedFast[index] = true
+		}
+
+	case IDRejectRequest:
+		if len(payload) < 12 {
+			return fmt.Errorf("reject request message too short")
+		}
+	}
+	return nil
+}
+
+// rejectRequest refuses a block request, as we don't upload pieces
+func (p *PeerConnection) rejectRequest(payload []byte) error {
+	if len(payload) < 12 {
+		return fmt.Errorf("request message too short")
+	}
+
+	message := NewRejectRequestMessage(
+		binary.BigEndian.Uint32(payload[0:4]),
+		binary.BigEndian.Uint32(payload[4:8]),
+		binary.BigEndian.Uint32(payload[8:12]),
+	)
+	if _, err := p.Conn.Write(message); err != nil {
+		return fmt.Errorf("failed to reject request: %w", err)
+	}
+	return nil
+}
+
+// IsAllowedFast reports whether the peer lets us request a piece while choked
+func (p *PeerConnection) IsAllowedFast(index int) bool {
+	return p.allowedFast[index]
+}
+
+// IsSuggested reports whether the peer suggested we download a piece
+func (p *PeerConnection) IsSuggested(index int) bool {
+	return p.suggested[index]
+}
@@ -0,0 +1,205 @@
+package peerwire
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+)
+
+const (
+	ProtocolLength  = 19
+	ProtocolString  = "BitTorrent protocol"
+	ReservedBytes   = 8
+	InfoHashLength  = 20
+	PeerIDLength    = 20
+	HandshakeLength = 1 + ProtocolLength + ReservedBytes + InfoHashLength + PeerIDLength
+)
+
+var (
+	ErrInvalidProtocol  = errors.New("unexpected protocol string")
+	ErrInfoHashMismatch = errors.New("info hash does not match")
+	ErrSelfConnection   = errors.New("connected to ourselves")
+	ErrDuplicatePeer    = errors.New("already connected to this peer id")
+)
+
+// HandshakeError reports a peer whose handshake we refused, its address is
+// worth banning as it would be refused again
+type HandshakeError struct {
+	Addr string
+	Err  error
+}
+
+func (e *HandshakeError) Error() string {
+	return fmt.Sprintf("invalid handshake from %s: %v", e.Addr, e.Err)
+}
+
+func (e *HandshakeError) Unwrap() error {
+	return e.Err
+}
+
+// Capabilities are the protocol extensions advertised in the reserved bytes
+type Capabilities struct {
+	Extensions bool // Extension protocol (BEP 10)
+	Fast       bool // Fast Extension (BEP 6)
+	DHT        bool // DHT port message (BEP 5)
+}
+
+// parseCapabilities reads the capability bits from the reserved bytes
+func parseCapabilities(reserved []byte) Capabilities {
+	return Capabilities{
+		Extensions: reserved[5]&0x10 != 0,
+		Fast:       reserved[7]&0x04 != 0,
+		DHT:        reserved[7]&0x01 != 0,
+	}
+}
+
+// And returns the capabilities supported by both sides of a connection
+func (c Capabilities) And(other Capabilities) Capabilities {
+	return Capabilities{
+		Extensions: c.Extensions && other.Extensions,
+		Fast:       c.Fast && other.Fast,
+		DHT:        c.DHT && other.DHT,
+	}
+}
+
+// handshakeCapabilities returns the capabilities we advertise in a handshake we built
+func handshakeCapabilities(handshake []byte) Capabilities {
+	return parseCapabilities(handshake[1+ProtocolLength:])
+}
+
+// Handshake is a handshake received from a peer
+type Handshake struct {
+	Reserved     []byte
+	InfoHash     []byte
+	PeerID       []byte
+	Capabilities Capabilities
+}
+
+// HandshakeBuilder handles the construction of BitTorrent handshake messages
+type HandshakeBuilder struct {
+	protocol []byte
+	reserved []byte
+	infoHash []byte
+	peerID   []byte
+}
+
+// NewHandshakeBuilder creates a new HandshakeBuilder with default protocol
+func NewHandshakeBuilder() *HandshakeBuilder {
+	return &HandshakeBuilder{
+		protocol: []byte(ProtocolString),
+		reserved: make([]byte, ReservedBytes),
+	}
+}
+
+// WithInfoHash sets the info hash
+func (b *HandshakeBuilder) WithInfoHash(infoHash []byte) *HandshakeBuilder {
+	if len(infoHash) != InfoHashLength {
+		panic("invalid info hash length")
+	}
+	b.infoHash = make([]byte, InfoHashLength)
+	copy(b.infoHash, infoHash)
+	return b
+}
+
+// WithPeerID sets the peer ID
+func (b *HandshakeBuilder) WithPeerID(peerID []byte) *HandshakeBuilder {
+	if len(peerID) != PeerIDLength {
+		panic("invalid peer ID length")
+	}
+	b.peerID = make([]byte, PeerIDLength)
+	copy(b.peerID, peerID)
+	return b
+}
+
+// WithExtensions sets the reserved bytes with extension bit
+func (b *HandshakeBuilder) WithExtensions() *HandshakeBuilder {
+	// Set the 20th bit from right (5th byte, 5th bit)
+	b.reserved[5] |= 0x10
+	return b
+}
+
+// WithFastExtension sets the reserved bit for the Fast Extension (BEP 6)
+func (b *HandshakeBuilder) WithFastExtension() *HandshakeBuilder {
+	// Set the 3rd bit from right (8th byte, 3rd bit)
+	b.reserved[7] |= 0x04
+	return b
+}
+
+// Build constructs and returns the complete handshake message
+func (b *HandshakeBuilder) Build() []byte {
+	if b.infoHash == nil || b.peerID == nil {
+		panic("info hash and peer ID are required")
+	}
+
+	buffer := bytes.NewBuffer(make([]byte, 0, HandshakeLength))
+	buffer.WriteByte(byte(ProtocolLength))
+	buffer.Write(b.protocol)
+	buffer.Write(b.reserved)
+	buffer.Write(b.infoHash)
+	buffer.Write(b.peerID)
+
+	return buffer.Bytes()
+}
+
+func createHandshake(infoHash, peerID []byte) []byte {
+	return NewHandshakeBuilder().
+		WithInfoHash(infoHash).
+		WithPeerID(peerID).
+		Build()
+}
+
+func createMagnetHandshake(infoHash, peerID []byte) []byte {
+	return NewHandshakeBuilder().
+		WithInfoHash(infoHash).
+		WithPeerID(peerID).
+		WithExtensions().
+		Build()
+}
+
+func sendHandshake(conn net.Conn, handshake []byte) error {
+	_, err := conn.Write(handshake)
+	if err != nil {
+		return fmt.Errorf("failed to send handshake: %w", err)
+	}
+	return nil
+}
+
+// readHandshake reads the peer's handshake, checking the protocol string before
+// waiting for the rest so other protocols are refused early
+func readHandshake(conn net.Conn) (*Handshake, error) {
+	response := make([]byte, HandshakeLength)
+	if _, err := io.ReadFull(conn, response[:1+ProtocolLength]); err != nil {
+		return nil, fmt.Errorf("failed to read handshake: %w", err)
+	}
+	if response[0] != ProtocolLength || string(response[1:1+ProtocolLength]) != ProtocolString {
+		return nil, &HandshakeError{Addr: conn.RemoteAddr().String(), Err: ErrInvalidProtocol}
+	}
+
+	if _, err := io.ReadFull(conn, response[1+ProtocolLength:]); err != nil {
+		return nil, fmt.Errorf("failed to read handshake: %w", err)
+	}
+
+	reserved := response[1+ProtocolLength : 1+ProtocolLength+ReservedBytes]
+	return &Handshake{
+		Reserved:     reserved,
+		InfoHash:     response[HandshakeLength-PeerIDLength-InfoHashLength : HandshakeLength-PeerIDLength],
+		PeerID:       response[HandshakeLength-PeerIDLength:],
+		Capabilities: parseCapabilities(reserved),
+	}, nil
+}
+
+// verifyHandshake checks that the peer joined the torrent we asked for and isn't us
+func verifyHandshake(conn net.Conn, handshake *Handshake, infoHash, ourPeerID []byte) error {
+	var err error
+	switch {
+	case !bytes.Equal(handshake.InfoHash, infoHash):
+		err = ErrInfoHashMismatch
+	case bytes.Equal(handshake.PeerID, ourPeerID):
+		err = ErrSelfConnection
+	default:
+		return nil
+	}
+	return &HandshakeError{Addr: conn.RemoteAddr().String(), Err: err}
+}
@@ -0,0 +1,171 @@
+package peerwire
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+// Listener accepts incoming peer connections over TCP and uTP on the same port
+type Listener struct {
+	tcp   net.Listener
+	utp   *utpListener
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+}
+
+// Listen listens for peers on a TCP address and the UDP port of the same
+// number, a port of 0 picks a free one
+func Listen(addr string) (*Listener, error) {
+	tcp, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for peers: %w", err)
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		tcp.Close()
+		return nil, fmt.Errorf("invalid listen address %q: %w", addr, err)
+	}
+	port := tcp.Addr().(*net.TCPAddr).Port
+	utp, err := listenUTP(net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		tcp.Close()
+		return nil, fmt.Errorf("failed to listen for uTP peers: %w", err)
+	}
+
+	l := &Listener{
+		tcp:   tcp,
+		utp:   utp,
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+	go l.acceptFrom(tcp)
+	go l.acceptFrom(utp)
+	return l, nil
+}
+
+func (l *Listener) acceptFrom(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+
+		select {
+		case l.conns <- conn:
+		case <-l.done:
+			conn.Close()
+			return
+		}
+	}
+}
+
+// Accept waits for the next incoming connection on either transport
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close stops both listeners
+func (l *Listener) Close() error {
+	l.once.Do(func() {
+		close(l.done)
+	})
+	return errors.Join(l.tcp.Close(), l.utp.Close())
+}
+
+// Addr returns the TCP address, uTP listens on the same port
+func (l *Listener) Addr() net.Addr {
+	return l.tcp.Addr()
+}
+
+// Port returns the port to announce to trackers
+func (l *Listener) Port() int {
+	return l.tcp.Addr().(*net.TCPAddr).Port
+}
+
+// AcceptPeerConnection completes the handshake with a peer that connected to us
+// for one of the given torrents. Plaintext and MSE connections are both
+// accepted as far as the encryption policy allows
+func AcceptPeerConnection(ctx context.Context, conn net.Conn, infoHashes [][]byte, config Config) (*PeerConnection, error) {
+	release := guardConn(ctx, conn, config.Timeouts.Handshake)
+	defer release()
+
+	peerConn, err := acceptPeerConnection(conn, infoHashes, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return peerConn, nil
+}
+
+func acceptPeerConnection(conn net.Conn, infoHashes [][]byte, config Config) (*PeerConnection, error) {
+	peerID, err := config.peerID()
+	if err != nil {
+		return nil, err
+	}
+
+	// A plaintext handshake starts with the protocol string, anything else is
+	// the public key of an encryption handshake
+	reader := bufio.NewReader(conn)
+	start, err := reader.Peek(1 + ProtocolLength)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read handshake: %w", err)
+	}
+	conn = &bufferedConn{Conn: conn, reader: reader}
+
+	plaintext := start[0] == ProtocolLength && string(start[1:]) == ProtocolString
+	switch {
+	case plaintext && config.Encryption == EncryptionRequire:
+		return nil, fmt.Errorf("peer did not offer encryption")
+	case !plaintext:
+		conn, _, err = acceptEncryptedConn(conn, infoHashes, config.Encryption)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	remote, err := readHandshake(conn)
+	if err != nil {
+		return nil, err
+	}
+	known := slices.ContainsFunc(infoHashes, func(infoHash []byte) bool {
+		return bytes.Equal(infoHash, remote.InfoHash)
+	})
+	if !known {
+		return nil, &HandshakeError{Addr: conn.RemoteAddr().String(), Err: ErrInfoHashMismatch}
+	}
+	if bytes.Equal(remote.PeerID, peerID) {
+		return nil, &HandshakeError{Addr: conn.RemoteAddr().String(), Err: ErrSelfConnection}
+	}
+
+	handshake := NewHandshakeBuilder().
+		WithInfoHash(remote.InfoHash).
+		WithPeerID(peerID).
+		WithExtensions().
+		WithFastExtension().
+		Build()
+	if err := sendHandshake(conn, handshake); err != nil {
+		return nil, err
+	}
+
+	peerConn := newPeerConnection(conn, remote.InfoHash, remote.PeerID, config)
+	peerConn.Capabilities = handshakeCapabilities(handshake).And(remote.Capabilities)
+	config.logger(conn.RemoteAddr().String(), remote.InfoHash).Debug("accepted peer",
+		"peer_id", peerConn.PeerID,
+		"client", peerConn.Client.String(),
+		"encrypted", !plaintext)
+	return peerConn, nil
+}
@@ -0,0 +1,110 @@
+package peerwire
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// KeepAliveInterval is how long we stay quiet before sending a keep-alive
+const KeepAliveInterval = 2 * time.Minute
+
+var (
+	// ErrPeerSilent reports a peer that sent nothing for longer than the idle timeout
+	ErrPeerSilent = errors.New("peer went silent")
+	// ErrPeerSnubbed reports a peer that stopped sending the blocks we requested
+	ErrPeerSnubbed = errors.New("snubbed by peer")
+)
+
+// monitoredConn tracks traffic on a peer connection, sending keep-alives when we
+// have nothing else to say and closing the connection when the peer goes silent
+type monitoredConn struct {
+	net.Conn
+	idleTimeout time.Duration
+	writeMu     sync.Mutex // Keeps keep-alives from splitting other messages
+	lastRead    atomic.Int64
+	lastWrite   atomic.Int64
+	silent      atomic.Bool
+
+	mu     sync.Mutex
+	timer  *time.Timer
+	closed bool
+}
+
+// newMonitoredConn starts monitoring conn, an idle timeout of zero keeps silent
+// peers connected
+func newMonitoredConn(conn net.Conn, idleTimeout time.Duration) *monitoredConn {
+	c := &monitoredConn{Conn: conn, idleTimeout: idleTimeout}
+	now := time.Now().UnixNano()
+	c.lastRead.Store(now)
+	c.lastWrite.Store(now)
+
+	c.mu.Lock()
+	c.timer = time.AfterFunc(c.nextCheck(time.Now()), c.check)
+	c.mu.Unlock()
+	return c
+}
+
+func (c *monitoredConn) Read(buf []byte) (int, error) {
+	n, err := c.Conn.Read(buf)
+	if n > 0 {
+		c.lastRead.Store(time.Now().UnixNano())
+	}
+	if err != nil && c.silent.Load() {
+		err = ErrPeerSilent
+	}
+	return n, err
+}
+
+func (c *monitoredConn) Write(buf []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	n, err := c.Conn.Write(buf)
+	if n > 0 {
+		c.lastWrite.Store(time.Now().UnixNano())
+	}
+	return n, err
+}
+
+func (c *monitoredConn) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	c.timer.Stop()
+	c.mu.Unlock()
+	return c.Conn.Close()
+}
+
+// check drops a silent peer or sends a keep-alive when one is due
+func (c *monitoredConn) check() {
+	now := time.Now()
+	if c.idleTimeout > 0 && now.Sub(time.Unix(0, c.lastRead.Load())) >= c.idleTimeout {
+		c.silent.Store(true)
+		c.Close()
+		return
+	}
+
+	if now.Sub(time.Unix(0, c.lastWrite.Load())) >= KeepAliveInterval {
+		if _, err := c.Write(NewKeepAliveMessage()); err != nil {
+			c.Close()
+			return
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.timer.Reset(c.nextCheck(time.Now()))
+	}
+}
+
+// nextCheck is the time until a keep-alive or the idle timeout is next due
+func (c *monitoredConn) nextCheck(now time.Time) time.Duration {
+	next := time.Unix(0, c.lastWrite.Load()).Add(KeepAliveInterval).Sub(now)
+	if c.idleTimeout > 0 {
+		next = min(next, time.Unix(0, c.lastRead.Load()).Add(c.idleTimeout).Sub(now))
+	}
+	return max(next, time.Second)
+}
@@ -1,4 +1,4 @@
-package main
+package peerwire
 
 import (
 	"encoding/binary"
@@ -75,3 +75,31 @@ func NewRequestMessage(index, begin, length uint32) []byte {
 	binary.BigEndian.PutUint32(payload[8:12], length)
 	return NewMessageBuilder().WithID(IDRequest).WithPayload(payload).Build()
 }
+
+func NewHaveAllMessage() []byte {
+	return NewMessageBuilder().WithID(IDHaveAll).Build()
+}
+
+func NewHaveNoneMessage() []byte {
+	return NewMessageBuilder().WithID(IDHaveNone).Build()
+}
+
+func NewRejectRequestMessage(index, begin, length uint32) []byte {
+	payload := NewRequestPayloadBuilder().
+		WithIndex(index).
+		WithBegin(begin).
+		WithLength(length).
+		Build()
+	return NewMessageBuilder().WithID(IDRejectRequest).WithPayload(payload).Build()
+}
+
+func NewAllowedFastMessage(pieceIndex uint32) []byte {
+	payload := make([]byte, 4)
+	binary.BigEndian.PutUint32(payload, pieceIndex)
+	return NewMessageBuilder().WithID(IDAllowedFast).WithPayload(payload).Build()
+}
+
+// NewKeepAliveMessage returns a keep-alive, a message with a length of zero
+func NewKeepAliveMessage() []byte {
+	return make([]byte, 4)
+}
@@ -0,0 +1,271 @@
+package peerwire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/codecrafters-io/bittorrent-starter-go/bencode"
+	bencodego "github.com/jackpal/bencode-go"
+	"net"
+	"sync"
+)
+
+const (
+	MetadataRequestType = 0
+	MetadataDataType    = 1
+	MetadataRejectType  = 2
+
+	MetadataPieceSize = 16384            // Size of every metadata piece but the last (BEP 9)
+	MaxMetadataSize   = 16 * 1024 * 1024 // Upper bound on metadata_size accepted from peers
+)
+
+type MetadataRequest struct {
+	MessageType int `bencode:"msg_type"`
+	Piece       int `bencode:"piece"`
+}
+
+type MetadataResponse struct {
+	MessageType int `bencode:"msg_type"`
+	Piece       int `bencode:"piece"`
+	TotalSize   int `bencode:"total_size,omitempty"`
+}
+
+type MetadataRequestBuilder struct {
+	extensionID uint8
+	piece       int
+}
+
+func NewMetadataRequestBuilder() *MetadataRequestBuilder {
+	return &MetadataRequestBuilder{}
+}
+
+func (b *MetadataRequestBuilder) WithExtensionID(id uint8) *MetadataRequestBuilder {
+	b.extensionID = id
+	return b
+}
+
+// WithPiece sets the index of the metadata piece to request
+func (b *MetadataRequestBuilder) WithPiece(piece int) *MetadataRequestBuilder {
+	b.piece = piece
+	return b
+}
+
+func (b *MetadataRequestBuilder) Build() []byte {
+	request := MetadataRequest{
+		MessageType: MetadataRequestType,
+		Piece:       b.piece,
+	}
+
+	payload := bytes.Buffer{}
+	_ = bencodego.Marshal(&payload, request)
+
+	messageLength := uint32(2 + payload.Len()) // 1 for message ID, 1 for extension ID
+	message := make([]byte, 4+messageLength)
+
+	binary.BigEndian.PutUint32(message[0:4], messageLength)
+	message[4] = ExtensionMessageID
+	message[5] = b.extensionID
+
+	copy(message[6:], payload.Bytes())
+
+	return message
+}
+
+func SendMetadataRequest(conn net.Conn, extensionID uint8, piece int) error {
+	message := NewMetadataRequestBuilder().
+		WithExtensionID(extensionID).
+		WithPiece(piece).
+		Build()
+
+	_, err := conn.Write(message)
+	return err
+}
+
+// MetadataResponseBuilder handles the construction of ut_metadata data and reject messages
+type MetadataResponseBuilder struct {
+	extensionID uint8
+	response    MetadataResponse
+	data        []byte
+}
+
+func NewMetadataResponseBuilder() *MetadataResponseBuilder {
+	return &MetadataResponseBuilder{
+		response: MetadataResponse{MessageType: MetadataRejectType},
+	}
+}
+
+// WithExtensionID sets the ut_metadata ID the remote peer assigned
+func (b *MetadataResponseBuilder) WithExtensionID(id uint8) *MetadataResponseBuilder {
+	b.extensionID = id
+	return b
+}
+
+// WithPiece sets the index of the metadata piece being answered
+func (b *MetadataResponseBuilder) WithPiece(piece int) *MetadataResponseBuilder {
+	b.response.Piece = piece
+	return b
+}
+
+// WithData turns the message into a data message carrying a metadata piece
+func (b *MetadataResponseBuilder) WithData(data []byte, totalSize int) *MetadataResponseBuilder {
+	b.response.MessageType = MetadataDataType
+	b.response.TotalSize = totalSize
+	b.data = data
+	return b
+}
+
+func (b *MetadataResponseBuilder) Build() []byte {
+	payload := bytes.Buffer{}
+	_ = bencodego.Marshal(&payload, b.response)
+	payload.Write(b.data)
+
+	messageLength := uint32(2 + payload.Len()) // 1 for message ID, 1 for extension ID
+	message := make([]byte, 4+messageLength)
+
+	binary.BigEndian.PutUint32(message[0:4], messageLength)
+	message[4] = ExtensionMessageID
+	message[5] = b.extensionID
+
+	copy(message[6:], payload.Bytes())
+
+	return message
+}
+
+// UTMetadataName is the name ut_metadata is advertised under in the "m" dictionary
+const UTMetadataName = "ut_metadata"
+
+// MetadataExtension implements ut_metadata (BEP 9) on one connection, serving
+// the info dictionary when we have it and collecting answers to our requests
+type MetadataExtension struct {
+	mu        sync.Mutex
+	metadata  []byte
+	responses chan metadataMessage
+}
+
+type metadataMessage struct {
+	response *MetadataResponse
+	data     []byte
+}
+
+// NewMetadataExtension creates the extension, metadata is nil when we don't have it yet
+func NewMetadataExtension(metadata []byte) *MetadataExtension {
+	return &MetadataExtension{
+		metadata:  metadata,
+		responses: make(chan metadataMessage, 16),
+	}
+}
+
+func (e *MetadataExtension) Name() string {
+	return UTMetadataName
+}
+
+// ExtendHandshake advertises metadata_size once we can serve the metadata
+func (e *MetadataExtension) ExtendHandshake(handshake *ExtensionHandshake) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.metadata != nil {
+		handshake.MetadataSize = len(e.metadata)
+	}
+}
+
+// HandleMessage answers requests and queues data and reject messages for the fetcher
+func (e *MetadataExtension) HandleMessage(peerConn *PeerConnection, payload []byte) error {
+	response, data, err := parseMetadataMessage(payload)
+	if err != nil {
+		return err
+	}
+
+	if response.MessageType == MetadataRequestType {
+		return e.serve(peerConn, response.Piece)
+	}
+
+	// Drop unsolicited answers nobody is waiting for
+	select {
+	case e.responses <- metadataMessage{response: response, data: data}:
+	default:
+	}
+	return nil
+}
+
+// serve answers a ut_metadata request with the piece, or a reject when we
+// don't have the metadata or the piece doesn't exist
+func (e *MetadataExtension) serve(peerConn *PeerConnection, piece int) error {
+	remoteID, ok := peerConn.RemoteExtensionID(UTMetadataName)
+	if !ok {
+		return nil // The peer never told us how to address ut_metadata messages
+	}
+
+	builder := NewMetadataResponseBuilder().
+		WithExtensionID(remoteID).
+		WithPiece(piece)
+
+	e.mu.Lock()
+	metadata := e.metadata
+	e.mu.Unlock()
+
+	if metadata != nil && piece >= 0 && piece < MetadataPieceCount(len(metadata)) {
+		start := piece * MetadataPieceSize
+		end := min(start+MetadataPieceSize, len(metadata))
+		builder.WithData(metadata[start:end], len(metadata))
+	}
+
+	if _, err := peerConn.Conn.Write(builder.Build()); err != nil {
+		return fmt.Errorf("failed to send metadata response: %w", err)
+	}
+	return nil
+}
+
+// Receive reads from the connection until a data or reject message arrives
+func (e *MetadataExtension) Receive(peerConn *PeerConnection) (*MetadataResponse, []byte, error) {
+	defer peerConn.ExpectWithin(peerConn.timeouts.Request)()
+
+	for {
+		select {
+		case message := <-e.responses:
+			return message.response, message.data, nil
+		default:
+		}
+
+		// Other messages are not useful while fetching metadata
+		if _, _, _, err := peerConn.readMessage(); err != nil {
+			return nil, nil, fmt.Errorf("failed to read metadata message: %w", err)
+		}
+	}
+}
+
+// parseMetadataMessage splits a ut_metadata payload into its bencoded header and piece data
+func parseMetadataMessage(payload []byte) (*MetadataResponse, []byte, error) {
+	dictEnd := 0
+	decoded, err := bencode.Decode(string(payload), &dictEnd)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode metadata message: %w", err)
+	}
+
+	dict, ok := decoded.(map[string]interface{})
+	if !ok {
+		return nil, nil, fmt.Errorf("invalid metadata message: expected dictionary")
+	}
+
+	messageType, ok := dict["msg_type"].(int)
+	if !ok {
+		return nil, nil, fmt.Errorf("invalid metadata message: missing msg_type")
+	}
+	piece, ok := dict["piece"].(int)
+	if !ok {
+		return nil, nil, fmt.Errorf("invalid metadata message: missing piece")
+	}
+	totalSize, _ := dict["total_size"].(int)
+
+	response := &MetadataResponse{
+		MessageType: messageType,
+		Piece:       piece,
+		TotalSize:   totalSize,
+	}
+	return response, payload[dictEnd:], nil
+}
+
+// MetadataPieceCount returns the number of ut_metadata pieces for a metadata size
+func MetadataPieceCount(size int) int {
+	return (size + MetadataPieceSize - 1) / MetadataPieceSize
+}
@@ -0,0 +1,413 @@
+package peerwire
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rc4"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+)
+
+// EncryptionPolicy controls whether peer connections use Message Stream Encryption
+type EncryptionPolicy int
+
+const (
+	// EncryptionPrefer tries MSE first and falls back to plaintext
+	EncryptionPrefer EncryptionPolicy = iota
+	// EncryptionRequire only accepts RC4 encrypted connections
+	EncryptionRequire
+	// EncryptionDisable only speaks plaintext BitTorrent
+	EncryptionDisable
+)
+
+// DefaultEncryptionPolicy is the policy used by DefaultConfig
+const DefaultEncryptionPolicy = EncryptionPrefer
+
+var encryptionPolicyNames = map[string]EncryptionPolicy{
+	"prefer":  EncryptionPrefer,
+	"require": EncryptionRequire,
+	"disable": EncryptionDisable,
+}
+
+// ParseEncryptionPolicy converts a policy name into an EncryptionPolicy
+func ParseEncryptionPolicy(name string) (EncryptionPolicy, error) {
+	policy, ok := encryptionPolicyNames[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown encryption policy %q", name)
+	}
+	return policy, nil
+}
+
+func (p EncryptionPolicy) String() string {
+	switch p {
+	case EncryptionPrefer:
+		return "prefer"
+	case EncryptionRequire:
+		return "require"
+	case EncryptionDisable:
+		return "disable"
+	}
+	return fmt.Sprintf("encryption(%d)", int(p))
+}
+
+// Set implements flag.Value
+func (p *EncryptionPolicy) Set(name string) error {
+	policy, err := ParseEncryptionPolicy(name)
+	if err != nil {
+		return err
+	}
+	*p = policy
+	return nil
+}
+
+// Methods offered in crypto_provide and chosen in crypto_select
+const (
+	cryptoPlaintext = 0x01
+	cryptoRC4       = 0x02
+)
+
+const (
+	mseKeyLength  = 96   // Length of the public keys and the shared secret
+	mseMaxPadding = 512  // Upper bound on every padding field
+	mseRC4Discard = 1024 // Keystream bytes thrown away before use
+)
+
+var (
+	msePrime, _  = new(big.Int).SetString("FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74020BBEA63B139B22514A08798E3404DDEF9519B3CD3A431B302B0A6DF25F14374FE1356D6D51C245E485B576625E7EC6F44C42E9A63A36210000000000090563", 16)
+	mseGenerator = big.NewInt(2)
+	mseVC        = make([]byte, 8) // Verification constant
+)
+
+// mseKeyPair generates a private key and the matching public key
+func mseKeyPair() (*big.Int, []byte, error) {
+	secret := make([]byte, 20) // 160 bits, as recommended
+	if _, err := rand.Read(secret); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	private := new(big.Int).SetBytes(secret)
+	public := new(big.Int).Exp(mseGenerator, private, msePrime)
+	return private, public.FillBytes(make([]byte, mseKeyLength)), nil
+}
+
+// mseSharedSecret computes S from the peer's public key
+func mseSharedSecret(remotePublic []byte, private *big.Int) []byte {
+	secret := new(big.Int).Exp(new(big.Int).SetBytes(remotePublic), private, msePrime)
+	return secret.FillBytes(make([]byte, mseKeyLength))
+}
+
+func mseHash(parts ...[]byte) []byte {
+	hash := sha1.New()
+	for _, part := range parts {
+		hash.Write(part)
+	}
+	return hash.Sum(nil)
+}
+
+// mseCipher creates the RC4 stream for one direction, keyed by "keyA" or "keyB"
+func mseCipher(name string, secret, infoHash []byte) *rc4.Cipher {
+	cipher, _ := rc4.NewCipher(mseHash([]byte(name), secret, infoHash))
+	discard := make([]byte, mseRC4Discard)
+	cipher.XORKeyStream(discard, discard)
+	return cipher
+}
+
+func msePadding() ([]byte, error) {
+	var n [2]byte
+	if _, err := rand.Read(n[:]); err != nil {
+		return nil, err
+	}
+
+	padding := make([]byte, int(binary.BigEndian.Uint16(n[:]))%(mseMaxPadding+1))
+	if _, err := rand.Read(padding); err != nil {
+		return nil, err
+	}
+	return padding, nil
+}
+
+func xorBytes(a, b []byte) []byte {
+	result := make([]byte, len(a))
+	for i := range a {
+		result[i] = a[i] ^ b[i]
+	}
+	return result
+}
+
+// synchronize consumes bytes until pattern has been read, giving up after limit bytes
+func synchronize(reader *bufio.Reader, pattern []byte, limit int) error {
+	window := make([]byte, 0, limit)
+	for len(window) < limit {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return err
+		}
+		window = append(window, b)
+		if bytes.HasSuffix(window, pattern) {
+			return nil
+		}
+	}
+	return fmt.Errorf("encryption handshake out of sync")
+}
+
+// readEncrypted reads n bytes from the handshake and decrypts them
+func readEncrypted(reader io.Reader, cipher *rc4.Cipher, n int) ([]byte, error) {
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(reader, buf); err != nil {
+		return nil, err
+	}
+	cipher.XORKeyStream(buf, buf)
+	return buf, nil
+}
+
+// encryptConn performs the outgoing MSE handshake for infoHash and returns a
+// connection carrying the payload stream with the negotiated method
+func encryptConn(conn net.Conn, infoHash []byte, policy EncryptionPolicy) (net.Conn, error) {
+	private, public, err := mseKeyPair()
+	if err != nil {
+		return nil, err
+	}
+	padA, err := msePadding()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write(append(public, padA...)); err != nil {
+		return nil, fmt.Errorf("failed to send public key: %w", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	remotePublic := make([]byte, mseKeyLength)
+	if _, err := io.ReadFull(reader, remotePublic); err != nil {
+		return nil, fmt.Errorf("failed to read public key: %w", err)
+	}
+	secret := mseSharedSecret(remotePublic, private)
+
+	encrypt := mseCipher("keyA", secret, infoHash)
+	decrypt := mseCipher("keyB", secret, infoHash)
+
+	provide := uint32(cryptoRC4)
+	if policy == EncryptionPrefer {
+		provide |= cryptoPlaintext
+	}
+
+	// VC, crypto_provide, len(PadC) and len(IA), both left empty
+	header := make([]byte, 8+4+2+2)
+	copy(header, mseVC)
+	binary.BigEndian.PutUint32(header[8:12], provide)
+	encrypt.XORKeyStream(header, header)
+
+	var message bytes.Buffer
+	message.Write(mseHash([]byte("req1"), secret))
+	message.Write(xorBytes(mseHash([]byte("req2"), infoHash), mseHash([]byte("req3"), secret)))
+	message.Write(header)
+	if _, err := conn.Write(message.Bytes()); err != nil {
+		return nil, fmt.Errorf("failed to send encryption request: %w", err)
+	}
+
+	// The peer's encrypted VC marks the end of its padding
+	encryptedVC := make([]byte, len(mseVC))
+	mseCipher("keyB", secret, infoHash).XORKeyStream(encryptedVC, mseVC)
+	if err := synchronize(reader, encryptedVC, mseMaxPadding+len(mseVC)); err != nil {
+		return nil, fmt.Errorf("failed to find encryption response: %w", err)
+	}
+	decrypt.XORKeyStream(make([]byte, len(mseVC)), mseVC)
+
+	response, err := readEncrypted(reader, decrypt, 4+2)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read encryption response: %w", err)
+	}
+	selected := binary.BigEndian.Uint32(response[0:4])
+	padLength := int(binary.BigEndian.Uint16(response[4:6]))
+	if padLength > mseMaxPadding {
+		return nil, fmt.Errorf("encryption padding too long: %d", padLength)
+	}
+	if _, err := readEncrypted(reader, decrypt, padLength); err != nil {
+		return nil, fmt.Errorf("failed to read encryption padding: %w", err)
+	}
+
+	switch {
+	case selected == cryptoRC4:
+		return &encryptedConn{Conn: conn, reader: reader, encrypt: encrypt, decrypt: decrypt}, nil
+	case selected == cryptoPlaintext && policy != EncryptionRequire:
+		return &bufferedConn{Conn: conn, reader: reader}, nil
+	}
+	return nil, fmt.Errorf("peer selected unsupported encryption method %d", selected)
+}
+
+// acceptEncryptedConn performs the incoming MSE handshake. The torrent is
+// identified by matching SKEY against the info hashes we serve, and the info
+// hash is returned with the connection
+func acceptEncryptedConn(conn net.Conn, infoHashes [][]byte, policy EncryptionPolicy) (net.Conn, []byte, error) {
+	if policy == EncryptionDisable {
+		return nil, nil, fmt.Errorf("encryption is disabled")
+	}
+
+	reader := bufio.NewReader(conn)
+	remotePublic := make([]byte, mseKeyLength)
+	if _, err := io.ReadFull(reader, remotePublic); err != nil {
+		return nil, nil, fmt.Errorf("failed to read public key: %w", err)
+	}
+
+	private, public, err := mseKeyPair()
+	if err != nil {
+		return nil, nil, err
+	}
+	padB, err := msePadding()
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := conn.Write(append(public, padB...)); err != nil {
+		return nil, nil, fmt.Errorf("failed to send public key: %w", err)
+	}
+	secret := mseSharedSecret(remotePublic, private)
+
+	if err := synchronize(reader, mseHash([]byte("req1"), secret), mseMaxPadding+sha1.Size); err != nil {
+		return nil, nil, fmt.Errorf("failed to find encryption request: %w", err)
+	}
+
+	obfuscated := make([]byte, sha1.Size)
+	if _, err := io.ReadFull(reader, obfuscated); err != nil {
+		return nil, nil, fmt.Errorf("failed to read info hash: %w", err)
+	}
+	skeyHash := xorBytes(obfuscated, mseHash([]byte("req3"), secret))
+
+	var infoHash []byte
+	for _, candidate := range infoHashes {
+		if bytes.Equal(mseHash([]byte("req2"), candidate), skeyHash) {
+			infoHash = candidate
+			break
+		}
+	}
+	if infoHash == nil {
+		return nil, nil, fmt.Errorf("peer requested an unknown torrent")
+	}
+
+	decrypt := mseCipher("keyA", secret, infoHash)
+	encrypt := mseCipher("keyB", secret, infoHash)
+
+	request, err := readEncrypted(reader, decrypt, 8+4+2)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read encryption request: %w", err)
+	}
+	if !bytes.Equal(request[:8], mseVC) {
+		return nil, nil, fmt.Errorf("invalid verification constant")
+	}
+	provide := binary.BigEndian.Uint32(request[8:12])
+	padLength := int(binary.BigEndian.Uint16(request[12:14]))
+	if padLength > mseMaxPadding {
+		return nil, nil, fmt.Errorf("encryption padding too long: %d", padLength)
+	}
+
+	// PadC is followed by the initial payload, which may already hold the BitTorrent handshake
+	padding, err := readEncrypted(reader, decrypt, padLength+2)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read encryption padding: %w", err)
+	}
+	initialPayload, err := readEncrypted(reader, decrypt, int(binary.BigEndian.Uint16(padding[padLength:])))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read initial payload: %w", err)
+	}
+
+	var selected uint32
+	switch {
+	case provide&cryptoRC4 != 0:
+		selected = cryptoRC4
+	case provide&cryptoPlaintext != 0 && policy == EncryptionPrefer:
+		selected = cryptoPlaintext
+	default:
+		return nil, nil, fmt.Errorf("no acceptable encryption method offered: %d", provide)
+	}
+
+	// VC, crypto_select and an empty PadD
+	response := make([]byte, 8+4+2)
+	copy(response, mseVC)
+	binary.BigEndian.PutUint32(response[8:12], selected)
+	encrypt.XORKeyStream(response, response)
+	if _, err := conn.Write(response); err != nil {
+		return nil, nil, fmt.Errorf("failed to send encryption response: %w", err)
+	}
+
+	if selected == cryptoPlaintext {
+		return &bufferedConn{Conn: conn, reader: io.MultiReader(bytes.NewReader(initialPayload), reader)}, infoHash, nil
+	}
+	return &encryptedConn{Conn: conn, reader: reader, pending: initialPayload, encrypt: encrypt, decrypt: decrypt}, infoHash, nil
+}
+
+// dialPeer connects to a peer, negotiating encryption according to the policy
+func dialPeer(ctx context.Context, peerAddr string, infoHash []byte, config Config) (net.Conn, error) {
+	conn, err := dialTransport(ctx, peerAddr, config.Timeouts.Connect)
+	if err != nil {
+		return nil, err
+	}
+	if config.Encryption == EncryptionDisable {
+		return conn, nil
+	}
+
+	release := guardConn(ctx, conn, config.Timeouts.Handshake)
+	encrypted, err := encryptConn(conn, infoHash, config.Encryption)
+	release()
+	if err == nil {
+		return encrypted, nil
+	}
+	conn.Close()
+	if config.Encryption == EncryptionRequire {
+		return nil, fmt.Errorf("failed to negotiate encryption: %w", err)
+	}
+	config.logger(peerAddr, infoHash).Debug("encryption refused, reconnecting in plaintext", "err", err)
+
+	// Peers without MSE drop the connection on seeing our key, so start over in plaintext
+	conn, err = dialTransport(ctx, peerAddr, config.Timeouts.Connect)
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// bufferedConn is a plaintext connection with bytes left over from the handshake
+type bufferedConn struct {
+	net.Conn
+	reader io.Reader
+}
+
+func (c *bufferedConn) Read(buf []byte) (int, error) {
+	return c.reader.Read(buf)
+}
+
+// encryptedConn carries the payload stream encrypted with RC4
+type encryptedConn struct {
+	net.Conn
+	reader  io.Reader
+	pending []byte // Decrypted initial payload not read yet
+	decrypt *rc4.Cipher
+
+	writeMu sync.Mutex
+	encrypt *rc4.Cipher
+}
+
+func (c *encryptedConn) Read(buf []byte) (int, error) {
+	if len(c.pending) > 0 {
+		n := copy(buf, c.pending)
+		c.pending = c.pending[n:]
+		return n, nil
+	}
+
+	n, err := c.reader.Read(buf)
+	c.decrypt.XORKeyStream(buf[:n], buf[:n])
+	return n, err
+}
+
+func (c *encryptedConn) Write(buf []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	encrypted := make([]byte, len(buf))
+	c.encrypt.XORKeyStream(encrypted, buf)
+	return c.Conn.Write(encrypted)
+}
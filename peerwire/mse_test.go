@@ -0,0 +1,358 @@
+package peerwire
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+var (
+	testInfoHash  = bytes.Repeat([]byte{0xab}, sha1.Size)
+	otherInfoHash = bytes.Repeat([]byte{0xcd}, sha1.Size)
+)
+
+// pipe returns both ends of an in-memory connection that fail instead of
+// hanging when a handshake gets stuck
+func pipe(t *testing.T) (net.Conn, net.Conn) {
+	t.Helper()
+	a, b := net.Pipe()
+	deadline := time.Now().Add(5 * time.Second)
+	a.SetDeadline(deadline)
+	b.SetDeadline(deadline)
+	t.Cleanup(func() {
+		a.Close()
+		b.Close()
+	})
+	return a, b
+}
+
+type acceptResult struct {
+	conn     net.Conn
+	infoHash []byte
+	err      error
+}
+
+func acceptAsync(conn net.Conn, infoHashes [][]byte, policy EncryptionPolicy) <-chan acceptResult {
+	results := make(chan acceptResult, 1)
+	go func() {
+		conn, infoHash, err := acceptEncryptedConn(conn, infoHashes, policy)
+		results <- acceptResult{conn, infoHash, err}
+	}()
+	return results
+}
+
+// exchange checks that data written on either end arrives intact on the other
+func exchange(t *testing.T, a, b net.Conn) {
+	t.Helper()
+	for _, direction := range []struct {
+		from, to net.Conn
+		message  string
+	}{
+		{a, b, "ping from the dialing side"},
+		{b, a, "pong from the accepting side"},
+	} {
+		go direction.from.Write([]byte(direction.message))
+		buf := make([]byte, len(direction.message))
+		if _, err := io.ReadFull(direction.to, buf); err != nil {
+			t.Fatalf("failed to read %q: %v", direction.message, err)
+		}
+		if string(buf) != direction.message {
+			t.Fatalf("read %q, want %q", buf, direction.message)
+		}
+	}
+}
+
+func TestMSEHandshakeSelectsRC4(t *testing.T) {
+	policies := []EncryptionPolicy{EncryptionPrefer, EncryptionRequire}
+	for _, dialPolicy := range policies {
+		for _, acceptPolicy := range policies {
+			t.Run(dialPolicy.String()+"/"+acceptPolicy.String(), func(t *testing.T) {
+				dialing, accepting := pipe(t)
+				accepted := acceptAsync(accepting, [][]byte{otherInfoHash, testInfoHash}, acceptPolicy)
+
+				dialed, err := encryptConn(dialing, testInfoHash, dialPolicy)
+				if err != nil {
+					t.Fatalf("encryptConn failed: %v", err)
+				}
+				result := <-accepted
+				if result.err != nil {
+					t.Fatalf("acceptEncryptedConn failed: %v", result.err)
+				}
+
+				if !bytes.Equal(result.infoHash, testInfoHash) {
+					t.Errorf("accepted info hash %x, want %x", result.infoHash, testInfoHash)
+				}
+				if _, ok := dialed.(*encryptedConn); !ok {
+					t.Errorf("dialing side is %T, want RC4", dialed)
+				}
+				if _, ok := result.conn.(*encryptedConn); !ok {
+					t.Errorf("accepting side is %T, want RC4", result.conn)
+				}
+				exchange(t, dialed, result.conn)
+			})
+		}
+	}
+}
+
+func TestMSEAcceptSelectsPlaintext(t *testing.T) {
+	dialing, accepting := pipe(t)
+	accepted := acceptAsync(accepting, [][]byte{testInfoHash}, EncryptionPrefer)
+
+	selected, err := initiateMSE(dialing, testInfoHash, cryptoPlaintext, []byte("initial "))
+	if err != nil {
+		t.Fatalf("handshake failed: %v", err)
+	}
+	if selected != cryptoPlaintext {
+		t.Fatalf("selected method %d, want plaintext", selected)
+	}
+	result := <-accepted
+	if result.err != nil {
+		t.Fatalf("acceptEncryptedConn failed: %v", result.err)
+	}
+	if _, ok := result.conn.(*bufferedConn); !ok {
+		t.Fatalf("accepting side is %T, want plaintext", result.conn)
+	}
+
+	// The initial payload is read before what follows the handshake in the clear
+	go dialing.Write([]byte("payload"))
+	buf := make([]byte, len("initial payload"))
+	if _, err := io.ReadFull(result.conn, buf); err != nil {
+		t.Fatalf("failed to read payload: %v", err)
+	}
+	if string(buf) != "initial payload" {
+		t.Errorf("read %q, want %q", buf, "initial payload")
+	}
+}
+
+func TestMSEAcceptRefusesPlaintextWhenRequired(t *testing.T) {
+	dialing, accepting := pipe(t)
+	accepted := acceptAsync(accepting, [][]byte{testInfoHash}, EncryptionRequire)
+
+	go initiateMSE(dialing, testInfoHash, cryptoPlaintext, nil)
+	if result := <-accepted; result.err == nil {
+		t.Fatalf("plaintext was accepted with encryption required")
+	}
+}
+
+func TestMSEAcceptRefusesUnknownTorrent(t *testing.T) {
+	dialing, accepting := pipe(t)
+	accepted := acceptAsync(accepting, [][]byte{otherInfoHash}, EncryptionPrefer)
+
+	go encryptConn(dialing, testInfoHash, EncryptionPrefer)
+	if result := <-accepted; result.err == nil {
+		t.Fatalf("handshake for an unknown torrent was accepted")
+	}
+}
+
+func TestMSEDialPlaintextSelection(t *testing.T) {
+	tests := []struct {
+		policy      EncryptionPolicy
+		wantProvide uint32
+		wantErr     bool
+	}{
+		{EncryptionPrefer, cryptoRC4 | cryptoPlaintext, false},
+		{EncryptionRequire, cryptoRC4, true},
+	}
+	for _, test := range tests {
+		t.Run(test.policy.String(), func(t *testing.T) {
+			dialing, accepting := pipe(t)
+			provided := make(chan uint32, 1)
+			go func() {
+				provide, _ := respondMSE(accepting, testInfoHash, cryptoPlaintext)
+				provided <- provide
+			}()
+
+			dialed, err := encryptConn(dialing, testInfoHash, test.policy)
+			if provide := <-provided; provide != test.wantProvide {
+				t.Errorf("offered methods %d, want %d", provide, test.wantProvide)
+			}
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("plaintext selection was accepted with encryption required")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("encryptConn failed: %v", err)
+			}
+			if _, ok := dialed.(*bufferedConn); !ok {
+				t.Fatalf("dialing side is %T, want plaintext", dialed)
+			}
+			exchange(t, dialed, accepting)
+		})
+	}
+}
+
+func TestDialPeerFallsBackToPlaintext(t *testing.T) {
+	tests := []struct {
+		policy          EncryptionPolicy
+		wantErr         bool
+		wantConnections int
+	}{
+		{EncryptionPrefer, false, 2},
+		{EncryptionRequire, true, 1},
+		{EncryptionDisable, false, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.policy.String(), func(t *testing.T) {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("failed to listen: %v", err)
+			}
+			defer listener.Close()
+
+			// A peer without MSE hangs up on anything but the protocol string
+			connections := make(chan int, 2)
+			plaintext := make(chan bool, 1)
+			go func() {
+				for n := 1; ; n++ {
+					conn, err := listener.Accept()
+					if err != nil {
+						return
+					}
+					connections <- n
+					start := make([]byte, 1+ProtocolLength)
+					_, err = io.ReadFull(conn, start)
+					if err == nil && start[0] == ProtocolLength && string(start[1:]) == ProtocolString {
+						plaintext <- true
+					}
+					conn.Close()
+				}
+			}()
+
+			config := DefaultConfig()
+			config.Encryption = test.policy
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			conn, err := dialPeer(ctx, listener.Addr().String(), testInfoHash, config)
+			if test.wantErr {
+				if err == nil {
+					conn.Close()
+					t.Fatalf("dialPeer fell back to plaintext with encryption required")
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("dialPeer failed: %v", err)
+				}
+				defer conn.Close()
+				if _, err := conn.Write([]byte{ProtocolLength}); err != nil {
+					t.Fatalf("failed to write: %v", err)
+				}
+				if _, err := conn.Write([]byte(ProtocolString)); err != nil {
+					t.Fatalf("failed to write: %v", err)
+				}
+				select {
+				case <-plaintext:
+				case <-ctx.Done():
+					t.Fatalf("peer never received a plaintext handshake")
+				}
+			}
+
+			listener.Close()
+			if n := len(connections); n != test.wantConnections {
+				t.Errorf("peer saw %d connections, want %d", n, test.wantConnections)
+			}
+		})
+	}
+}
+
+// initiateMSE is an independent initiating side offering provide, used to
+// reach the selections encryptConn never asks for. It returns the selected method
+func initiateMSE(conn net.Conn, infoHash []byte, provide uint32, initialPayload []byte) (uint32, error) {
+	private, public, err := mseKeyPair()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := conn.Write(public); err != nil {
+		return 0, err
+	}
+	reader := bufio.NewReader(conn)
+	remotePublic := make([]byte, mseKeyLength)
+	if _, err := io.ReadFull(reader, remotePublic); err != nil {
+		return 0, err
+	}
+	secret := mseSharedSecret(remotePublic, private)
+	encrypt := mseCipher("keyA", secret, infoHash)
+	decrypt := mseCipher("keyB", secret, infoHash)
+
+	// VC, crypto_provide, an empty PadC and the initial payload
+	body := make([]byte, 8+4+2+2, 8+4+2+2+len(initialPayload))
+	binary.BigEndian.PutUint32(body[8:12], provide)
+	binary.BigEndian.PutUint16(body[14:16], uint16(len(initialPayload)))
+	body = append(body, initialPayload...)
+	encrypt.XORKeyStream(body, body)
+
+	request := append(mseHash([]byte("req1"), secret), xorBytes(mseHash([]byte("req2"), infoHash), mseHash([]byte("req3"), secret))...)
+	if _, err := conn.Write(append(request, body...)); err != nil {
+		return 0, err
+	}
+
+	encryptedVC := make([]byte, len(mseVC))
+	mseCipher("keyB", secret, infoHash).XORKeyStream(encryptedVC, mseVC)
+	if err := synchronize(reader, encryptedVC, mseMaxPadding+len(mseVC)); err != nil {
+		return 0, err
+	}
+	decrypt.XORKeyStream(make([]byte, len(mseVC)), mseVC)
+	response, err := readEncrypted(reader, decrypt, 4+2)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := readEncrypted(reader, decrypt, int(binary.BigEndian.Uint16(response[4:6]))); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(response[0:4]), nil
+}
+
+// respondMSE is an independent receiving side that selects the given method
+// whatever was offered. It returns the offered methods
+func respondMSE(conn net.Conn, infoHash []byte, selected uint32) (uint32, error) {
+	reader := bufio.NewReader(conn)
+	remotePublic := make([]byte, mseKeyLength)
+	if _, err := io.ReadFull(reader, remotePublic); err != nil {
+		return 0, err
+	}
+	private, public, err := mseKeyPair()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := conn.Write(public); err != nil {
+		return 0, err
+	}
+	secret := mseSharedSecret(remotePublic, private)
+
+	if err := synchronize(reader, mseHash([]byte("req1"), secret), mseMaxPadding+sha1.Size); err != nil {
+		return 0, err
+	}
+	if _, err := io.ReadFull(reader, make([]byte, sha1.Size)); err != nil {
+		return 0, err
+	}
+	decrypt := mseCipher("keyA", secret, infoHash)
+	encrypt := mseCipher("keyB", secret, infoHash)
+
+	request, err := readEncrypted(reader, decrypt, 8+4+2)
+	if err != nil {
+		return 0, err
+	}
+	provide := binary.BigEndian.Uint32(request[8:12])
+	padding, err := readEncrypted(reader, decrypt, int(binary.BigEndian.Uint16(request[12:14]))+2)
+	if err != nil {
+		return provide, err
+	}
+	if _, err := readEncrypted(reader, decrypt, int(binary.BigEndian.Uint16(padding[len(padding)-2:]))); err != nil {
+		return provide, err
+	}
+
+	response := make([]byte, 8+4+2)
+	copy(response, mseVC)
+	binary.BigEndian.PutUint32(response[8:12], selected)
+	encrypt.XORKeyStream(response, response)
+	_, err = conn.Write(response)
+	return provide, err
+}
@@ -0,0 +1,234 @@
+package peerwire
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultPeerIDPrefix identifies FlowStream 0.1.0.0 in Azureus-style peer IDs
+const DefaultPeerIDPrefix = "-FS0100-"
+
+// peerIDAlphabet is used for the random part of our peer IDs so they stay printable
+const peerIDAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// azureusClients maps the two character codes of Azureus-style peer IDs to client names
+var azureusClients = map[string]string{
+	"AG": "Ares",
+	"AZ": "Vuze",
+	"BC": "BitComet",
+	"BI": "BiglyBT",
+	"BT": "BitTorrent",
+	"BW": "BitWombat",
+	"CD": "Enhanced CTorrent",
+	"CT": "CTorrent",
+	"DE": "Deluge",
+	"FD": "Free Download Manager",
+	"FS": "FlowStream",
+	"FW": "FrostWire",
+	"HL": "Halite",
+	"KG": "KGet",
+	"KT": "KTorrent",
+	"LT": "libTorrent",
+	"lt": "libtorrent",
+	"LW": "LimeWire",
+	"MO": "MonoTorrent",
+	"PI": "PicoTorrent",
+	"qB": "qBittorrent",
+	"QD": "QQDownload",
+	"SD": "Thunder",
+	"SP": "BitSpirit",
+	"SZ": "Shareaza",
+	"TL": "Tribler",
+	"TR": "Transmission",
+	"TT": "TuoTu",
+	"UM": "µTorrent Mac",
+	"UT": "µTorrent",
+	"UW": "µTorrent Web",
+	"WD": "WebTorrent Desktop",
+	"WW": "WebTorrent",
+	"XL": "Xunlei",
+}
+
+// shadowClients maps the first character of Shadow-style peer IDs to client names
+var shadowClients = map[byte]string{
+	'A': "ABC",
+	'O': "Osprey Permaseed",
+	'Q': "BTQueue",
+	'R': "Tribler",
+	'S': "Shadow",
+	'T': "BitTornado",
+	'U': "UPnP NAT Bit Torrent",
+}
+
+// shadowVersionDigits encodes the version numbers of Shadow-style peer IDs
+const shadowVersionDigits = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz.-"
+
+// ClientInfo is the client software a peer ID identifies
+type ClientInfo struct {
+	Name    string
+	Version string
+}
+
+func (c ClientInfo) String() string {
+	if c.Version == "" {
+		return c.Name
+	}
+	return c.Name + " " + c.Version
+}
+
+// GeneratePeerID creates a peer ID starting with the given client prefix
+func GeneratePeerID(prefix string) ([]byte, error) {
+	if len(prefix) > PeerIDLength {
+		return nil, fmt.Errorf("peer ID prefix %q is longer than %d bytes", prefix, PeerIDLength)
+	}
+
+	id := make([]byte, PeerIDLength)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate peer ID: %w", err)
+	}
+
+	for i := range id {
+		id[i] = peerIDAlphabet[int(id[i])%len(peerIDAlphabet)]
+	}
+	copy(id, prefix)
+	return id, nil
+}
+
+// ParseClient identifies the client behind a peer ID from its Azureus-style
+// (-qB4250-), Shadow-style (T03I--) or Mainline (M4-3-6--) prefix
+func ParseClient(peerID []byte) ClientInfo {
+	if len(peerID) != PeerIDLength {
+		return ClientInfo{Name: "Unknown"}
+	}
+
+	if client, ok := parseAzureusClient(peerID); ok {
+		return client
+	}
+	if client, ok := parseMainlineClient(peerID); ok {
+		return client
+	}
+	if client, ok := parseShadowClient(peerID); ok {
+		return client
+	}
+	return ClientInfo{Name: "Unknown"}
+}
+
+// parseAzureusClient decodes -XXVVVV- where XX names the client and VVVV is its version
+func parseAzureusClient(peerID []byte) (ClientInfo, bool) {
+	if peerID[0] != '-' || peerID[7] != '-' {
+		return ClientInfo{}, false
+	}
+
+	code := string(peerID[1:3])
+	version := string(peerID[3:7])
+	for _, c := range []byte(version) {
+		if !isAlphanumeric(c) {
+			return ClientInfo{}, false
+		}
+	}
+
+	name, ok := azureusClients[code]
+	if !ok {
+		name = "Unknown (" + code + ")"
+	}
+
+	// Transmission writes the minor version as two digits, 2.94 is -TR2940-
+	if code == "TR" && isDigits(version) {
+		minor, _ := strconv.Atoi(version[1:3])
+		return ClientInfo{Name: name, Version: fmt.Sprintf("%c.%02d", version[0], minor)}, true
+	}
+	return ClientInfo{Name: name, Version: azureusVersion(version)}, true
+}
+
+// azureusVersion turns version characters into dotted numbers, keeping a
+// trailing letter as a build tag and dropping trailing zero components
+func azureusVersion(version string) string {
+	var tag string
+	if last := version[len(version)-1]; !isDigit(last) {
+		tag = string(last)
+		version = version[:len(version)-1]
+	}
+
+	parts := make([]string, 0, len(version))
+	for _, c := range []byte(version) {
+		parts = append(parts, strconv.Itoa(alphanumericValue(c)))
+	}
+	for len(parts) > 2 && parts[len(parts)-1] == "0" {
+		parts = parts[:len(parts)-1]
+	}
+	return strings.Join(parts, ".") + tag
+}
+
+// parseMainlineClient decodes the original BitTorrent client's M4-3-6-- form
+func parseMainlineClient(peerID []byte) (ClientInfo, bool) {
+	if peerID[0] != 'M' || !isDigit(peerID[1]) || peerID[7] != '-' {
+		return ClientInfo{}, false
+	}
+
+	// The version fills the first eight bytes, padded with dashes
+	parts := strings.Split(strings.TrimRight(string(peerID[1:8]), "-"), "-")
+	for _, part := range parts {
+		if !isDigits(part) {
+			return ClientInfo{}, false
+		}
+	}
+	return ClientInfo{Name: "Mainline", Version: strings.Join(parts, ".")}, true
+}
+
+// parseShadowClient decodes a client letter followed by up to five version
+// characters and at least two dashes, such as S58B-----
+func parseShadowClient(peerID []byte) (ClientInfo, bool) {
+	name, ok := shadowClients[peerID[0]]
+	if !ok {
+		return ClientInfo{}, false
+	}
+
+	end := strings.Index(string(peerID[1:8]), "--")
+	if end < 1 || end > 5 {
+		return ClientInfo{}, false
+	}
+
+	parts := make([]string, 0, end)
+	for _, c := range peerID[1 : 1+end] {
+		value := strings.IndexByte(shadowVersionDigits, c)
+		if value < 0 || c == '-' {
+			return ClientInfo{}, false
+		}
+		parts = append(parts, strconv.Itoa(value))
+	}
+	return ClientInfo{Name: name, Version: strings.Join(parts, ".")}, true
+}
+
+// alphanumericValue reads 0-9 as themselves and letters as 10 upwards
+func alphanumericValue(c byte) int {
+	switch {
+	case isDigit(c):
+		return int(c - '0')
+	case c >= 'A' && c <= 'Z':
+		return int(c-'A') + 10
+	default:
+		return int(c-'a') + 10
+	}
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range []byte(s) {
+		if !isDigit(c) {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlphanumeric(c byte) bool {
+	return isDigit(c) || (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z')
+}
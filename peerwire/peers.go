@@ -0,0 +1,729 @@
+// Package peerwire connects to peers and speaks the BitTorrent peer wire
+// protocol with its extensions, over TCP or uTP and optionally encrypted
+package peerwire
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// Message IDs for the BitTorrent protocol
+const (
+	IDChoke         = uint8(0)
+	IDUnchoke       = uint8(1)
+	IDInterested    = uint8(2)
+	IDNotInterested = uint8(3)
+	IDHave          = uint8(4)
+	IDBitfield      = uint8(5)
+	IDRequest       = uint8(6)
+	IDPiece         = uint8(7)
+	IDCancel        = uint8(8)
+)
+
+// Protocol constants
+const (
+	DefaultPort      = 6881
+	BlockSize        = 16384   // Standard BitTorrent block size (16KB)
+	MaxMessageLength = 1 << 21 // Largest message accepted from a peer, enough for huge bitfields
+)
+
+// Timeouts bounds each stage of talking to peers and trackers, zero disables a limit
+type Timeouts struct {
+	Connect   time.Duration // Establishing the TCP or uTP connection
+	Handshake time.Duration // Encryption, BitTorrent and extension handshakes
+	Request   time.Duration // Answer to a metadata or tracker request
+	Snub      time.Duration // Waiting for a requested block before the peer counts as snubbing us
+	Idle      time.Duration // Silence from a peer, and waiting to be unchoked
+}
+
+// DefaultTimeouts are used unless a Config overrides them
+var DefaultTimeouts = Timeouts{
+	Connect:   10 * time.Second,
+	Handshake: 15 * time.Second,
+	Request:   60 * time.Second,
+	Snub:      60 * time.Second,
+	Idle:      3 * time.Minute,
+}
+
+// Config holds the settings used when connecting to peers
+type Config struct {
+	Encryption EncryptionPolicy
+	Timeouts   Timeouts
+	PeerID     []byte       // Sent in every handshake, see GeneratePeerID
+	Limiter    *RateLimiter // Shared download rate limit, nil for none
+	Logger     *slog.Logger // Receives debug records about connections, nil for slog.Default
+	ListenPort int          // Advertised in extension handshakes, 0 when not accepting connections
+}
+
+// DefaultConfig returns the settings used for downloads by default, the peer
+// ID has to be set before connecting
+func DefaultConfig() Config {
+	return Config{
+		Encryption: DefaultEncryptionPolicy,
+		Timeouts:   DefaultTimeouts,
+	}
+}
+
+// peerID returns the peer ID to send in handshakes
+func (c Config) peerID() ([]byte, error) {
+	if len(c.PeerID) != PeerIDLength {
+		return nil, fmt.Errorf("peer config has no valid peer id")
+	}
+	return c.PeerID, nil
+}
+
+// logger returns the peer subsystem logger with the peer and torrent attached
+func (c Config) logger(peerAddr string, infoHash []byte) *slog.Logger {
+	logger := c.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return logger.With("subsystem", "peer", "peer", peerAddr, "torrent", hex.EncodeToString(infoHash))
+}
+
+// PeerConnection is a handshaked connection to a peer and what it told us
+type PeerConnection struct {
+	InfoHash           []byte
+	PeerID             string     // Hex encoded
+	Client             ClientInfo // Client software identified from the peer ID
+	Conn               net.Conn
+	Capabilities       Capabilities        // Extensions supported by both sides
+	RemoteExtensions   *ExtensionHandshake // The peer's extension handshake, nil until received
+	extensions         *ExtensionRegistry
+	remoteExtensionIDs map[string]uint8 // Extension name to the ID the peer expects in messages
+	peerChoking        atomic.Bool      // Read by stats while the connection is in use
+	pendingRequests    atomic.Int32     // Block requests waiting for their block
+	pieces             []byte           // Bitfield of the pieces the peer has
+	numPieces          int              // Pieces of the torrent, 0 while unknown
+	hasAll             bool
+	allowedFast        map[int]bool // Pieces we may request while choked
+	suggested          map[int]bool
+	snubbed            bool
+	reader             *messageReader
+	timeouts           Timeouts
+	listenPort         int
+	deadline           time.Time // Set while an operation must complete by a given time
+}
+
+func newPeerConnection(conn net.Conn, infoHash []byte, peerID []byte, config Config) *PeerConnection {
+	if config.Limiter != nil {
+		conn = &limitedConn{Conn: conn, limiter: config.Limiter}
+	}
+	conn = newMonitoredConn(conn, config.Timeouts.Idle)
+	peerConn := &PeerConnection{
+		InfoHash:           infoHash,
+		PeerID:             hex.EncodeToString(peerID),
+		Client:             ParseClient(peerID),
+		Conn:               conn,
+		extensions:         NewExtensionRegistry(),
+		remoteExtensionIDs: make(map[string]uint8),
+		allowedFast:        make(map[int]bool),
+		suggested:          make(map[int]bool),
+		reader:             &messageReader{conn: conn},
+		timeouts:           config.Timeouts,
+		listenPort:         config.ListenPort,
+	}
+	peerConn.peerChoking.Store(true)
+	return peerConn
+}
+
+type Message struct {
+	Length  uint32
+	ID      uint8
+	Payload []byte
+}
+
+// NewMagnetPeerConnection connects to a peer for a torrent we only know the
+// info hash of, completing the extension handshake so metadata can be requested
+func NewMagnetPeerConnection(ctx context.Context, peerAddr string, infoHash []byte, config Config) (*PeerConnection, error) {
+	logger := config.logger(peerAddr, infoHash)
+	conn, err := dialPeer(ctx, peerAddr, infoHash, config)
+	if err != nil {
+		return nil, err
+	}
+	release := guardConn(ctx, conn, config.Timeouts.Handshake)
+	defer release()
+
+	peerID, err := config.peerID()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	handshake := createMagnetHandshake(infoHash, peerID)
+
+	if err := sendHandshake(conn, handshake); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	responseHandshake, err := readHandshake(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := verifyHandshake(conn, responseHandshake, infoHash, peerID); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	capabilities := handshakeCapabilities(handshake).And(responseHandshake.Capabilities)
+	extensionSupport := capabilities.Extensions
+	logger.Debug("handshake complete",
+		"peer_id", hex.EncodeToString(responseHandshake.PeerID),
+		"reserved", hex.EncodeToString(responseHandshake.Reserved[:]),
+		"extensions", extensionSupport)
+
+	peerConn := newPeerConnection(conn, infoHash, responseHandshake.PeerID, config)
+	peerConn.Capabilities = capabilities
+	peerConn.RegisterExtension(NewMetadataExtension(nil))
+
+	if extensionSupport {
+		if err := peerConn.StartExtensions(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		if err := peerConn.awaitExtensionHandshake(); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to handle extension handshake: %w", err)
+		}
+		id, _ := peerConn.RemoteExtensionID(UTMetadataName)
+		logger.Debug("extension handshake complete", "ut_metadata", id)
+	}
+	return peerConn, nil
+}
+
+// NewPeerConnection connects and handshakes with a peer, advertising the
+// extension protocol and the Fast Extension
+func NewPeerConnection(ctx context.Context, peerAddr string, infoHash []byte, config Config) (*PeerConnection, error) {
+	conn, err := dialPeer(ctx, peerAddr, infoHash, config)
+	if err != nil {
+		return nil, err
+	}
+	release := guardConn(ctx, conn, config.Timeouts.Handshake)
+	defer release()
+
+	peerID, err := config.peerID()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	handshake := NewHandshakeBuilder().
+		WithInfoHash(infoHash).
+		WithPeerID(peerID).
+		WithExtensions().
+		WithFastExtension().
+		Build()
+
+	if err := sendHandshake(conn, handshake); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	responseHandshake, err := readHandshake(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := verifyHandshake(conn, responseHandshake, infoHash, peerID); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	peerConn := newPeerConnection(conn, infoHash, responseHandshake.PeerID, config)
+	peerConn.Capabilities = handshakeCapabilities(handshake).And(responseHandshake.Capabilities)
+	config.logger(peerAddr, infoHash).Debug("handshake complete",
+		"peer_id", peerConn.PeerID,
+		"client", peerConn.Client.String(),
+		"fast", peerConn.Capabilities.Fast,
+		"extensions", peerConn.Capabilities.Extensions)
+	return peerConn, nil
+}
+
+// RegisterExtension adds an extension to the connection and returns its local ID,
+// extensions must be registered before StartExtensions to be advertised
+func (p *PeerConnection) RegisterExtension(extension Extension) uint8 {
+	return p.extensions.Register(extension)
+}
+
+// Extension returns the registered extension with the given name, or nil
+func (p *PeerConnection) Extension(name string) Extension {
+	extension, _ := p.extensions.Get(name)
+	return extension
+}
+
+// StartExtensions sends our extension handshake advertising the registered extensions
+func (p *PeerConnection) StartExtensions() error {
+	if !p.Capabilities.Extensions {
+		return nil
+	}
+	return sendExtensionHandshake(p.Conn, p.extensions, p.listenPort)
+}
+
+// RemoteExtensionID returns the ID the peer assigned to an extension
+func (p *PeerConnection) RemoteExtensionID(name string) (uint8, bool) {
+	id, ok := p.remoteExtensionIDs[name]
+	return id, ok
+}
+
+// SupportsExtension reports whether the peer advertised an extension
+func (p *PeerConnection) SupportsExtension(name string) bool {
+	_, ok := p.RemoteExtensionID(name)
+	return ok
+}
+
+// SendExtensionMessage sends a payload to the peer's side of an extension
+func (p *PeerConnection) SendExtensionMessage(name string, payload []byte) error {
+	id, ok := p.RemoteExtensionID(name)
+	if !ok {
+		return fmt.Errorf("peer does not support extension %s", name)
+	}
+
+	message := NewExtensionMessageBuilder().
+		WithExtensionID(id).
+		WithPayload(payload).
+		Build()
+
+	if _, err := p.Conn.Write(message); err != nil {
+		return fmt.Errorf("failed to send %s message: %w", name, err)
+	}
+	return nil
+}
+
+// applyExtensionHandshake records the peer's handshake, later handshakes only
+// update the entries they mention and an ID of 0 disables an extension
+func (p *PeerConnection) applyExtensionHandshake(handshake *ExtensionHandshake) {
+	for name, id := range handshake.M {
+		if id <= 0 || id > 255 {
+			delete(p.remoteExtensionIDs, name)
+			continue
+		}
+		p.remoteExtensionIDs[name] = uint8(id)
+	}
+
+	if p.RemoteExtensions != nil && handshake.MetadataSize == 0 {
+		handshake.MetadataSize = p.RemoteExtensions.MetadataSize
+	}
+	p.RemoteExtensions = handshake
+}
+
+// awaitExtensionHandshake reads messages until the peer's extension handshake
+// arrives, recording the choking and piece availability of those sent before it
+func (p *PeerConnection) awaitExtensionHandshake() error {
+	// readMessage replaces the deadline set for the handshake
+	defer p.ExpectWithin(p.timeouts.Handshake)()
+
+	for p.RemoteExtensions == nil {
+		if _, _, _, err := p.readMessage(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadMessage reads the next message from the peer, handling keep-alives and
+// extension messages internally
+func (p *PeerConnection) ReadMessage() (uint8, []byte, error) {
+	for {
+		id, payload, handled, err := p.readMessage()
+		if err != nil {
+			return 0, nil, err
+		}
+		if !handled {
+			return id, payload, nil
+		}
+	}
+}
+
+// Timeouts returns the timeouts the connection was opened with
+func (p *PeerConnection) Timeouts() Timeouts {
+	return p.timeouts
+}
+
+// ExpectWithin bounds the following reads by a timeout until the returned
+// function is called. A read that times out can be retried, as partially read
+// messages are kept
+func (p *PeerConnection) ExpectWithin(timeout time.Duration) func() {
+	if timeout <= 0 {
+		return func() {}
+	}
+	p.deadline = time.Now().Add(timeout)
+	return func() {
+		p.deadline = time.Time{}
+	}
+}
+
+// readMessage reads a single message, handled is true when it was consumed internally
+func (p *PeerConnection) readMessage() (uint8, []byte, bool, error) {
+	p.Conn.SetReadDeadline(p.deadline)
+	id, payload, err := p.reader.ReadMessage()
+	if err != nil {
+		return 0, nil, false, err
+	}
+
+	// Keep-alives are the only messages without a payload slice
+	if id == 0 && payload == nil {
+		return 0, nil, true, nil
+	}
+
+	if id == ExtensionMessageID && len(payload) > 0 {
+		return id, payload, true, p.handleExtensionMessage(payload)
+	}
+
+	if err := p.updateState(id, payload); err != nil {
+		return 0, nil, false, err
+	}
+
+	// Fast peers expect an explicit answer to every request
+	if id == IDRequest && p.Capabilities.Fast {
+		return id, payload, true, p.rejectRequest(payload)
+	}
+
+	return id, payload, false, nil
+}
+
+// updateState records choking and piece availability announced by the peer
+func (p *PeerConnection) updateState(id uint8, payload []byte) error {
+	switch id {
+	case IDChoke:
+		p.peerChoking.Store(true)
+
+	case IDUnchoke:
+		p.peerChoking.Store(false)
+
+	case IDPiece:
+		p.snubbed = false
+
+	case IDHave:
+		if len(payload) < 4 {
+			return fmt.Errorf("have message too short")
+		}
+		index := int(binary.BigEndian.Uint32(payload))
+		if err := p.checkPieceIndex(index); err != nil {
+			return err
+		}
+		if index/8 >= len(p.pieces) {
+			p.pieces = append(p.pieces, make([]byte, index/8+1-len(p.pieces))...)
+		}
+		p.pieces[index/8] |= 0x80 >> (index % 8)
+
+	case IDBitfield:
+		if err := p.checkBitfield(payload); err != nil {
+			return err
+		}
+		p.pieces = append([]byte{}, payload...)
+
+	case IDSuggestPiece, IDHaveAll, IDHaveNone, IDRejectRequest, IDAllowedFast:
+		return p.handleFastMessage(id, payload)
+	}
+	return nil
+}
+
+// SetNumPieces sets the number of pieces of the torrent, after which messages
+// naming a piece beyond it are a protocol error
+func (p *PeerConnection) SetNumPieces(numPieces int) {
+	p.numPieces = numPieces
+}
+
+// checkPieceIndex rejects a piece index the torrent doesn't have. While the
+// piece count is unknown the index is only bounded by the largest bitfield
+func (p *PeerConnection) checkPieceIndex(index int) error {
+	limit := p.numPieces
+	if limit == 0 {
+		limit = MaxMessageLength * 8
+	}
+	if index < 0 || index >= limit {
+		return fmt.Errorf("piece index %d out of range", index)
+	}
+	return nil
+}
+
+// checkBitfield rejects a bitfield of the wrong length or with spare bits set
+func (p *PeerConnection) checkBitfield(bitfield []byte) error {
+	if p.numPieces == 0 {
+		return nil
+	}
+	if len(bitfield) != (p.numPieces+7)/8 {
+		return fmt.Errorf("bitfield of %d bytes for %d pieces", len(bitfield), p.numPieces)
+	}
+	if spare := p.numPieces % 8; spare != 0 && bitfield[len(bitfield)-1]&(0xFF>>spare) != 0 {
+		return fmt.Errorf("bitfield has spare bits set")
+	}
+	return nil
+}
+
+// PeerChoking reports whether the peer is currently choking us, it is safe to
+// call while another goroutine reads from the connection
+func (p *PeerConnection) PeerChoking() bool {
+	return p.peerChoking.Load()
+}
+
+// HasPiece reports whether the peer announced it has a piece
+func (p *PeerConnection) HasPiece(index int) bool {
+	if p.hasAll {
+		return true
+	}
+	return index/8 < len(p.pieces) && p.pieces[index/8]&(0x80>>(index%8)) != 0
+}
+
+// handleExtensionMessage dispatches an extension message by the local ID we assigned
+func (p *PeerConnection) handleExtensionMessage(payload []byte) error {
+	if payload[0] == HandshakeExtensionID {
+		handshake, err := parseExtensionHandshake(payload[1:])
+		if err != nil {
+			return err
+		}
+		p.applyExtensionHandshake(handshake)
+		return nil
+	}
+
+	extension, ok := p.extensions.Lookup(payload[0])
+	if !ok {
+		return nil // Messages for extensions we never advertised are ignored
+	}
+	return extension.HandleMessage(p, payload[1:])
+}
+
+func sendMessage(conn net.Conn, id uint8, payload []byte) error {
+	message := NewMessageBuilder().
+		WithID(id).
+		WithPayload(payload).
+		Build()
+
+	_, err := conn.Write(message)
+	if err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	return nil
+}
+
+// messageReader reads messages from a peer, keeping a partially read message
+// when a read times out so the connection stays usable
+type messageReader struct {
+	conn       net.Conn
+	length     [4]byte
+	lengthRead int
+	message    []byte
+	read       int
+}
+
+// ReadMessage reads the next message, or resumes one interrupted by a timeout
+func (r *messageReader) ReadMessage() (uint8, []byte, error) {
+	for r.lengthRead < len(r.length) {
+		n, err := r.conn.Read(r.length[r.lengthRead:])
+		r.lengthRead += n
+		if err != nil && r.lengthRead < len(r.length) {
+			return 0, nil, fmt.Errorf("failed to read message length: %w", err)
+		}
+	}
+
+	if r.message == nil {
+		length := binary.BigEndian.Uint32(r.length[:])
+		if length == 0 {
+			r.lengthRead = 0
+			return 0, nil, nil // Keep-alive message
+		}
+		if length > MaxMessageLength {
+			return 0, nil, fmt.Errorf("message length %d exceeds limit", length)
+		}
+		r.message = make([]byte, length)
+	}
+
+	for r.read < len(r.message) {
+		n, err := r.conn.Read(r.message[r.read:])
+		r.read += n
+		if err != nil && r.read < len(r.message) {
+			return 0, nil, fmt.Errorf("failed to read message body: %w", err)
+		}
+	}
+
+	message := r.message
+	r.lengthRead, r.message, r.read = 0, nil, 0
+	return message[0], message[1:], nil
+}
+
+func ReadMessage(conn net.Conn) (uint8, []byte, error) {
+	lengthBuf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, lengthBuf); err != nil {
+		return 0, nil, fmt.Errorf("failed to read message length: %w", err)
+	}
+
+	length := binary.BigEndian.Uint32(lengthBuf)
+	if length == 0 {
+		return 0, nil, nil // Keep-alive message
+	}
+	if length > MaxMessageLength {
+		return 0, nil, fmt.Errorf("message length %d exceeds limit", length)
+	}
+
+	message := make([]byte, length)
+	if _, err := io.ReadFull(conn, message); err != nil {
+		return 0, nil, fmt.Errorf("failed to read message body: %w", err)
+	}
+
+	return message[0], message[1:], nil
+}
+
+// SetupConnection tells the peer we're interested and waits to be unchoked
+func SetupConnection(peerConn *PeerConnection) error {
+	interestedMsg := NewMessageBuilder().
+		WithID(IDInterested).
+		Build()
+
+	if _, err := peerConn.Conn.Write(interestedMsg); err != nil {
+		return fmt.Errorf("failed to send interested message: %w", err)
+	}
+
+	return waitForUnchoke(peerConn)
+}
+
+func waitForBitfield(conn net.Conn) error {
+	id, _, err := ReadMessage(conn)
+	if err != nil {
+		return err
+	}
+
+	if id != IDBitfield {
+		return fmt.Errorf("expected bitfield message, got %d", id)
+	}
+	return nil
+}
+
+// waitForUnchoke waits up to the idle timeout, as peers keeping us choked
+// while sending keep-alives would otherwise hold us forever
+func waitForUnchoke(peerConn *PeerConnection) error {
+	defer peerConn.ExpectWithin(peerConn.timeouts.Idle)()
+
+	for {
+		id, _, err := peerConn.ReadMessage()
+		if err != nil {
+			return fmt.Errorf("error waiting for unchoke: %w", err)
+		}
+		if id == IDUnchoke {
+			return nil
+		}
+	}
+}
+
+func sendRequest(conn net.Conn, index, begin, length uint32) error {
+	requestMsg := NewMessageBuilder().
+		WithID(IDRequest).
+		WithPayload(NewRequestPayloadBuilder().
+			WithIndex(index).
+			WithBegin(begin).
+			WithLength(length).
+			Build()).
+		Build()
+
+	_, err := conn.Write(requestMsg)
+	return err
+}
+
+// receiveBlock waits for the block requested at index and begin, failing early
+// if the peer rejects the request, drops it by choking us or snubs us
+func receiveBlock(peerConn *PeerConnection, index, begin uint32) ([]byte, error) {
+	defer peerConn.ExpectWithin(peerConn.timeouts.Snub)()
+
+	for {
+		id, payload, err := peerConn.ReadMessage()
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			// The request stays queued at the peer, a late block ends the snub
+			peerConn.snubbed = true
+			return nil, ErrPeerSnubbed
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to receive block: %w", err)
+		}
+
+		switch id {
+		case IDPiece:
+			if len(payload) < 8 {
+				return nil, fmt.Errorf("piece message too short")
+			}
+			if !requestMatches(payload, index, begin) {
+				continue // Late block for a request we gave up on
+			}
+			return payload[8:], nil // Skip index and begin fields
+
+		case IDRejectRequest:
+			if requestMatches(payload, index, begin) {
+				return nil, ErrRequestRejected
+			}
+
+		case IDChoke:
+			// Without the Fast Extension a choke silently discards our requests
+			if !peerConn.Capabilities.Fast {
+				return nil, ErrPeerChoked
+			}
+		}
+	}
+}
+
+// DownloadPiece requests every block of a piece in turn and returns the
+// assembled, unverified piece
+func DownloadPiece(peerConn *PeerConnection, pieceIndex int, pieceLength int) ([]byte, error) {
+	numBlocks := int(math.Ceil(float64(pieceLength) / float64(BlockSize)))
+	pieceData := make([]byte, pieceLength)
+
+	for blockIndex := 0; blockIndex < numBlocks; blockIndex++ {
+		begin := blockIndex * BlockSize
+		length := calculateBlockLength(begin, BlockSize, pieceLength)
+
+		if err := downloadBlock(peerConn, pieceIndex, begin, length, pieceData); err != nil {
+			return nil, fmt.Errorf("download block %d: %w", blockIndex, err)
+		}
+	}
+
+	return pieceData, nil
+}
+
+func calculateBlockLength(begin, blockSize, pieceLength int) int {
+	if begin+blockSize > pieceLength {
+		return pieceLength - begin
+	}
+	return blockSize
+}
+
+func downloadBlock(peerConn *PeerConnection, pieceIndex, begin, length int, pieceData []byte) error {
+	peerConn.pendingRequests.Add(1)
+	defer peerConn.pendingRequests.Add(-1)
+
+	if err := sendRequest(peerConn.Conn, uint32(pieceIndex), uint32(begin), uint32(length)); err != nil {
+		return err
+	}
+
+	blockData, err := receiveBlock(peerConn, uint32(pieceIndex), uint32(begin))
+	if err != nil {
+		return err
+	}
+
+	copy(pieceData[begin:], blockData)
+	return nil
+}
+
+// Snubbed reports whether the peer stopped sending the blocks we requested
+func (p *PeerConnection) Snubbed() bool {
+	return p.snubbed
+}
+
+// PendingRequests returns how many block requests are waiting for their
+// block, safe to call from any goroutine
+func (p *PeerConnection) PendingRequests() int {
+	return int(p.pendingRequests.Load())
+}
+
+func requestMatches(payload []byte, index, begin uint32) bool {
+	return binary.BigEndian.Uint32(payload[0:4]) == index && binary.BigEndian.Uint32(payload[4:8]) == begin
+}
@@ -0,0 +1,86 @@
+package peerwire
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// RateLimiter caps the combined download rate of the connections sharing it
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   int     // Bytes per second, zero means unlimited
+	tokens float64 // Bytes that can be read right away, negative when in debt
+	last   time.Time
+}
+
+// NewRateLimiter creates a limiter allowing bytesPerSecond, zero means unlimited
+func NewRateLimiter(bytesPerSecond int) *RateLimiter {
+	return &RateLimiter{rate: max(bytesPerSecond, 0), last: time.Now()}
+}
+
+// SetRate changes the limit, zero means unlimited
+func (l *RateLimiter) SetRate(bytesPerSecond int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rate = max(bytesPerSecond, 0)
+	l.tokens = 0
+	l.last = time.Now()
+}
+
+// Rate returns the limit in bytes per second, zero means unlimited
+func (l *RateLimiter) Rate() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
+
+// burst is the most a single read may take, a second's worth of data
+func (l *RateLimiter) burst() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.rate == 0 {
+		return 0
+	}
+	return max(l.rate, 1024)
+}
+
+// take charges n bytes to the budget and returns how long to wait before the
+// budget is back in credit
+func (l *RateLimiter) take(n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.rate == 0 {
+		return 0
+	}
+
+	now := time.Now()
+	l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*float64(l.rate), float64(l.rate))
+	l.last = now
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / float64(l.rate) * float64(time.Second))
+}
+
+// limitedConn throttles reads from a peer through a shared RateLimiter
+type limitedConn struct {
+	net.Conn
+	limiter *RateLimiter
+}
+
+func (c *limitedConn) Read(buf []byte) (int, error) {
+	if burst := c.limiter.burst(); burst > 0 && len(buf) > burst {
+		buf = buf[:burst]
+	}
+
+	n, err := c.Conn.Read(buf)
+	if n > 0 {
+		time.Sleep(c.limiter.take(n))
+	}
+	return n, err
+}
@@ -1,4 +1,4 @@
-package main
+package peerwire
 
 import "encoding/binary"
 
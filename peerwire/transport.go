@@ -0,0 +1,103 @@
+package peerwire
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// utpHeadStart is how long a uTP attempt runs alone before TCP is tried as well
+const utpHeadStart = 250 * time.Millisecond
+
+type dialResult struct {
+	network string
+	conn    net.Conn
+	err     error
+}
+
+// dialTransport connects to a peer over uTP and TCP, racing them Happy Eyeballs
+// style. uTP gets a head start since its congestion control yields to other
+// traffic, TCP starts early if uTP fails, and the first connection wins.
+// The whole race is bounded by the connect timeout
+func dialTransport(ctx context.Context, peerAddr string, timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := withOptionalTimeout(ctx, timeout)
+	defer cancel()
+
+	results := make(chan dialResult, 2)
+	startTCP := make(chan struct{})
+
+	go func() {
+		conn, err := dialUTP(ctx, peerAddr)
+		results <- dialResult{"utp", conn, err}
+	}()
+	go func() {
+		select {
+		case <-time.After(utpHeadStart):
+		case <-startTCP:
+		}
+
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", peerAddr)
+		results <- dialResult{"tcp", conn, err}
+	}()
+
+	var tcpErr error
+	for attempt := 0; attempt < 2; attempt++ {
+		result := <-results
+		if result.err == nil {
+			if attempt == 0 {
+				// The other attempt may still connect before it sees the cancellation
+				go func() {
+					if late := <-results; late.conn != nil {
+						late.conn.Close()
+					}
+				}()
+			}
+			return result.conn, nil
+		}
+
+		if result.network == "tcp" {
+			tcpErr = result.err
+		} else {
+			close(startTCP)
+		}
+	}
+	return nil, fmt.Errorf("failed to dial peer: %w", tcpErr)
+}
+
+// withOptionalTimeout bounds a context by a timeout, where zero means no limit
+func withOptionalTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// guardConn bounds blocking I/O on conn by a timeout and interrupts it when ctx
+// is cancelled, until the returned function is called
+func guardConn(ctx context.Context, conn net.Conn, timeout time.Duration) func() {
+	if timeout > 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+	}
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+
+	return func() {
+		if stop() {
+			conn.SetDeadline(time.Time{})
+		}
+	}
+}
+
+// addrIP returns the IP address of a TCP or uTP endpoint
+func addrIP(addr net.Addr) net.IP {
+	switch addr := addr.(type) {
+	case *net.TCPAddr:
+		return addr.IP
+	case *net.UDPAddr:
+		return addr.IP
+	}
+	return nil
+}
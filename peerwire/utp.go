@@ -0,0 +1,894 @@
+package peerwire
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// uTP packet types (BEP 29)
+const (
+	utpData  = 0
+	utpFin   = 1
+	utpState = 2
+	utpReset = 3
+	utpSyn   = 4
+)
+
+const (
+	utpVersion          = 1
+	utpHeaderSize       = 20
+	utpExtensionSack    = 1
+	utpMaxPayload       = 1200                   // Keeps packets below common path MTUs
+	utpMinWindow        = 2 * utpMaxPayload      // The congestion window never shrinks below this
+	utpMaxWindow        = 4 << 20                // Upper bound on the congestion window
+	utpReceiveWindow    = 1 << 20                // Bytes we buffer before the reader catches up
+	utpReorderLimit     = 1024                   // Packets accepted ahead of the next expected one
+	utpTargetDelay      = 100 * time.Millisecond // LEDBAT target queuing delay
+	utpMaxCwndIncrease  = 3000                   // Bytes the window grows by per RTT at most
+	utpInitialTimeout   = time.Second
+	utpMinTimeout       = 500 * time.Millisecond
+	utpMaxTimeout       = 30 * time.Second
+	utpMaxTransmissions = 5 // Sends of one packet before the connection is given up
+	utpMaxSynSends      = 3
+	utpTickInterval     = 50 * time.Millisecond
+)
+
+type utpConnState int
+
+const (
+	utpSynSent utpConnState = iota
+	utpConnected
+	utpFinSent
+	utpClosed
+)
+
+var errUTPReset = errors.New("utp connection reset by peer")
+
+// utpHeader is the fixed header of a uTP packet plus the selective ack extension
+type utpHeader struct {
+	kind          uint8
+	connID        uint16
+	timestamp     uint32 // Microseconds, sender's clock
+	timestampDiff uint32 // Sender's view of the one way delay of our packets
+	window        uint32
+	seq           uint16
+	ack           uint16
+	sack          []byte // Bitmask of received packets starting at ack+2
+}
+
+func (h *utpHeader) marshal(payload []byte) []byte {
+	size := utpHeaderSize + len(payload)
+	if h.sack != nil {
+		size += 2 + len(h.sack)
+	}
+
+	buf := make([]byte, utpHeaderSize, size)
+	buf[0] = h.kind<<4 | utpVersion
+	binary.BigEndian.PutUint16(buf[2:4], h.connID)
+	binary.BigEndian.PutUint32(buf[4:8], h.timestamp)
+	binary.BigEndian.PutUint32(buf[8:12], h.timestampDiff)
+	binary.BigEndian.PutUint32(buf[12:16], h.window)
+	binary.BigEndian.PutUint16(buf[16:18], h.seq)
+	binary.BigEndian.PutUint16(buf[18:20], h.ack)
+
+	if h.sack != nil {
+		buf[1] = utpExtensionSack
+		buf = append(buf, 0, byte(len(h.sack)))
+		buf = append(buf, h.sack...)
+	}
+	return append(buf, payload...)
+}
+
+// parseUTPPacket splits a datagram into its header and payload
+func parseUTPPacket(buf []byte) (*utpHeader, []byte, error) {
+	if len(buf) < utpHeaderSize {
+		return nil, nil, fmt.Errorf("utp packet too short")
+	}
+	if buf[0]&0x0f != utpVersion || buf[0]>>4 > utpSyn {
+		return nil, nil, fmt.Errorf("not a utp packet")
+	}
+
+	h := &utpHeader{
+		kind:          buf[0] >> 4,
+		connID:        binary.BigEndian.Uint16(buf[2:4]),
+		timestamp:     binary.BigEndian.Uint32(buf[4:8]),
+		timestampDiff: binary.BigEndian.Uint32(buf[8:12]),
+		window:        binary.BigEndian.Uint32(buf[12:16]),
+		seq:           binary.BigEndian.Uint16(buf[16:18]),
+		ack:           binary.BigEndian.Uint16(buf[18:20]),
+	}
+
+	// Extensions are chained, each naming the type of the one after it
+	extension, offset := buf[1], utpHeaderSize
+	for extension != 0 {
+		if offset+2 > len(buf) || offset+2+int(buf[offset+1]) > len(buf) {
+			return nil, nil, fmt.Errorf("utp extension truncated")
+		}
+		next, length := buf[offset], int(buf[offset+1])
+		if extension == utpExtensionSack {
+			h.sack = buf[offset+2 : offset+2+length]
+		}
+		extension, offset = next, offset+2+length
+	}
+	return h, buf[offset:], nil
+}
+
+func utpNow() uint32 {
+	return uint32(time.Now().UnixMicro())
+}
+
+// seqLess compares sequence numbers that wrap around at 16 bits
+func seqLess(a, b uint16) bool {
+	return int16(a-b) < 0
+}
+
+func randomUint16() uint16 {
+	var buf [2]byte
+	rand.Read(buf[:])
+	return binary.BigEndian.Uint16(buf[:])
+}
+
+// utpSocket multiplexes uTP connections over one UDP socket
+type utpSocket struct {
+	conn      *net.UDPConn
+	connected bool // Dialing sockets are connected so ICMP errors fail the dial quickly
+
+	mu     sync.Mutex
+	conns  map[utpConnKey]*utpConn
+	accept chan *utpConn // Nil unless the socket is listening
+	closed bool
+}
+
+type utpConnKey struct {
+	addr string
+	id   uint16 // The connection ID we receive packets on
+}
+
+func newUTPSocket(conn *net.UDPConn, connected bool) *utpSocket {
+	s := &utpSocket{
+		conn:      conn,
+		connected: connected,
+		conns:     make(map[utpConnKey]*utpConn),
+	}
+	go s.readLoop()
+	return s
+}
+
+func (s *utpSocket) send(addr *net.UDPAddr, packet []byte) {
+	if s.connected {
+		s.conn.Write(packet)
+		return
+	}
+	s.conn.WriteToUDP(packet, addr)
+}
+
+func (s *utpSocket) readLoop() {
+	buf := make([]byte, 64*1024)
+	for {
+		n, addr, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			if s.connected || errors.Is(err, net.ErrClosed) {
+				s.fail(err)
+				return
+			}
+			continue
+		}
+
+		h, payload, err := parseUTPPacket(buf[:n])
+		if err != nil {
+			continue
+		}
+
+		conn, ok := s.lookup(addr, h)
+		if !ok && h.kind != utpReset {
+			reset := &utpHeader{kind: utpReset, connID: h.connID, timestamp: utpNow(), ack: h.seq}
+			s.send(addr, reset.marshal(nil))
+		}
+		if conn == nil {
+			continue
+		}
+		conn.handlePacket(h, append([]byte{}, payload...))
+	}
+}
+
+// lookup finds the connection a packet belongs to, creating it for a new SYN
+// on a listening socket. ok is false when the packet belongs to no connection
+// and should be answered with a reset
+func (s *utpSocket) lookup(addr *net.UDPAddr, h *utpHeader) (conn *utpConn, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if conn, ok := s.conns[utpConnKey{addr.String(), h.connID}]; ok {
+		return conn, true
+	}
+	if h.kind != utpSyn || s.accept == nil || s.closed {
+		return nil, false
+	}
+
+	// A SYN carries the initiator's receive ID, we receive on the one after it
+	key := utpConnKey{addr.String(), h.connID + 1}
+	if conn, ok := s.conns[key]; ok {
+		return conn, true // Retransmitted SYN
+	}
+
+	conn = newUTPConn(s, addr, h.connID+1, h.connID)
+	conn.state = utpConnected
+	conn.seq = randomUint16()
+	conn.ack = h.seq
+	close(conn.connected)
+
+	select {
+	case s.accept <- conn:
+	default:
+		// Backlog full, the SYN is dropped without a reply so the peer retransmits it
+		return nil, true
+	}
+	s.conns[key] = conn
+	go conn.run()
+	return conn, true
+}
+
+func (s *utpSocket) register(conn *utpConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.conns[utpConnKey{conn.remote.String(), conn.recvID}] = conn
+}
+
+func (s *utpSocket) remove(conn *utpConn) {
+	s.mu.Lock()
+	delete(s.conns, utpConnKey{conn.remote.String(), conn.recvID})
+	idle := len(s.conns) == 0 && s.accept == nil
+	s.mu.Unlock()
+
+	// Dialing sockets exist for one connection only
+	if idle {
+		s.close()
+	}
+}
+
+// fail tears down every connection after the socket stopped working
+func (s *utpSocket) fail(err error) {
+	s.mu.Lock()
+	conns := make([]*utpConn, 0, len(s.conns))
+	for _, conn := range s.conns {
+		conns = append(conns, conn)
+	}
+	s.mu.Unlock()
+
+	for _, conn := range conns {
+		conn.destroy(err)
+	}
+	s.close()
+}
+
+func (s *utpSocket) close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.mu.Unlock()
+
+	return s.conn.Close()
+}
+
+// utpPacket is a sent packet kept until the peer acknowledges it
+type utpPacket struct {
+	kind          uint8
+	seq           uint16
+	payload       []byte
+	sentAt        time.Time
+	transmissions int
+}
+
+// utpConn is a uTP connection implementing net.Conn
+type utpConn struct {
+	socket *utpSocket
+	remote *net.UDPAddr
+	recvID uint16
+	sendID uint16
+
+	mu    sync.Mutex
+	state utpConnState
+	err   error
+	seq   uint16 // Next sequence number to send
+	ack   uint16 // Last sequence number received in order
+
+	// Sending side
+	outgoing   []*utpPacket
+	inflight   int
+	cwnd       float64
+	peerWindow int
+	rtt        time.Duration
+	rttVar     time.Duration
+	rto        time.Duration
+	lastAck    uint16
+	dupAcks    int
+	delays     delayHistory
+	replyDelay uint32 // One way delay of the peer's last packet, echoed back
+
+	// Receiving side
+	readBuf []byte
+	reorder map[uint16][]byte
+	gotFin  bool
+	finSeq  uint16
+	eof     bool
+
+	readDeadline  time.Time
+	writeDeadline time.Time
+	readNotify    chan struct{}
+	writeNotify   chan struct{}
+	connected     chan struct{}
+	done          chan struct{}
+}
+
+func newUTPConn(socket *utpSocket, remote *net.UDPAddr, recvID, sendID uint16) *utpConn {
+	return &utpConn{
+		socket:      socket,
+		remote:      remote,
+		recvID:      recvID,
+		sendID:      sendID,
+		cwnd:        utpMinWindow,
+		peerWindow:  utpReceiveWindow,
+		rto:         utpInitialTimeout,
+		reorder:     make(map[uint16][]byte),
+		readNotify:  make(chan struct{}, 1),
+		writeNotify: make(chan struct{}, 1),
+		connected:   make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// dialUTP opens a uTP connection to addr
+func dialUTP(ctx context.Context, addr string) (net.Conn, error) {
+	remote, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	udpConn, err := net.DialUDP("udp", nil, remote)
+	if err != nil {
+		return nil, err
+	}
+
+	socket := newUTPSocket(udpConn, true)
+	recvID := randomUint16()
+	conn := newUTPConn(socket, remote, recvID, recvID+1)
+	socket.register(conn)
+	go conn.run()
+
+	conn.mu.Lock()
+	conn.seq = 1
+	conn.sendPacket(utpSyn, nil)
+	conn.mu.Unlock()
+
+	select {
+	case <-conn.connected:
+		conn.mu.Lock()
+		defer conn.mu.Unlock()
+		if conn.state == utpClosed {
+			return nil, conn.err
+		}
+		return conn, nil
+	case <-ctx.Done():
+		conn.destroy(ctx.Err())
+		return nil, ctx.Err()
+	}
+}
+
+// sendPacket sends a packet that consumes a sequence number and tracks it until acked
+func (c *utpConn) sendPacket(kind uint8, payload []byte) {
+	packet := &utpPacket{kind: kind, seq: c.seq, payload: append([]byte{}, payload...)}
+	c.seq++
+	c.outgoing = append(c.outgoing, packet)
+	c.inflight += len(packet.payload)
+	c.transmit(packet)
+}
+
+func (c *utpConn) transmit(packet *utpPacket) {
+	packet.sentAt = time.Now()
+	packet.transmissions++
+
+	connID := c.sendID
+	if packet.kind == utpSyn {
+		connID = c.recvID
+	}
+	h := c.header(packet.kind, connID)
+	h.seq = packet.seq
+	c.socket.send(c.remote, h.marshal(packet.payload))
+}
+
+// sendState acknowledges what we received without consuming a sequence number
+func (c *utpConn) sendState() {
+	h := c.header(utpState, c.sendID)
+	h.seq = c.seq
+	h.sack = c.selectiveAck()
+	c.socket.send(c.remote, h.marshal(nil))
+}
+
+func (c *utpConn) header(kind uint8, connID uint16) *utpHeader {
+	buffered := len(c.readBuf)
+	for _, payload := range c.reorder {
+		buffered += len(payload)
+	}
+
+	return &utpHeader{
+		kind:          kind,
+		connID:        connID,
+		timestamp:     utpNow(),
+		timestampDiff: c.replyDelay,
+		window:        uint32(max(utpReceiveWindow-buffered, 0)),
+		ack:           c.ack,
+	}
+}
+
+// selectiveAck builds the bitmask of out of order packets received after ack+1
+func (c *utpConn) selectiveAck() []byte {
+	if len(c.reorder) == 0 {
+		return nil
+	}
+
+	mask := make([]byte, 4)
+	for seq := range c.reorder {
+		bit := int(uint16(seq - c.ack - 2))
+		if bit < len(mask)*8 {
+			mask[bit/8] |= 1 << (bit % 8)
+		}
+	}
+	return mask
+}
+
+func (c *utpConn) handlePacket(h *utpHeader, payload []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.state == utpClosed {
+		return
+	}
+	if h.kind == utpReset {
+		c.destroyLocked(errUTPReset)
+		return
+	}
+
+	c.replyDelay = utpNow() - h.timestamp
+	c.peerWindow = int(h.window)
+
+	switch {
+	case h.kind == utpSyn:
+		c.sendState() // Our answer to the SYN was lost
+		return
+
+	case c.state == utpSynSent:
+		// The reply to a SYN carries the first sequence number the peer will use
+		c.ack = h.seq - 1
+		c.state = utpConnected
+		close(c.connected)
+	}
+
+	c.processAck(h)
+
+	switch h.kind {
+	case utpData:
+		c.receive(h.seq, payload)
+		c.sendState()
+	case utpFin:
+		if !c.gotFin {
+			c.gotFin = true
+			c.finSeq = h.seq
+		}
+		c.receive(h.seq, nil)
+		c.sendState()
+	}
+}
+
+// receive queues a data or FIN packet, delivering everything that is now in order
+func (c *utpConn) receive(seq uint16, payload []byte) {
+	if !seqLess(c.ack, seq) || uint16(seq-c.ack) > utpReorderLimit {
+		return // Duplicate, or too far ahead to buffer
+	}
+	if c.gotFin && seqLess(c.finSeq, seq) {
+		return
+	}
+
+	c.reorder[seq] = payload
+	for {
+		next, ok := c.reorder[c.ack+1]
+		if !ok {
+			break
+		}
+		delete(c.reorder, c.ack+1)
+		c.ack++
+		c.readBuf = append(c.readBuf, next...)
+	}
+
+	if c.gotFin && c.ack == c.finSeq {
+		c.eof = true
+	}
+	wake(c.readNotify)
+}
+
+// processAck releases acknowledged packets and adjusts the congestion window
+func (c *utpConn) processAck(h *utpHeader) {
+	now := time.Now()
+	acked := 0
+	ackPacket := func(packet *utpPacket) {
+		acked += len(packet.payload)
+		c.inflight -= len(packet.payload)
+		if packet.transmissions == 1 {
+			c.updateRTT(now.Sub(packet.sentAt))
+		}
+	}
+
+	for len(c.outgoing) > 0 && !seqLess(h.ack, c.outgoing[0].seq) {
+		ackPacket(c.outgoing[0])
+		c.outgoing = c.outgoing[1:]
+	}
+
+	// Selectively acked packets are released, and three of them past a gap mean it was lost
+	lost := false
+	if h.sack != nil {
+		remaining := c.outgoing[:0]
+		sackedAfter := 0
+		for i := len(c.outgoing) - 1; i >= 0; i-- {
+			packet := c.outgoing[i]
+			bit := int(uint16(packet.seq - h.ack - 2))
+			if bit < len(h.sack)*8 && h.sack[bit/8]&(1<<(bit%8)) != 0 {
+				ackPacket(packet)
+				sackedAfter++
+				c.outgoing[i] = nil
+				continue
+			}
+			if sackedAfter >= 3 && packet.transmissions == 1 {
+				c.transmit(packet)
+				lost = true
+			}
+		}
+		for _, packet := range c.outgoing {
+			if packet != nil {
+				remaining = append(remaining, packet)
+			}
+		}
+		c.outgoing = remaining
+	}
+
+	// Three duplicate acks also signal a lost packet
+	if acked == 0 && h.kind == utpState && h.ack == c.lastAck && len(c.outgoing) > 0 {
+		c.dupAcks++
+		if c.dupAcks == 3 {
+			c.transmit(c.outgoing[0])
+			lost = true
+		}
+	} else if h.ack != c.lastAck {
+		c.lastAck = h.ack
+		c.dupAcks = 0
+	}
+
+	if lost {
+		c.cwnd = max(c.cwnd/2, utpMinWindow)
+	}
+	if acked > 0 {
+		c.updateWindow(h.timestampDiff, acked)
+		wake(c.writeNotify)
+	}
+
+	if c.state == utpFinSent && len(c.outgoing) == 0 {
+		c.destroyLocked(net.ErrClosed)
+	}
+}
+
+// updateWindow applies LEDBAT: grow while queuing delay is below the target and
+// shrink when our traffic starts building a queue
+func (c *utpConn) updateWindow(delay uint32, acked int) {
+	if delay == 0 {
+		return
+	}
+	c.delays.add(delay)
+
+	queuing := time.Duration(delay-c.delays.base()) * time.Microsecond
+	offTarget := float64(utpTargetDelay-queuing) / float64(utpTargetDelay)
+	c.cwnd += utpMaxCwndIncrease * offTarget * float64(acked) / c.cwnd
+	c.cwnd = min(max(c.cwnd, utpMinWindow), utpMaxWindow)
+}
+
+func (c *utpConn) updateRTT(sample time.Duration) {
+	if c.rtt == 0 {
+		c.rtt = sample
+		c.rttVar = sample / 2
+	} else {
+		delta := c.rtt - sample
+		if delta < 0 {
+			delta = -delta
+		}
+		c.rttVar += (delta - c.rttVar) / 4
+		c.rtt += (sample - c.rtt) / 8
+	}
+	c.rto = min(max(c.rtt+4*c.rttVar, utpMinTimeout), utpMaxTimeout)
+}
+
+// run retransmits packets whose acknowledgement is overdue
+func (c *utpConn) run() {
+	ticker := time.NewTicker(utpTickInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			c.checkTimeout()
+		}
+	}
+}
+
+func (c *utpConn) checkTimeout() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.outgoing) == 0 {
+		return
+	}
+	oldest := c.outgoing[0]
+	if time.Since(oldest.sentAt) < c.rto {
+		return
+	}
+
+	limit := utpMaxTransmissions
+	if oldest.kind == utpSyn {
+		limit = utpMaxSynSends
+	}
+	if oldest.transmissions >= limit {
+		c.destroyLocked(os.ErrDeadlineExceeded)
+		return
+	}
+
+	c.rto = min(c.rto*2, utpMaxTimeout)
+	c.cwnd = utpMinWindow
+	c.transmit(oldest)
+}
+
+func (c *utpConn) destroy(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.destroyLocked(err)
+}
+
+func (c *utpConn) destroyLocked(err error) {
+	if c.state == utpClosed {
+		return
+	}
+	if c.state == utpSynSent {
+		close(c.connected)
+	}
+	c.state = utpClosed
+	c.err = err
+	close(c.done)
+	wake(c.readNotify)
+	wake(c.writeNotify)
+	c.socket.remove(c)
+}
+
+func (c *utpConn) Read(buf []byte) (int, error) {
+	for {
+		c.mu.Lock()
+		if len(c.readBuf) > 0 {
+			n := copy(buf, c.readBuf)
+			c.readBuf = c.readBuf[n:]
+			c.mu.Unlock()
+			return n, nil
+		}
+		if c.eof {
+			c.mu.Unlock()
+			return 0, io.EOF
+		}
+		if c.state == utpClosed || c.state == utpFinSent {
+			err := c.err
+			c.mu.Unlock()
+			return 0, err
+		}
+		deadline := c.readDeadline
+		c.mu.Unlock()
+
+		if err := c.wait(c.readNotify, deadline); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (c *utpConn) Write(buf []byte) (int, error) {
+	written := 0
+	for written < len(buf) {
+		c.mu.Lock()
+		if c.state != utpConnected {
+			err := c.err
+			if err == nil {
+				err = net.ErrClosed
+			}
+			c.mu.Unlock()
+			return written, err
+		}
+
+		// One packet is always allowed in flight so a closed window gets probed
+		window := min(int(c.cwnd), c.peerWindow)
+		if c.inflight > 0 && c.inflight+utpMaxPayload > window {
+			deadline := c.writeDeadline
+			c.mu.Unlock()
+			if err := c.wait(c.writeNotify, deadline); err != nil {
+				return written, err
+			}
+			continue
+		}
+
+		n := min(len(buf)-written, utpMaxPayload)
+		c.sendPacket(utpData, buf[written:written+n])
+		c.mu.Unlock()
+		written += n
+	}
+	return written, nil
+}
+
+// wait blocks until notified, the deadline passes or the connection ends
+func (c *utpConn) wait(notify chan struct{}, deadline time.Time) error {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return os.ErrDeadlineExceeded
+		}
+		timer := time.NewTimer(remaining)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-notify:
+	case <-c.done:
+	case <-timeout:
+		return os.ErrDeadlineExceeded
+	}
+	return nil
+}
+
+// Close sends a FIN and lets it be retransmitted in the background until acked
+func (c *utpConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch c.state {
+	case utpConnected:
+		c.sendPacket(utpFin, nil)
+		c.state = utpFinSent
+		if c.err == nil {
+			c.err = net.ErrClosed
+		}
+		wake(c.readNotify)
+		wake(c.writeNotify)
+	case utpSynSent:
+		c.destroyLocked(net.ErrClosed)
+	}
+	return nil
+}
+
+func (c *utpConn) LocalAddr() net.Addr {
+	return c.socket.conn.LocalAddr()
+}
+
+func (c *utpConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+func (c *utpConn) SetDeadline(t time.Time) error {
+	c.SetReadDeadline(t)
+	return c.SetWriteDeadline(t)
+}
+
+func (c *utpConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline = t
+	c.mu.Unlock()
+	wake(c.readNotify)
+	return nil
+}
+
+func (c *utpConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.writeDeadline = t
+	c.mu.Unlock()
+	wake(c.writeNotify)
+	return nil
+}
+
+// utpListener accepts incoming uTP connections
+type utpListener struct {
+	socket *utpSocket
+	accept chan *utpConn
+}
+
+// listenUTP listens for uTP connections on a UDP address
+func listenUTP(addr string) (*utpListener, error) {
+	local, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	udpConn, err := net.ListenUDP("udp", local)
+	if err != nil {
+		return nil, err
+	}
+
+	accept := make(chan *utpConn, 16)
+	socket := &utpSocket{
+		conn:   udpConn,
+		conns:  make(map[utpConnKey]*utpConn),
+		accept: accept,
+	}
+	go socket.readLoop()
+	return &utpListener{socket: socket, accept: accept}, nil
+}
+
+func (l *utpListener) Accept() (net.Conn, error) {
+	conn, ok := <-l.accept
+	if !ok {
+		return nil, net.ErrClosed
+	}
+	return conn, nil
+}
+
+func (l *utpListener) Close() error {
+	l.socket.mu.Lock()
+	if l.socket.accept != nil {
+		close(l.socket.accept)
+		l.socket.accept = nil
+	}
+	l.socket.mu.Unlock()
+	return l.socket.close()
+}
+
+func (l *utpListener) Addr() net.Addr {
+	return l.socket.conn.LocalAddr()
+}
+
+// delayHistory tracks the lowest one way delay of recent minutes, used as the
+// base delay with no queuing
+type delayHistory struct {
+	minima      [3]uint32
+	index       int
+	bucketStart time.Time
+}
+
+func (d *delayHistory) add(delay uint32) {
+	now := time.Now()
+	if d.bucketStart.IsZero() || now.Sub(d.bucketStart) > time.Minute {
+		d.index = (d.index + 1) % len(d.minima)
+		d.minima[d.index] = delay
+		d.bucketStart = now
+		return
+	}
+	d.minima[d.index] = min(d.minima[d.index], delay)
+}
+
+func (d *delayHistory) base() uint32 {
+	base := d.minima[d.index]
+	for _, delay := range d.minima {
+		if delay != 0 {
+			base = min(base, delay)
+		}
+	}
+	return base
+}
+
+// wake notifies a waiter without blocking
+func wake(notify chan struct{}) {
+	select {
+	case notify <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,157 @@
+package peerwire
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// listenUTPLoopback listens for uTP connections on a free loopback port
+func listenUTPLoopback(t *testing.T) *utpListener {
+	t.Helper()
+	listener, err := listenUTP("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	return listener
+}
+
+// dialUTPLoopback connects to listener and accepts the connection, returning
+// the dialing and accepting ends
+func dialUTPLoopback(t *testing.T, listener *utpListener) (net.Conn, net.Conn) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	a, err := dialUTP(ctx, listener.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	b, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("failed to accept: %v", err)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	a.SetDeadline(deadline)
+	b.SetDeadline(deadline)
+	t.Cleanup(func() {
+		a.Close()
+		b.Close()
+	})
+	return a, b
+}
+
+func TestUTPLoopbackTransfer(t *testing.T) {
+	listener := listenUTPLoopback(t)
+	a, b := dialUTPLoopback(t, listener)
+	exchange(t, a, b)
+
+	// Enough data to need many packets and a growing congestion window
+	data := make([]byte, 2<<20)
+	rand.Read(data)
+	written := make(chan error, 1)
+	go func() {
+		_, err := a.Write(data)
+		written <- err
+	}()
+
+	received := make([]byte, len(data))
+	if _, err := io.ReadFull(b, received); err != nil {
+		t.Fatalf("failed to read transfer: %v", err)
+	}
+	if err := <-written; err != nil {
+		t.Fatalf("failed to write transfer: %v", err)
+	}
+	if !bytes.Equal(received, data) {
+		t.Fatalf("received data differs from the data sent")
+	}
+}
+
+func TestUTPGracefulClose(t *testing.T) {
+	listener := listenUTPLoopback(t)
+	a, b := dialUTPLoopback(t, listener)
+
+	message := []byte("last words before the FIN")
+	if _, err := a.Write(message); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	if err := a.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+
+	// The data sent before the FIN arrives, then a clean EOF
+	received, err := io.ReadAll(b)
+	if err != nil {
+		t.Fatalf("failed to read until EOF: %v", err)
+	}
+	if !bytes.Equal(received, message) {
+		t.Fatalf("read %q, want %q", received, message)
+	}
+
+	if _, err := a.Write(message); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("write after close returned %v, want %v", err, net.ErrClosed)
+	}
+
+	// The closing side is torn down once its FIN is acknowledged
+	select {
+	case <-a.(*utpConn).done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("connection still open after its FIN was acknowledged")
+	}
+}
+
+func TestUTPFullBacklog(t *testing.T) {
+	listener := listenUTPLoopback(t)
+	backlog := cap(listener.accept)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for i := 0; i < backlog; i++ {
+		conn, err := dialUTP(ctx, listener.Addr().String())
+		if err != nil {
+			t.Fatalf("failed to dial connection %d: %v", i, err)
+		}
+		defer conn.Close()
+	}
+
+	// The SYN of one more connection is dropped without a reset, so the dial
+	// keeps retransmitting it instead of failing
+	type dialResult struct {
+		conn net.Conn
+		err  error
+	}
+	dialed := make(chan dialResult, 1)
+	go func() {
+		conn, err := dialUTP(ctx, listener.Addr().String())
+		dialed <- dialResult{conn, err}
+	}()
+
+	select {
+	case result := <-dialed:
+		t.Fatalf("dial into a full backlog finished early: %v", result.err)
+	case <-time.After(utpInitialTimeout / 2):
+	}
+
+	// Accepting a connection makes room for the retransmitted SYN
+	if _, err := listener.Accept(); err != nil {
+		t.Fatalf("failed to accept: %v", err)
+	}
+	result := <-dialed
+	if result.err != nil {
+		t.Fatalf("dial after the backlog drained failed: %v", result.err)
+	}
+	defer result.conn.Close()
+
+	for i := 0; i < backlog; i++ {
+		if _, err := listener.Accept(); err != nil {
+			t.Fatalf("failed to accept queued connection %d: %v", i, err)
+		}
+	}
+}
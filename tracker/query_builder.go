@@ -0,0 +1,74 @@
+package tracker
+
+import (
+	"net/url"
+	"strconv"
+)
+
+// QueryBuilder handles the construction of announce query parameters
+type QueryBuilder struct {
+	values url.Values
+}
+
+func NewQueryBuilder() *QueryBuilder {
+	return &QueryBuilder{
+		values: make(url.Values),
+	}
+}
+
+func (b *QueryBuilder) WithInfoHash(infoHash []byte) *QueryBuilder {
+	b.values.Set("info_hash", string(infoHash))
+	return b
+}
+
+func (b *QueryBuilder) WithPeerID(peerID []byte) *QueryBuilder {
+	b.values.Set("peer_id", string(peerID))
+	return b
+}
+
+func (b *QueryBuilder) WithPort(port int) *QueryBuilder {
+	b.values.Set("port", strconv.Itoa(port))
+	b.values.Set("uploaded", "0")
+	b.values.Set("downloaded", "0")
+	b.values.Set("compact", "1")
+	return b
+}
+
+func (b *QueryBuilder) WithLeft(left int) *QueryBuilder {
+	b.values.Set("left", strconv.Itoa(left))
+	return b
+}
+
+// WithDownloaded sets the number of bytes downloaded so far
+func (b *QueryBuilder) WithDownloaded(downloaded int64) *QueryBuilder {
+	b.values.Set("downloaded", strconv.FormatInt(downloaded, 10))
+	return b
+}
+
+// WithEvent tells the tracker the download started, stopped or completed
+func (b *QueryBuilder) WithEvent(event Event) *QueryBuilder {
+	if event != EventNone {
+		b.values.Set("event", string(event))
+	}
+	return b
+}
+
+// WithKey sets the key that identifies us to the tracker across IP address changes
+func (b *QueryBuilder) WithKey(key string) *QueryBuilder {
+	if key != "" {
+		b.values.Set("key", key)
+	}
+	return b
+}
+
+// WithTrackerID echoes the tracker ID sent in the tracker's previous response
+func (b *QueryBuilder) WithTrackerID(trackerID string) *QueryBuilder {
+	if trackerID != "" {
+		b.values.Set("trackerid", trackerID)
+	}
+	return b
+}
+
+func (b *QueryBuilder) Build() url.Values {
+	return b.values
+}
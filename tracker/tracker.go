@@ -0,0 +1,97 @@
+// Package tracker announces to HTTP trackers and decodes the peers they list
+package tracker
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	bencode "github.com/jackpal/bencode-go"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// Event marks the announces at the start and end of a download
+type Event string
+
+const (
+	EventNone      Event = ""
+	EventStarted   Event = "started"
+	EventStopped   Event = "stopped"
+	EventCompleted Event = "completed"
+)
+
+// Request holds the parameters of an announce
+type Request struct {
+	InfoHash   []byte
+	PeerID     []byte
+	Port       int
+	Left       int
+	Downloaded int64
+	Event      Event
+	Key        string // Identifies us across IP address changes, optional
+	TrackerID  string // Tracker ID from the tracker's previous response, optional
+}
+
+// Response is a tracker's answer to an announce
+type Response struct {
+	Interval  int    `bencode:"interval"`
+	Peers     string `bencode:"peers"`
+	TrackerID string `bencode:"tracker id"`
+}
+
+// Announce sends an announce to the tracker, ctx bounds the whole request
+func Announce(ctx context.Context, announceURL string, request Request) (*Response, error) {
+	urlLink, err := url.Parse(announceURL)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing URL: %w", err)
+	}
+
+	query := NewQueryBuilder().
+		WithInfoHash(request.InfoHash).
+		WithPeerID(request.PeerID).
+		WithPort(request.Port).
+		WithLeft(request.Left).
+		WithDownloaded(request.Downloaded).
+		WithEvent(request.Event).
+		WithKey(request.Key).
+		WithTrackerID(request.TrackerID).
+		Build()
+
+	urlLink.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, urlLink.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating HTTP request: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error making HTTP request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var trackerRes Response
+	if err := bencode.Unmarshal(resp.Body, &trackerRes); err != nil {
+		return nil, fmt.Errorf("error decoding tracker response: %w", err)
+	}
+	return &trackerRes, nil
+}
+
+// PeerAddrs returns the addresses in the compact peer list
+func (r *Response) PeerAddrs() []string {
+	return ParsePeers(r.Peers)
+}
+
+// ParsePeers decodes a compact peer list into host:port addresses
+func ParsePeers(peersData string) []string {
+	const peerSize = 6 // 4 bytes for IP + 2 bytes for port
+	peers := make([]string, 0, len(peersData)/peerSize)
+
+	for i := 0; i+peerSize <= len(peersData); i += peerSize {
+		ip := net.IPv4(peersData[i], peersData[i+1], peersData[i+2], peersData[i+3])
+		port := binary.BigEndian.Uint16([]byte{peersData[i+4], peersData[i+5]})
+		peers = append(peers, fmt.Sprintf("%s:%d", ip, port))
+	}
+	return peers
+}